@@ -0,0 +1,544 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlog/models"
+)
+
+// AlertConfig declares alert rules and the notifiers they deliver to
+type AlertConfig struct {
+	Interval Duration        `json:"interval"` // How often rates and scores are re-evaluated
+	Rules    []AlertRule     `json:"rules"`
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Emails   []EmailConfig   `json:"emails"`
+}
+
+// AlertRule matches messages and fires when their rate or the host's visibility score crosses a threshold
+type AlertRule struct {
+	MessageFilter
+	Name           string   `json:"name"`
+	Threshold      int      `json:"threshold"` // Fire when more than Threshold messages match within Window
+	Window         Duration `json:"window"`
+	Groups         []string `json:"groups"`    // Only messages and hosts in these host groups
+	MinScore       float64  `json:"min_score"` // Fire when the host's visibility score, or the group's mean score, reaches MinScore
+	GroupBy        []string `json:"group_by"`  // host, group, facility and/or severity; defaults to host
+	Notify         []string `json:"notify"`    // Names of the notifiers to deliver to
+	RepeatInterval Duration `json:"repeat_interval"`
+}
+
+// Notification describes an alert state change delivered to notifiers
+type Notification struct {
+	Fingerprint string
+	Rule        string
+	Group       string
+	Host        string
+	State       string
+	Summary     string
+	Count       int
+	Score       float64
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Log         *models.Log // Most recent matching message, if any
+}
+
+// Notifier delivers alert notifications to an external channel
+type Notifier interface {
+	Name() string
+	Notify(n Notification) error
+}
+
+// alertRule is a compiled AlertRule
+type alertRule struct {
+	AlertRule
+}
+
+// alertGroup tracks one rule for one group of messages, identified by its fingerprint
+type alertGroup struct {
+	rule   *alertRule
+	events []time.Time
+	last   *models.Log
+	score  float64
+	alert  models.Alert
+	dirty  bool // The alert changed since it was saved
+}
+
+// scoreOutcome is a score rule's verdict for one host or host group, computed
+// before the engine is locked
+type scoreOutcome struct {
+	fingerprint string
+	host        string
+	hostGroup   string
+	score       float64
+	reached     bool
+	summary     string
+}
+
+// AlertEngine evaluates alert rules on ingest and on a schedule
+type AlertEngine struct {
+	store     *models.Store
+	hosts     *HostGroups
+	mu        sync.Mutex
+	rules     []*alertRule
+	notifiers map[string]Notifier
+	groups    map[string]*alertGroup
+	interval  time.Duration
+}
+
+// NewAlertEngine compiles the configured rules and notifiers
+func NewAlertEngine(store *models.Store, config AlertConfig, hosts *HostGroups) (*AlertEngine, error) {
+	engine := &AlertEngine{
+		store:     store,
+		hosts:     hosts,
+		notifiers: make(map[string]Notifier),
+		groups:    make(map[string]*alertGroup),
+		interval:  config.Interval.Or(time.Minute),
+	}
+
+	for _, webhook := range config.Webhooks {
+		notifier, err := NewWebhookNotifier(webhook)
+		if err != nil {
+			return nil, err
+		}
+		engine.AddNotifier(notifier)
+	}
+
+	for _, email := range config.Emails {
+		notifier, err := NewEmailNotifier(email)
+		if err != nil {
+			return nil, err
+		}
+		engine.AddNotifier(notifier)
+	}
+
+	for _, rule := range config.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("alert rule without a name")
+		}
+		compiled := &alertRule{AlertRule: rule}
+		if err := compiled.Compile(); err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", rule.Name, err)
+		}
+		if len(compiled.GroupBy) == 0 {
+			compiled.GroupBy = []string{"host"}
+		}
+		for _, name := range rule.Groups {
+			if _, ok := hosts.Find(name); !ok {
+				return nil, fmt.Errorf("alert rule %s refers to unknown host group %s", rule.Name, name)
+			}
+		}
+		for _, name := range rule.Notify {
+			if _, ok := engine.notifiers[name]; !ok {
+				return nil, fmt.Errorf("alert rule %s refers to unknown notifier %s", rule.Name, name)
+			}
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	return engine, nil
+}
+
+// AddNotifier registers a notifier that rules can refer to by name
+func (e *AlertEngine) AddNotifier(notifier Notifier) {
+	e.notifiers[notifier.Name()] = notifier
+}
+
+// Notifier returns the registered notifier with the given name
+func (e *AlertEngine) Notifier(name string) (Notifier, bool) {
+	notifier, ok := e.notifiers[name]
+	return notifier, ok
+}
+
+// Run re-evaluates the rules every interval; it never returns
+func (e *AlertEngine) Run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		e.Evaluate(now)
+	}
+}
+
+// isScoreRule reports whether the rule fires on visibility scores rather than message rates
+func (r *alertRule) isScoreRule() bool {
+	return r.MinScore > 0
+}
+
+// fingerprint identifies the group a message belongs to for this rule; hostGroup
+// is the host group it is counted towards when the rule groups by host group
+func (r *alertRule) fingerprint(l models.Log, hostGroup string) string {
+	parts := []string{r.Name}
+	for _, field := range r.GroupBy {
+		switch field {
+		case "host":
+			parts = append(parts, l.ClientIP)
+		case "group":
+			parts = append(parts, "group="+hostGroup)
+		case "facility":
+			parts = append(parts, fmt.Sprintf("facility=%d", l.Priority>>3))
+		case "severity":
+			parts = append(parts, fmt.Sprintf("severity=%d", l.Priority&7))
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (r *alertRule) groupsByHost() bool {
+	return slices.Contains(r.GroupBy, "host")
+}
+
+func (r *alertRule) groupsByHostGroup() bool {
+	return slices.Contains(r.GroupBy, "group")
+}
+
+// usesHostGroups reports whether the rule needs to know the host groups of a message
+func (r *alertRule) usesHostGroups() bool {
+	return len(r.Groups) > 0 || r.groupsByHostGroup()
+}
+
+// hostGroups returns the host groups a message is counted towards: the rule's
+// groups it belongs to, or all of them when the rule names none. Rules that do
+// not group by host group count the message once, under "".
+func (r *alertRule) hostGroups(memberOf []string) []string {
+	var groups []string
+	for _, name := range memberOf {
+		if len(r.Groups) == 0 || slices.Contains(r.Groups, name) {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) > 0 && !r.groupsByHostGroup() {
+		return []string{""}
+	}
+	return groups
+}
+
+// Observe feeds a stored message through the rate rules
+func (e *AlertEngine) Observe(l models.Log) {
+	now := l.ReceivedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Resolved before locking, as memberships are refreshed from the database
+	var memberOf []string
+	if slices.ContainsFunc(e.rules, (*alertRule).usesHostGroups) {
+		memberOf = e.hosts.Of(l)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		if rule.isScoreRule() || !rule.Matches(l) {
+			continue
+		}
+
+		hostGroups := []string{""}
+		if rule.usesHostGroups() {
+			hostGroups = rule.hostGroups(memberOf)
+		}
+
+		for _, hostGroup := range hostGroups {
+			group := e.group(rule, rule.fingerprint(l, hostGroup))
+			if rule.groupsByHost() {
+				group.alert.ClientIP = l.ClientIP
+			}
+			group.alert.HostGroup = hostGroup
+			entry := l
+			group.last = &entry
+			group.events = append(pruneEvents(group.events, now, rule.Window.Or(5*time.Minute)), now)
+
+			if len(group.events) > rule.Threshold {
+				e.fire(group, now, fmt.Sprintf("%d matching messages in %s", len(group.events), rule.Window.Or(5*time.Minute)))
+			}
+		}
+	}
+}
+
+// Evaluate resolves rate alerts whose window has drained, checks score rules and repeats unacknowledged alerts
+func (e *AlertEngine) Evaluate(now time.Time) {
+	// Scores take a pass over every host, so they are calculated before ingest is locked out
+	outcomes := make(map[*alertRule][]scoreOutcome)
+	for _, rule := range e.rules {
+		if rule.isScoreRule() {
+			outcomes[rule] = e.scoreOutcomes(rule)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, group := range e.groups {
+		if group.rule.isScoreRule() {
+			continue
+		}
+		group.events = pruneEvents(group.events, now, group.rule.Window.Or(5*time.Minute))
+		if group.alert.State == models.AlertFiring && len(group.events) <= group.rule.Threshold {
+			e.resolve(group, now)
+		}
+	}
+
+	for _, rule := range e.rules {
+		for _, outcome := range outcomes[rule] {
+			group := e.group(rule, outcome.fingerprint)
+			group.alert.ClientIP = outcome.host
+			group.alert.HostGroup = outcome.hostGroup
+			group.score = outcome.score
+
+			if outcome.reached {
+				e.fire(group, now, outcome.summary)
+			} else if group.alert.State == models.AlertFiring {
+				e.resolve(group, now)
+			}
+		}
+	}
+
+	for fingerprint, group := range e.groups {
+		e.repeat(group, now)
+		// Counts of alerts that kept firing are saved once per evaluation rather than per message
+		if group.dirty {
+			e.save(group)
+		}
+		// Quiet groups are forgotten and restored from the database when they match again
+		if group.alert.State != models.AlertFiring && len(group.events) == 0 && !group.dirty {
+			delete(e.groups, fingerprint)
+		}
+	}
+}
+
+// scoreOutcomes checks a score rule against every matching host, or host group
+func (e *AlertEngine) scoreOutcomes(rule *alertRule) []scoreOutcome {
+	if rule.groupsByHostGroup() {
+		return e.groupScoreOutcomes(rule)
+	}
+
+	hosts, err := e.store.GetAllHosts()
+	if err != nil {
+		log.Printf("Error retrieving hosts for alert rule %s: %v", rule.Name, err)
+		return nil
+	}
+
+	members, err := e.hosts.HostIDs(rule.Groups)
+	if err != nil {
+		log.Printf("Error retrieving host groups for alert rule %s: %v", rule.Name, err)
+		return nil
+	}
+	owners, err := e.store.GetAddressOwners(hosts)
+	if err != nil {
+		log.Printf("Error retrieving hosts for alert rule %s: %v", rule.Name, err)
+		return nil
+	}
+
+	var outcomes []scoreOutcome
+	for _, host := range hosts {
+		if host == "" || (len(rule.Hosts) > 0 && !slices.Contains(rule.Hosts, host)) {
+			continue
+		}
+		if members != nil && !slices.Contains(members, owners[host]) {
+			continue
+		}
+
+		score, err := VisibilityScore(e.store, host)
+		if err != nil {
+			log.Printf("Error calculating score for host %s: %v", host, err)
+			continue
+		}
+
+		outcomes = append(outcomes, scoreOutcome{
+			fingerprint: rule.Name + "/" + host,
+			host:        host,
+			score:       score,
+			reached:     score >= rule.MinScore,
+			summary:     fmt.Sprintf("visibility score %.2f reached %.2f", score, rule.MinScore),
+		})
+	}
+	return outcomes
+}
+
+// groupScoreOutcomes checks a score rule against the mean score of every matching host group
+func (e *AlertEngine) groupScoreOutcomes(rule *alertRule) []scoreOutcome {
+	hostScores, err := GetAllHostScores(e.store)
+	if err != nil {
+		log.Printf("Error calculating scores for alert rule %s: %v", rule.Name, err)
+		return nil
+	}
+	if len(rule.Hosts) > 0 {
+		hostScores = slices.DeleteFunc(hostScores, func(score HostScore) bool {
+			return !slices.Contains(rule.Hosts, score.Host)
+		})
+	}
+
+	groupScores, err := e.hosts.GetGroupScores(hostScores)
+	if err != nil {
+		log.Printf("Error calculating group scores for alert rule %s: %v", rule.Name, err)
+		return nil
+	}
+
+	var outcomes []scoreOutcome
+	for _, groupScore := range groupScores {
+		if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, groupScore.Group) {
+			continue
+		}
+
+		outcomes = append(outcomes, scoreOutcome{
+			fingerprint: rule.Name + "/group=" + groupScore.Group,
+			host:        groupScore.MaxHost,
+			hostGroup:   groupScore.Group,
+			score:       groupScore.Score,
+			reached:     groupScore.Hosts > 0 && groupScore.Score >= rule.MinScore,
+			summary: fmt.Sprintf("mean visibility score %.2f of %d hosts reached %.2f",
+				groupScore.Score, groupScore.Hosts, rule.MinScore),
+		})
+	}
+	return outcomes
+}
+
+// group returns the tracked group for a fingerprint, restoring persisted state on first use
+func (e *AlertEngine) group(rule *alertRule, fingerprint string) *alertGroup {
+	if group, ok := e.groups[fingerprint]; ok {
+		return group
+	}
+
+	group := &alertGroup{rule: rule}
+	if alert, err := e.store.GetAlert(fingerprint); err == nil {
+		group.alert = alert
+	} else {
+		group.alert = models.Alert{Fingerprint: fingerprint, Rule: rule.Name, State: models.AlertResolved}
+	}
+	e.groups[fingerprint] = group
+	return group
+}
+
+// fire moves a group into the firing state, notifying only on the transition
+func (e *AlertEngine) fire(group *alertGroup, now time.Time, summary string) {
+	alert := &group.alert
+	alert.Summary = summary
+	alert.Count = len(group.events)
+
+	// Saved by the next evaluation, so that a flood does not write the alert per message
+	if alert.State == models.AlertFiring {
+		group.dirty = true
+		return
+	}
+
+	alert.State = models.AlertFiring
+	alert.StartsAt = now
+	alert.EndsAt = time.Time{}
+
+	if e.silenced(group) {
+		e.save(group)
+		return
+	}
+
+	alert.LastNotifiedAt = now
+	e.save(group)
+	e.notify(group)
+}
+
+// resolve moves a firing group into the resolved state and notifies
+func (e *AlertEngine) resolve(group *alertGroup, now time.Time) {
+	alert := &group.alert
+	alert.State = models.AlertResolved
+	alert.EndsAt = now
+	alert.Count = len(group.events)
+	e.save(group)
+
+	if group.notified() {
+		e.notify(group)
+	}
+}
+
+// notified reports whether the group's current firing was notified; a firing
+// that started silenced was not, until the silence lapses
+func (g *alertGroup) notified() bool {
+	return !g.alert.LastNotifiedAt.IsZero() && !g.alert.LastNotifiedAt.Before(g.alert.StartsAt)
+}
+
+// repeat notifies a still-firing alert whose firing was silenced once the silence
+// lapses, and re-sends it after the rule's repeat interval, unless it was
+// acknowledged or is silenced
+func (e *AlertEngine) repeat(group *alertGroup, now time.Time) {
+	alert := &group.alert
+	interval := time.Duration(group.rule.RepeatInterval)
+	if alert.State != models.AlertFiring {
+		return
+	}
+	if group.notified() && (interval <= 0 || now.Sub(alert.LastNotifiedAt) < interval) {
+		return
+	}
+
+	acknowledged, err := e.store.IsAcknowledged(alert.Fingerprint, alert.StartsAt)
+	if err != nil {
+		log.Printf("Error checking acknowledgement for alert %s: %v", alert.Fingerprint, err)
+	}
+	if acknowledged || e.silenced(group) {
+		return
+	}
+
+	alert.LastNotifiedAt = now
+	e.save(group)
+	e.notify(group)
+}
+
+// silenced reports whether an active silence covers the group's most recent message or host
+func (e *AlertEngine) silenced(group *alertGroup) bool {
+	silences, err := e.store.GetActiveSilences()
+	if err != nil {
+		log.Printf("Error retrieving silences: %v", err)
+		return false
+	}
+	if group.last != nil {
+		return models.IsSilenced(silences, group.last.ClientIP, group.last.Content)
+	}
+	return models.IsSilenced(silences, group.alert.ClientIP, "")
+}
+
+func (e *AlertEngine) save(group *alertGroup) {
+	if err := e.store.SaveAlert(&group.alert); err != nil {
+		log.Printf("Error saving alert %s: %v", group.alert.Fingerprint, err)
+		return
+	}
+	group.dirty = false
+}
+
+// notify delivers the group's current state to the rule's notifiers in the background
+func (e *AlertEngine) notify(group *alertGroup) {
+	n := Notification{
+		Fingerprint: group.alert.Fingerprint,
+		Rule:        group.alert.Rule,
+		Group:       group.alert.HostGroup,
+		Host:        group.alert.ClientIP,
+		State:       group.alert.State,
+		Summary:     group.alert.Summary,
+		Count:       group.alert.Count,
+		Score:       group.score,
+		StartsAt:    group.alert.StartsAt,
+		EndsAt:      group.alert.EndsAt,
+		Log:         group.last,
+	}
+
+	for _, name := range group.rule.Notify {
+		notifier := e.notifiers[name]
+		go func(notifier Notifier) {
+			if err := notifier.Notify(n); err != nil {
+				log.Printf("Error delivering alert %s to %s: %v", n.Fingerprint, notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
+
+// pruneEvents drops event times older than window before now
+func pruneEvents(events []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	kept := events[:0]
+	for _, event := range events {
+		if event.After(cutoff) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// openTestDB opens a migrated database in a temporary directory, or in a schema of
+// its own in the PostgreSQL database named by HOSTLOG_TEST_POSTGRES_DSN
+func openTestDB(t *testing.T) *models.Store {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "logs.db")
+	if postgres := os.Getenv("HOSTLOG_TEST_POSTGRES_DSN"); postgres != "" {
+		dsn = testSchema(t, postgres)
+	}
+	store, err := models.OpenStore(dsn, false)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+	return store
+}
+
+// testSchema creates a schema that is dropped after the test and returns the DSN
+// that selects it
+func testSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "hostlog_test_" + hex.EncodeToString(suffix)
+
+	admin, err := models.OpenStorage(dsn, false)
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL storage: %v", err)
+	}
+	db := admin.DB()
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("Failed to create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// webhookStandIn records delivered notifications, failing the first failures requests
+func webhookStandIn(t *testing.T, failures int32) (*httptest.Server, chan Notification) {
+	t.Helper()
+	received := make(chan Notification, 10)
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Errorf("Webhook body is not valid JSON: %v: %s", err, body)
+		}
+		received <- n
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, received
+}
+
+func expectNotification(t *testing.T, received chan Notification, state string) Notification {
+	t.Helper()
+	select {
+	case n := <-received:
+		if n.State != state {
+			t.Fatalf("Expected %s notification, got %s", state, n.State)
+		}
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s notification", state)
+	}
+	return Notification{}
+}
+
+func expectNoNotification(t *testing.T, received chan Notification) {
+	t.Helper()
+	select {
+	case n := <-received:
+		t.Fatalf("Unexpected %s notification for %s", n.State, n.Fingerprint)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestAlertRateRule verifies firing, deduplication, resolution and webhook retries for a rate rule
+func TestAlertRateRule(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+	srv, received := webhookStandIn(t, 1)
+
+	retries := 2
+	engine, err := NewAlertEngine(store, AlertConfig{
+		Rules: []AlertRule{{
+			MessageFilter: MessageFilter{Content: "authentication failure"},
+			Name:          "auth-failures",
+			Threshold:     2,
+			Window:        Duration(5 * time.Minute),
+			Notify:        []string{"hook"},
+		}},
+		Webhooks: []WebhookConfig{{
+			Name:       "hook",
+			URL:        srv.URL,
+			MaxRetries: &retries,
+			Backoff:    Duration(time.Millisecond),
+		}},
+	}, &HostGroups{store: store})
+	if err != nil {
+		t.Fatalf("NewAlertEngine returned an error: %v", err)
+	}
+
+	start := time.Now()
+	observe := func(host, content string, offset time.Duration) {
+		l := models.Log{ClientIP: host, Content: content, Priority: 4, ReceivedAt: start.Add(offset)}
+		engine.Observe(l)
+	}
+
+	observe("192.168.1.1", "authentication failure for root", 0)
+	observe("192.168.1.1", "authentication failure for admin", time.Second)
+	observe("192.168.1.1", "link up", 2*time.Second)
+	expectNoNotification(t, received)
+
+	observe("192.168.1.1", "authentication failure for pi", 3*time.Second)
+	n := expectNotification(t, received, models.AlertFiring)
+	if n.Fingerprint != "auth-failures/192.168.1.1" || n.Count != 3 {
+		t.Errorf("Unexpected firing notification: %+v", n)
+	}
+
+	// Further matches on the same host are deduplicated, other hosts are grouped separately
+	observe("192.168.1.1", "authentication failure for guest", 4*time.Second)
+	observe("192.168.1.2", "authentication failure for root", 5*time.Second)
+	expectNoNotification(t, received)
+	if alert, err := store.GetAlert("auth-failures/192.168.1.1"); err != nil || alert.Count != 3 {
+		t.Errorf("Expected the count of a firing alert saved on evaluation, not per message, got %d, %v", alert.Count, err)
+	}
+
+	engine.Evaluate(start.Add(10 * time.Minute))
+	n = expectNotification(t, received, models.AlertResolved)
+	if n.Fingerprint != "auth-failures/192.168.1.1" {
+		t.Errorf("Unexpected resolved notification: %+v", n)
+	}
+
+	alert, err := store.GetAlert("auth-failures/192.168.1.1")
+	if err != nil {
+		t.Fatalf("Failed to load persisted alert: %v", err)
+	}
+	if alert.State != models.AlertResolved {
+		t.Errorf("Expected persisted alert to be resolved, got %s", alert.State)
+	}
+	if len(engine.groups) != 0 {
+		t.Errorf("Expected the quiet groups forgotten, got %d", len(engine.groups))
+	}
+
+	// A forgotten group starts over from its persisted state
+	for i := 0; i < 3; i++ {
+		observe("192.168.1.1", "authentication failure for root", 11*time.Minute+time.Duration(i)*time.Second)
+	}
+	n = expectNotification(t, received, models.AlertFiring)
+	if n.Fingerprint != "auth-failures/192.168.1.1" || n.Count != 3 {
+		t.Errorf("Unexpected firing notification: %+v", n)
+	}
+}
+
+// TestAlertSilence verifies that silenced alerts fire without notifying
+func TestAlertSilence(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+	srv, received := webhookStandIn(t, 0)
+
+	engine, err := NewAlertEngine(store, AlertConfig{
+		Rules: []AlertRule{{
+			MessageFilter: MessageFilter{Severity: new(int)},
+			Name:          "errors",
+			Notify:        []string{"hook"},
+		}},
+		Webhooks: []WebhookConfig{{Name: "hook", URL: srv.URL}},
+	}, &HostGroups{store: store})
+	if err != nil {
+		t.Fatalf("NewAlertEngine returned an error: %v", err)
+	}
+
+	silence := models.Silence{Pattern: "firmware", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.SaveSilence(&silence); err != nil {
+		t.Fatalf("Failed to save silence: %v", err)
+	}
+	if err := store.SaveSilence(&models.Silence{Pattern: "(", ExpiresAt: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("Expected a silence with an invalid pattern to be rejected")
+	}
+
+	engine.Observe(models.Log{ClientIP: "192.168.1.1", Content: "firmware panic", Priority: 0})
+	expectNoNotification(t, received)
+	engine.Evaluate(time.Now())
+	expectNoNotification(t, received)
+
+	engine.Observe(models.Log{ClientIP: "192.168.1.2", Content: "kernel panic", Priority: 0})
+	n := expectNotification(t, received, models.AlertFiring)
+	if n.Host != "192.168.1.2" {
+		t.Errorf("Unexpected firing notification: %+v", n)
+	}
+
+	// The silenced alert is notified once, when the silence lapses while it still fires
+	if err := store.DB.Model(&silence).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("Failed to expire silence: %v", err)
+	}
+	engine.Evaluate(time.Now())
+	n = expectNotification(t, received, models.AlertFiring)
+	if n.Host != "192.168.1.1" {
+		t.Errorf("Unexpected firing notification after the silence: %+v", n)
+	}
+	engine.Evaluate(time.Now())
+	expectNoNotification(t, received)
+}
+
+// TestAlertGroupRule verifies that rules can be limited to and grouped by host group
+func TestAlertGroupRule(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+	srv, received := webhookStandIn(t, 0)
+
+	hosts, err := NewHostGroups(store, []GroupConfig{{Name: "aps", Hostnames: []string{"ap-*"}}})
+	if err != nil {
+		t.Fatalf("NewHostGroups returned an error: %v", err)
+	}
+	engine, err := NewAlertEngine(store, AlertConfig{
+		Rules: []AlertRule{{
+			MessageFilter: MessageFilter{Content: "deauthenticated"},
+			Name:          "ap-deauth",
+			Groups:        []string{"aps"},
+			GroupBy:       []string{"group"},
+			Threshold:     1,
+			Notify:        []string{"hook"},
+		}},
+		Webhooks: []WebhookConfig{{Name: "hook", URL: srv.URL}},
+	}, hosts)
+	if err != nil {
+		t.Fatalf("NewAlertEngine returned an error: %v", err)
+	}
+
+	// Messages from different members are counted together, other hosts are ignored
+	engine.Observe(models.Log{ClientIP: "192.168.1.20", Hostname: "ap-kitchen", Content: "station deauthenticated"})
+	engine.Observe(models.Log{ClientIP: "192.168.1.30", Hostname: "laptop", Content: "station deauthenticated"})
+	expectNoNotification(t, received)
+
+	engine.Observe(models.Log{ClientIP: "192.168.1.21", Hostname: "ap-hall", Content: "station deauthenticated"})
+	n := expectNotification(t, received, models.AlertFiring)
+	if n.Fingerprint != "ap-deauth/group=aps" || n.Group != "aps" || n.Count != 2 {
+		t.Errorf("Unexpected firing notification: %+v", n)
+	}
+
+	if _, err := NewAlertEngine(store, AlertConfig{
+		Rules: []AlertRule{{Name: "unknown", Groups: []string{"missing"}}},
+	}, hosts); err == nil {
+		t.Error("Expected an error for a rule with an unknown host group")
+	}
+	if _, err := NewAlertEngine(store, AlertConfig{
+		Rules: []AlertRule{{Name: "unknown", Notify: []string{"missing"}}},
+	}, hosts); err == nil {
+		t.Error("Expected an error for a rule with an unknown notifier")
+	}
+}
+
+// TestWebhookTemplate verifies templated webhook bodies
+func TestWebhookTemplate(t *testing.T) {
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	notifier, err := NewWebhookNotifier(WebhookConfig{
+		Name: "chat",
+		URL:  srv.URL,
+		Body: `{"text": {{json (printf "%s is %s: %s" .Fingerprint .State .Summary)}}}`,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier returned an error: %v", err)
+	}
+
+	err = notifier.Notify(Notification{Fingerprint: "errors/10.0.0.1", State: "firing", Summary: `"quoted"`})
+	if err != nil {
+		t.Fatalf("Notify returned an error: %v", err)
+	}
+
+	expected := `{"text": "errors/10.0.0.1 is firing: \"quoted\""}`
+	if body := <-bodies; body != expected {
+		t.Errorf("Expected body %s, got %s", expected, body)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+
+	"hostlog/models"
+)
+
+// parseAuth recognizes a login success or failure: the events of the openwrt parser
+// named <service>.login or <service>.failure
+func parseAuth(l models.Log) (models.AuthEvent, bool) {
+	fields := make(map[string]string)
+	for _, pair := range parseOpenWrt(l) {
+		fields[pair[0]] = pair[1]
+	}
+	service, outcome, _ := strings.Cut(fields["event"], ".")
+	if outcome != "login" && outcome != "failure" {
+		return models.AuthEvent{}, false
+	}
+
+	return models.AuthEvent{
+		LogID:      l.ID,
+		HostID:     l.HostID,
+		ClientIP:   l.ClientIP,
+		ReceivedAt: l.ReceivedAt,
+		Service:    service,
+		Success:    outcome == "login",
+		Username:   fields["user"],
+		Src:        fields["src"],
+	}, true
+}
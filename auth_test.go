@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// TestBruteForce detects attacks by failure count and by user names tried, and raises the severity of the hosts involved
+func TestBruteForce(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	// login logs a message on the router, as the ingest loop would
+	login := func(tag, content string) {
+		t.Helper()
+		l, err := store.SaveLog(map[string]interface{}{
+			"client":    "192.168.1.1:514",
+			"tag":       tag,
+			"content":   content,
+			"priority":  38,
+			"timestamp": time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("SaveLog returned an error: %v", err)
+		}
+		event, ok := parseAuth(l)
+		if !ok {
+			t.Fatalf("Expected a login attempt from %q", content)
+		}
+		if err := store.SaveAuthEvent(&event); err != nil {
+			t.Fatalf("SaveAuthEvent returned an error: %v", err)
+		}
+	}
+
+	before, err := SeverityComponent(store, "192.168.1.1", 5)
+	if err != nil {
+		t.Fatalf("SeverityComponent returned an error: %v", err)
+	}
+
+	login("dropbear", "Password auth succeeded for 'root' from 192.168.1.20:50022")
+	for i := 0; i < 9; i++ {
+		login("dropbear", fmt.Sprintf("Bad password attempt for 'root' from 203.0.113.9:%d", 40000+i))
+	}
+	for _, user := range []string{"admin", "root", "ubnt", "pi", "guest"} {
+		login("luci", "failed login on / for "+user+" from 198.51.100.4")
+	}
+
+	if _, ok := parseAuth(models.Log{Tag: "dropbear", Content: "Child connection from 192.168.1.20:50022"}); ok {
+		t.Error("Expected no login attempt from a connection message")
+	}
+
+	// Nine failures stay below the default of ten, while five user names cross the default of five
+	attacks, err := store.GetBruteForce(time.Now())
+	if err != nil {
+		t.Fatalf("GetBruteForce returned an error: %v", err)
+	}
+	if len(attacks) != 1 || attacks[0].Src != "198.51.100.4" || attacks[0].Users != 5 || !attacks[0].BruteForce {
+		t.Errorf("Expected the password spraying from 198.51.100.4, got %+v", attacks)
+	}
+
+	login("dropbear", "Bad password attempt for 'root' from 203.0.113.9:40009")
+	if attacks, _ := store.GetBruteForce(time.Now()); len(attacks) != 2 || attacks[0].Src != "203.0.113.9" || attacks[0].Failures != 10 {
+		t.Errorf("Expected the tenth failure to raise an attack, got %+v", attacks)
+	}
+
+	summaries, err := store.GetAuthSummaries(models.AuthQuery{Since: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("GetAuthSummaries returned an error: %v", err)
+	}
+	if len(summaries) != 3 || summaries[2].Src != "192.168.1.20" || summaries[2].Successes != 1 || summaries[2].Failures != 0 {
+		t.Errorf("Expected the successful login last, got %+v", summaries)
+	}
+
+	for clientIP, want := range map[string]bool{"192.168.1.1": true, "203.0.113.9": true, "192.168.1.20": false} {
+		if involved, err := store.InBruteForce(clientIP, time.Now()); err != nil || involved != want {
+			t.Errorf("Expected InBruteForce(%s) to be %v, got %v, %v", clientIP, want, involved, err)
+		}
+	}
+
+	after, err := SeverityComponent(store, "192.168.1.1", 5)
+	if err != nil {
+		t.Fatalf("SeverityComponent returned an error: %v", err)
+	}
+	if after < before+50 {
+		t.Errorf("Expected the attack to raise the severity component from %.1f, got %.1f", before, after)
+	}
+
+	// Zero thresholds disable detection
+	zero := 0
+	if err := (AuthConfig{Failures: &zero, Users: &zero}).Apply(store); err != nil {
+		t.Fatalf("Apply returned an error: %v", err)
+	}
+	if attacks, _ := store.GetBruteForce(time.Now()); len(attacks) != 0 {
+		t.Errorf("Expected no attacks with detection disabled, got %+v", attacks)
+	}
+}
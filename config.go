@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hostlog/models"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Config holds the optional declarative configuration loaded from the JSON file named by HOSTLOG_CONFIG
+type Config struct {
+	Alerts     AlertConfig             `json:"alerts"`
+	Clock      ClockConfig             `json:"clock"`
+	Digest     DigestConfig            `json:"digest"`
+	Forwarders []ForwarderConfig       `json:"forwarders"`
+	Groups     []GroupConfig           `json:"groups"`
+	Neighbors  NeighborConfig          `json:"neighbors"`
+	Parsers    []ParserConfig          `json:"parsers"`
+	Auth       AuthConfig              `json:"auth"`
+	Redaction  RedactionConfig         `json:"redaction"`
+	Dedup      DedupConfig             `json:"dedup"`
+	RateLimit  RateLimitConfig         `json:"rate_limit"`
+	Listeners  map[string]SourceConfig `json:"listeners"` // Source lists of the udp and tcp listeners
+	ReverseDNS ReverseDNSConfig        `json:"reverse_dns"`
+	Retention  Duration                `json:"retention"` // Delete logs older than this; zero keeps everything
+}
+
+// ClockConfig chooses which log times scoring and time-windowed queries trust
+type ClockConfig struct {
+	Trust         string   `json:"trust"`          // received, device or auto (default)
+	SkewTolerance Duration `json:"skew_tolerance"` // How far a device clock may drift under auto; default 5m
+	Zone          string   `json:"zone"`           // IANA zone of device times, which RFC 3164 leaves out; default the local zone
+}
+
+// Apply sets the clock on the store
+func (c ClockConfig) Apply(store *models.Store) error {
+	clock, err := models.ParseClock(c.Trust)
+	if err != nil {
+		return err
+	}
+	store.Clock = clock
+	store.SkewTolerance = c.SkewTolerance.Or(models.DefaultSkewTolerance)
+	store.DeviceZone = nil
+	if c.Zone != "" {
+		zone, err := time.LoadLocation(c.Zone)
+		if err != nil {
+			return fmt.Errorf("clock zone: %w", err)
+		}
+		store.DeviceZone = zone
+	}
+	return nil
+}
+
+// AuthConfig sets when the login failures from one source to one host count as a
+// brute-force attack; a threshold left out uses the default and 0 disables it
+type AuthConfig struct {
+	Failures *int     `json:"failures"` // Failed logins within the window; default 10
+	Users    *int     `json:"users"`    // Distinct user names tried within the window; default 5
+	Window   Duration `json:"window"`   // default 10m
+}
+
+// Apply sets the brute-force thresholds on the store
+func (c AuthConfig) Apply(store *models.Store) error {
+	thresholds := models.DefaultBruteForce
+	if c.Failures != nil {
+		thresholds.Failures = *c.Failures
+	}
+	if c.Users != nil {
+		thresholds.Users = *c.Users
+	}
+	if thresholds.Failures < 0 || thresholds.Users < 0 {
+		return fmt.Errorf("brute-force thresholds must not be negative")
+	}
+	thresholds.Window = c.Window.Or(thresholds.Window)
+	store.BruteForce = thresholds
+	return nil
+}
+
+// DedupConfig sets how long a message a host sends again and again is counted on
+// one row instead of stored each time
+type DedupConfig struct {
+	Window *Duration `json:"window"` // default 1m; "0s" stores every message
+}
+
+// Apply sets the dedup window on the store
+func (c DedupConfig) Apply(store *models.Store) error {
+	store.DedupWindow = models.DefaultDedupWindow
+	if c.Window != nil {
+		if *c.Window < 0 {
+			return fmt.Errorf("dedup window must not be negative")
+		}
+		store.DedupWindow = time.Duration(*c.Window)
+	}
+	return nil
+}
+
+// RedactionConfig sets the secrets replaced in messages before they are stored,
+// and those only hidden from MCP clients
+type RedactionConfig struct {
+	Builtin []string        `json:"builtin"` // Built-in rules applied at ingest; default all but email and mac, [] for none
+	Rules   []RedactionRule `json:"rules"`   // Further rules applied at ingest
+	MCP     []RedactionRule `json:"mcp"`     // Rules applied only to MCP output
+}
+
+// RedactionRule replaces the matches of Pattern, or only its group named "secret".
+// A rule without a pattern uses the built-in rule of its name.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"` // default [REDACTED]
+}
+
+// Apply sets the ingest and MCP redactors on the store
+func (c RedactionConfig) Apply(store *models.Store) error {
+	builtin := c.Builtin
+	if builtin == nil {
+		builtin = models.DefaultRedactions
+	}
+	rules := make([]RedactionRule, 0, len(builtin)+len(c.Rules))
+	for _, name := range builtin {
+		rules = append(rules, RedactionRule{Name: name})
+	}
+	ingest, err := compileRedactions(append(rules, c.Rules...))
+	if err != nil {
+		return err
+	}
+	mcpRules, err := compileRedactions(c.MCP)
+	if err != nil {
+		return err
+	}
+	// MCP output also hides the secrets of logs stored before the ingest rules existed
+	output := append(slices.Clone(ingest), mcpRules...)
+	store.Redactor = models.NewRedactor(ingest)
+	store.MCPRedactor = models.NewRedactor(output)
+	return nil
+}
+
+// compileRedactions compiles the patterns of redaction rules
+func compileRedactions(rules []RedactionRule) ([]models.Redaction, error) {
+	redactions := make([]models.Redaction, 0, len(rules))
+	for _, rule := range rules {
+		pattern := rule.Pattern
+		if pattern == "" {
+			builtin, ok := models.BuiltinRedactions[rule.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown built-in redaction %q", rule.Name)
+			}
+			pattern = builtin
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("redaction rule %q has no name", pattern)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", rule.Name, err)
+		}
+		redactions = append(redactions, models.Redaction{Name: rule.Name, Pattern: re, Replacement: rule.Replacement})
+	}
+	return redactions, nil
+}
+
+// NeighborConfig names the router files that attach MAC addresses and names to hosts.
+// A list left out uses the OpenWrt location; an empty list reads nothing.
+type NeighborConfig struct {
+	Leases   []string `json:"leases"`   // dnsmasq lease files; default /tmp/dhcp.leases
+	Ethers   []string `json:"ethers"`   // default /etc/ethers
+	Hosts    []string `json:"hosts"`    // hosts-format files; default /etc/hosts and the odhcpd lease file /tmp/hosts/odhcpd
+	Interval Duration `json:"interval"` // How often the files are checked for changes; default 10s
+}
+
+// Apply loads the neighbor files into the store and watches them for changes
+func (c NeighborConfig) Apply(store *models.Store) error {
+	files := models.NeighborFiles{Leases: c.Leases, Ethers: c.Ethers, Hosts: c.Hosts}
+	if files.Leases == nil {
+		files.Leases = []string{"/tmp/dhcp.leases"}
+	}
+	if files.Ethers == nil {
+		files.Ethers = []string{"/etc/ethers"}
+	}
+	if files.Hosts == nil {
+		files.Hosts = []string{"/etc/hosts", "/tmp/hosts/odhcpd"}
+	}
+
+	neighbors := models.NewNeighbors(files)
+	if _, err := neighbors.Reload(); err != nil {
+		return err
+	}
+	store.Neighbors = neighbors
+	go neighbors.Watch(c.Interval.Or(10 * time.Second))
+	return nil
+}
+
+// LoadConfig reads the configuration file; an unset HOSTLOG_CONFIG yields an empty configuration
+func LoadConfig() (Config, error) {
+	var config Config
+
+	path := os.Getenv("HOSTLOG_CONFIG")
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := config.Digest.Validate(); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// Duration is a time.Duration written as a string such as "5m" in the configuration file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Or returns d, or fallback when d is not set
+func (d Duration) Or(fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return time.Duration(d)
+}
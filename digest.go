@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"hostlog/models"
+)
+
+// DigestConfig schedules a daily summary email
+type DigestConfig struct {
+	Email       string `json:"email"`        // Name of the email notifier to send through
+	At          string `json:"at"`           // Local time of day as HH:MM, default 08:00
+	TopHosts    int    `json:"top_hosts"`    // Number of top hosts to list, default 5
+	NewPatterns int    `json:"new_patterns"` // Number of new message patterns to list, default 20
+}
+
+// Validate checks the time of day the digest is sent at
+func (c DigestConfig) Validate() error {
+	if _, err := nextDigest(time.Now(), c.At); err != nil {
+		return fmt.Errorf("invalid digest time %q: %w", c.At, err)
+	}
+	return nil
+}
+
+// RunDigest sends the digest every day at the configured time; it never returns
+func RunDigest(store *models.Store, config DigestConfig, sender *EmailNotifier) {
+	for {
+		next, err := nextDigest(time.Now(), config.At)
+		if err != nil {
+			log.Printf("Invalid digest time %q: %v", config.At, err)
+			return
+		}
+		time.Sleep(time.Until(next))
+
+		if err := SendDigest(store, config, sender, next); err != nil {
+			log.Printf("Error sending daily digest: %v", err)
+		}
+	}
+}
+
+// SendDigest builds the digest for the 24 hours before now and emails it
+func SendDigest(store *models.Store, config DigestConfig, sender *EmailNotifier, now time.Time) error {
+	body, err := BuildDigest(store, config, now)
+	if err != nil {
+		return err
+	}
+	return sender.Send("[hostlog] Daily digest "+now.Format("2006-01-02"), body)
+}
+
+// BuildDigest summarizes top hosts, new message patterns and error counts for the 24 hours before now
+func BuildDigest(store *models.Store, config DigestConfig, now time.Time) (string, error) {
+	topHosts := config.TopHosts
+	if topHosts <= 0 {
+		topHosts = 5
+	}
+	newPatterns := config.NewPatterns
+	if newPatterns <= 0 {
+		newPatterns = 20
+	}
+	since := now.Add(-24 * time.Hour)
+
+	hostScores, err := GetAllHostScores(store)
+	if err != nil {
+		return "", err
+	}
+	patterns, err := store.GetNewPatterns(since)
+	if err != nil {
+		return "", err
+	}
+	errorCounts, err := store.GetErrorCounts(since)
+	if err != nil {
+		return "", err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hostlog digest for %s - %s\n\n",
+		since.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04"))
+
+	body.WriteString("Top hosts\n")
+	for _, hs := range GetTopHostScores(hostScores, topHosts) {
+		fmt.Fprintf(&body, "- %s: %.2f\n", hs.Host, hs.Score)
+	}
+	if len(hostScores) == 0 {
+		body.WriteString("No hosts.\n")
+	}
+
+	body.WriteString("\nErrors per host\n")
+	hosts := make([]string, 0, len(errorCounts))
+	for host := range errorCounts {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return errorCounts[hosts[i]] > errorCounts[hosts[j]]
+	})
+	for _, host := range hosts {
+		fmt.Fprintf(&body, "- %s: %d\n", host, errorCounts[host])
+	}
+	if len(hosts) == 0 {
+		body.WriteString("No errors.\n")
+	}
+
+	body.WriteString("\nNew message patterns\n")
+	for i, p := range patterns {
+		if i == newPatterns {
+			fmt.Fprintf(&body, "... and %d more\n", len(patterns)-newPatterns)
+			break
+		}
+		fmt.Fprintf(&body, "- %s (%dx): %s\n", p.ClientIP, p.Count, p.Example)
+	}
+	if len(patterns) == 0 {
+		body.WriteString("No new patterns.\n")
+	}
+
+	return body.String(), nil
+}
+
+// nextDigest returns the first occurrence of the HH:MM time of day after now
+func nextDigest(now time.Time, at string) (time.Time, error) {
+	if at == "" {
+		at = "08:00"
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"hostlog/models"
+)
+
+// Free space below which doctor fails or warns
+const (
+	doctorMinFree  = 10 << 20
+	doctorWarnFree = 100 << 20
+)
+
+// doctor checks the environment hostlog runs in and reports each check on one line
+type doctor struct {
+	w      io.Writer
+	failed bool
+}
+
+func (d *doctor) ok(name, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "ok    %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(name, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "warn  %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(name, format string, args ...interface{}) {
+	d.failed = true
+	fmt.Fprintf(d.w, "FAIL  %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+// runDoctor checks the configuration, ports, database, disk space and
+// permissions, and reports whether all passed
+func runDoctor(w io.Writer) bool {
+	d := &doctor{w: w}
+
+	if _, err := LoadConfig(); err != nil {
+		d.fail("config", "%v", err)
+	} else if path := os.Getenv("HOSTLOG_CONFIG"); path != "" {
+		d.ok("config", "%s", path)
+	} else {
+		d.ok("config", "none, using defaults")
+	}
+
+	syslogPort := os.Getenv("HOSTLOG_SYSLOG_PORT")
+	if syslogPort == "" {
+		syslogPort = "514"
+	}
+	d.checkPort(ListenerUDP, syslogPort)
+	d.checkPort(ListenerTCP, syslogPort)
+	httpPort := os.Getenv("HOSTLOG_HTTP_PORT")
+	if httpPort == "" {
+		httpPort = "8080"
+	}
+	d.checkPort("http", httpPort)
+
+	dataDir := models.DataDirFromEnv()
+	d.checkDirectory(dataDir)
+	d.checkDatabase()
+	d.checkDiskSpace(dataDir)
+
+	return !d.failed
+}
+
+// checkPort tries to bind the port the way the daemon does
+func (d *doctor) checkPort(listener, port string) {
+	name := "port " + listener + "/" + port
+	address := "0.0.0.0:" + port
+
+	var closer io.Closer
+	var err error
+	if listener == ListenerUDP {
+		closer, err = net.ListenPacket("udp", address)
+	} else {
+		closer, err = net.Listen("tcp", address)
+	}
+	switch {
+	case err == nil:
+		closer.Close()
+		d.ok(name, "free")
+	case errors.Is(err, syscall.EADDRINUSE):
+		d.warn(name, "in use, by a running hostlog or another program")
+	default:
+		d.fail(name, "%v", err)
+	}
+}
+
+// checkDirectory checks that files can be created next to the database
+func (d *doctor) checkDirectory(dataDir string) {
+	file, err := os.CreateTemp(dataDir, ".hostlog-doctor-*")
+	if err != nil {
+		d.fail("data directory", "%v", err)
+		return
+	}
+	file.Close()
+	os.Remove(file.Name())
+	d.ok("data directory", "%s is writable", dataDir)
+}
+
+// checkDatabase opens the database without migrating it and checks that it can
+// be written and is intact
+func (d *doctor) checkDatabase() {
+	path := models.DSNFromEnv()
+	if !models.IsPostgresDSN(path) {
+		// Opening a missing SQLite file would create it
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			d.warn("database", "%s does not exist yet and is created on first start", path)
+			return
+		}
+		for _, file := range []string{path, path + "-wal", path + "-shm"} {
+			if f, err := os.OpenFile(file, os.O_RDWR, 0); err == nil {
+				f.Close()
+			} else if !errors.Is(err, os.ErrNotExist) {
+				d.fail("database", "%v", err)
+				return
+			}
+		}
+	}
+
+	store, err := models.OpenStore(path, false)
+	if err != nil {
+		d.fail("database", "%v", err)
+		return
+	}
+	defer store.Close()
+
+	if err := store.CheckWritable(); err != nil {
+		d.fail("database", "%s is not writable: %v", store.Path, err)
+		return
+	}
+	d.ok("database", "%s is writable", store.Path)
+
+	problems, err := store.Backend.CheckIntegrity()
+	switch {
+	case err != nil:
+		d.fail("integrity", "%v", err)
+	case len(problems) > 0:
+		d.fail("integrity", "%s", strings.Join(problems, "; "))
+	default:
+		d.ok("integrity", "no problems found")
+	}
+}
+
+// checkDiskSpace checks the free space of the data directory
+func (d *doctor) checkDiskSpace(dataDir string) {
+	free, err := diskFree(dataDir)
+	if err != nil {
+		d.warn("disk space", "%v", err)
+		return
+	}
+	detail := fmt.Sprintf("%s free in %s", formatBytes(free), filepath.Clean(dataDir))
+	switch {
+	case free < doctorMinFree:
+		d.fail("disk space", "%s", detail)
+	case free < doctorWarnFree:
+		d.warn("disk space", "%s", detail)
+	default:
+		d.ok("disk space", "%s", detail)
+	}
+}
+
+// formatBytes formats a size in binary units
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig configures delivery of alert notifications and digests over SMTP
+type EmailConfig struct {
+	Name     string   `json:"name"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	StartTLS bool     `json:"starttls"` // Require STARTTLS; otherwise it is used when the server offers it
+	Insecure bool     `json:"insecure_skip_verify"`
+}
+
+// emailTimeout bounds connecting to the SMTP server and the whole delivery after it
+const emailTimeout = 30 * time.Second
+
+// EmailNotifier sends alert notifications as plain-text email
+type EmailNotifier struct {
+	config  EmailConfig
+	timeout time.Duration
+}
+
+// NewEmailNotifier validates the SMTP configuration
+func NewEmailNotifier(config EmailConfig) (*EmailNotifier, error) {
+	if config.Name == "" || config.Host == "" {
+		return nil, fmt.Errorf("email notifier requires a name and a host")
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email notifier %s requires from and to addresses", config.Name)
+	}
+	if config.Port == 0 {
+		config.Port = 25
+	}
+	return &EmailNotifier{config: config, timeout: emailTimeout}, nil
+}
+
+func (e *EmailNotifier) Name() string {
+	return e.config.Name
+}
+
+// Notify sends one email per alert state change
+func (e *EmailNotifier) Notify(n Notification) error {
+	subject := fmt.Sprintf("[hostlog] %s %s", strings.ToUpper(n.State), n.Fingerprint)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Alert:   %s\n", n.Fingerprint)
+	fmt.Fprintf(&body, "State:   %s\n", n.State)
+	if n.Group != "" {
+		fmt.Fprintf(&body, "Group:   %s\n", n.Group)
+	}
+	if n.Host != "" {
+		fmt.Fprintf(&body, "Host:    %s\n", n.Host)
+	}
+	fmt.Fprintf(&body, "Summary: %s\n", n.Summary)
+	fmt.Fprintf(&body, "Started: %s\n", n.StartsAt.Format("2006-01-02 15:04:05"))
+	if !n.EndsAt.IsZero() {
+		fmt.Fprintf(&body, "Ended:   %s\n", n.EndsAt.Format("2006-01-02 15:04:05"))
+	}
+	if n.Log != nil {
+		severity, _ := getSeverityInfo(n.Log.Priority)
+		fmt.Fprintf(&body, "\nLast message:\n[%s] %s [%s]: %s\n",
+			n.Log.ReceivedAt.Format("2006-01-02 15:04:05"),
+			n.Log.ClientIP,
+			severity,
+			n.Log.Content)
+	}
+
+	return e.Send(subject, body.String())
+}
+
+// Send delivers a plain-text message to the configured recipients
+func (e *EmailNotifier) Send(subject, body string) error {
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	conn, err := net.DialTimeout("tcp", addr, e.timeout)
+	if err != nil {
+		return err
+	}
+	// An unresponsive server fails the delivery instead of hanging it
+	conn.SetDeadline(time.Now().Add(e.timeout))
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{ServerName: e.config.Host, InsecureSkipVerify: e.config.Insecure}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	} else if e.config.StartTLS {
+		return fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+	}
+
+	if e.config.Username != "" {
+		auth := smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.config.From); err != nil {
+		return err
+	}
+	for _, to := range e.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.message(subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (e *EmailNotifier) message(subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes()
+}
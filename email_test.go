@@ -0,0 +1,288 @@
+package main
+
+import (
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// smtpMessage is one message accepted by the SMTP stand-in
+type smtpMessage struct {
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// smtpStandIn starts a minimal plaintext SMTP server on localhost that records delivered messages
+func smtpStandIn(t *testing.T) (string, int, chan smtpMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return "127.0.0.1", addr.Port, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan smtpMessage) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			msg.Auth = arg
+			tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			msg.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			tp.PrintfLine("250 OK")
+			messages <- msg
+			msg = smtpMessage{}
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func expectMessage(t *testing.T, messages chan smtpMessage) smtpMessage {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for email")
+	}
+	return smtpMessage{}
+}
+
+// TestEmailNotifier verifies alert emails against the SMTP stand-in
+func TestEmailNotifier(t *testing.T) {
+	host, port, messages := smtpStandIn(t)
+
+	notifier, err := NewEmailNotifier(EmailConfig{
+		Name:     "office",
+		Host:     host,
+		Port:     port,
+		Username: "hostlog",
+		Password: "secret",
+		From:     "hostlog@example.com",
+		To:       []string{"admin@example.com", "ops@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmailNotifier returned an error: %v", err)
+	}
+
+	err = notifier.Notify(Notification{
+		Fingerprint: "auth-failures/192.168.1.1",
+		State:       models.AlertFiring,
+		Host:        "192.168.1.1",
+		Summary:     "21 matching messages in 5m0s",
+		StartsAt:    time.Now(),
+		Log:         &models.Log{ClientIP: "192.168.1.1", Content: "Bad password attempt for 'root'", Priority: 4},
+	})
+	if err != nil {
+		t.Fatalf("Notify returned an error: %v", err)
+	}
+
+	msg := expectMessage(t, messages)
+	if msg.Auth == "" {
+		t.Error("Expected the notifier to authenticate")
+	}
+	if msg.From != "hostlog@example.com" || len(msg.To) != 2 {
+		t.Errorf("Unexpected envelope: from %s to %v", msg.From, msg.To)
+	}
+	for _, expected := range []string{
+		"Subject: [hostlog] FIRING auth-failures/192.168.1.1",
+		"Bad password attempt for 'root'",
+	} {
+		if !strings.Contains(msg.Data, expected) {
+			t.Errorf("Expected email to contain %q, got:\n%s", expected, msg.Data)
+		}
+	}
+}
+
+// TestEmailRequireStartTLS verifies that a required STARTTLS is not silently skipped
+func TestEmailRequireStartTLS(t *testing.T) {
+	host, port, _ := smtpStandIn(t)
+
+	notifier, err := NewEmailNotifier(EmailConfig{
+		Name:     "office",
+		Host:     host,
+		Port:     port,
+		From:     "hostlog@example.com",
+		To:       []string{"admin@example.com"},
+		StartTLS: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEmailNotifier returned an error: %v", err)
+	}
+
+	if err := notifier.Send("test", "body"); err == nil {
+		t.Error("Expected sending without STARTTLS support to fail")
+	}
+}
+
+// TestEmailTimeout verifies that a server that never answers fails the delivery instead of hanging it
+func TestEmailTimeout(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept connections and never greet them
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	notifier, err := NewEmailNotifier(EmailConfig{
+		Name: "office",
+		Host: "127.0.0.1",
+		Port: listener.Addr().(*net.TCPAddr).Port,
+		From: "hostlog@example.com",
+		To:   []string{"admin@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmailNotifier returned an error: %v", err)
+	}
+	notifier.timeout = 100 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() { done <- notifier.Send("test", "body") }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected sending to an unresponsive server to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Send to give up on an unresponsive server")
+	}
+}
+
+// TestDailyDigest verifies the digest content sent through the SMTP stand-in
+func TestDailyDigest(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+	host, port, messages := smtpStandIn(t)
+
+	now := time.Now()
+	for i, content := range []string{
+		"kernel: link down on port 3",
+		"kernel: link down on port 4",
+		"dropbear[1234]: Bad password attempt for 'root' from 10.0.0.5:51234",
+	} {
+		l := models.Log{ClientIP: "192.168.1.1", Content: content, Priority: 2, ReceivedAt: now}
+		if err := store.DB.Create(&l).Error; err != nil {
+			t.Fatalf("Failed to create log: %v", err)
+		}
+		if err := store.SaveLogPattern(l.ClientIP, l.Content, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("SaveLogPattern returned an error: %v", err)
+		}
+	}
+
+	sender, err := NewEmailNotifier(EmailConfig{
+		Name: "office",
+		Host: host,
+		Port: port,
+		From: "hostlog@example.com",
+		To:   []string{"admin@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmailNotifier returned an error: %v", err)
+	}
+
+	if err := SendDigest(store, DigestConfig{Email: "office"}, sender, now.Add(time.Minute)); err != nil {
+		t.Fatalf("SendDigest returned an error: %v", err)
+	}
+
+	msg := expectMessage(t, messages)
+	for _, expected := range []string{
+		"Top hosts\n- 192.168.1.1:",
+		"Errors per host\n- 192.168.1.1: 3",
+		"- 192.168.1.1 (2x): kernel: link down on port 3",
+		"- 192.168.1.1 (1x): dropbear[1234]",
+	} {
+		if !strings.Contains(msg.Data, expected) {
+			t.Errorf("Expected digest to contain %q, got:\n%s", expected, msg.Data)
+		}
+	}
+}
+
+// TestNextDigest verifies scheduling of the daily digest
+func TestNextDigest(t *testing.T) {
+	now := time.Date(2025, 6, 1, 9, 30, 0, 0, time.Local)
+
+	for at, expected := range map[string]time.Time{
+		"08:00": time.Date(2025, 6, 2, 8, 0, 0, 0, time.Local),
+		"18:15": time.Date(2025, 6, 1, 18, 15, 0, 0, time.Local),
+		"":      time.Date(2025, 6, 2, 8, 0, 0, 0, time.Local),
+	} {
+		next, err := nextDigest(now, at)
+		if err != nil {
+			t.Fatalf("nextDigest(%q) returned an error: %v", at, err)
+		}
+		if !next.Equal(expected) {
+			t.Errorf("nextDigest(%q) = %s, expected %s", at, next, expected)
+		}
+	}
+
+	// An invalid time fails loading the configuration instead of silently disabling the digest
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"digest": {"email": "office", "at": "8am"}}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("HOSTLOG_CONFIG", path)
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid digest time") {
+		t.Errorf("Expected an invalid digest time rejected, got %v", err)
+	}
+}
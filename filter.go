@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"hostlog/models"
+)
+
+// MessageFilter selects messages by host, severity, facility, program and content
+type MessageFilter struct {
+	Hosts      []string `json:"hosts"`      // Client IPs to match; empty matches all hosts
+	Severity   *int     `json:"severity"`   // Match this syslog severity or anything more severe
+	Facilities []int    `json:"facilities"` // Syslog facilities to match; empty matches all
+	Programs   []string `json:"programs"`   // Syslog tags such as "dropbear" to match; empty matches all
+	Content    string   `json:"content"`    // Regular expression matched against message content
+
+	content *regexp.Regexp
+}
+
+// Compile prepares the content pattern; it must be called before Matches
+func (f *MessageFilter) Compile() error {
+	if f.Content == "" {
+		return nil
+	}
+	re, err := regexp.Compile(f.Content)
+	if err != nil {
+		return err
+	}
+	f.content = re
+	return nil
+}
+
+// Matches reports whether a message satisfies every configured condition
+func (f *MessageFilter) Matches(l models.Log) bool {
+	if len(f.Hosts) > 0 && !slices.Contains(f.Hosts, l.ClientIP) {
+		return false
+	}
+	if f.Severity != nil && l.Priority&7 > *f.Severity {
+		return false
+	}
+	if len(f.Facilities) > 0 && !slices.Contains(f.Facilities, l.Priority>>3) {
+		return false
+	}
+	if len(f.Programs) > 0 && !slices.Contains(f.Programs, program(l.Tag)) {
+		return false
+	}
+	if f.content != nil && !f.content.MatchString(l.Content) {
+		return false
+	}
+	return true
+}
+
+// program strips the process ID from a syslog tag such as "dropbear[1234]"
+func program(tag string) string {
+	name, _, _ := strings.Cut(tag, "[")
+	return strings.TrimSuffix(name, ":")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"hostlog/models"
+)
+
+// firewallWindow is the period the firewall views cover
+const firewallWindow = 24 * time.Hour
+
+// kernelStamp is the uptime the kernel puts before its messages
+var kernelStamp = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s*`)
+
+// parseNetfilter recognizes a kernel netfilter log line: the prefix of the logging
+// rule, such as "drop wan in:" or "DROP(src wan)", followed by IN= OUT= ... SRC=
+// DST= ... PROTO= and, for TCP and UDP, SPT= and DPT=
+func parseNetfilter(l models.Log) (models.FirewallEvent, bool) {
+	if name := program(l.Tag); name != "" && name != "kernel" {
+		return models.FirewallEvent{}, false
+	}
+	start := strings.Index(l.Content, "IN=")
+	// fw3 puts the prefix right before IN=, without a space
+	if start < 0 || (start > 0 && !strings.ContainsRune(" :)", rune(l.Content[start-1]))) || !strings.Contains(l.Content[start:], " SRC=") {
+		return models.FirewallEvent{}, false
+	}
+
+	values := make(map[string]string)
+	for _, pair := range parseKV(l.Content[start:]) {
+		values[pair[0]] = pair[1]
+	}
+	if values["PROTO"] == "" {
+		return models.FirewallEvent{}, false
+	}
+
+	prefix := strings.TrimSpace(kernelStamp.ReplaceAllString(l.Content[:start], ""))
+	prefix = strings.TrimSpace(strings.TrimSuffix(prefix, ":"))
+	event := models.FirewallEvent{
+		LogID:      l.ID,
+		HostID:     l.HostID,
+		ReceivedAt: l.ReceivedAt,
+		Action:     firewallAction(prefix),
+		Prefix:     prefix,
+		In:         values["IN"],
+		Out:        values["OUT"],
+		Src:        values["SRC"],
+		Dst:        values["DST"],
+		Proto:      strings.ToLower(values["PROTO"]),
+	}
+	event.SrcPort, _ = strconv.Atoi(values["SPT"])
+	event.DstPort, _ = strconv.Atoi(values["DPT"])
+	return event, true
+}
+
+// firewallAction tells the action of the logging rule from its prefix; fw4 and fw3
+// name it there, other rules are reported as "log"
+func firewallAction(prefix string) string {
+	prefix = strings.ToLower(prefix)
+	for _, action := range []string{"reject", "drop", "accept"} {
+		if strings.Contains(prefix, action) {
+			return action
+		}
+	}
+	return "log"
+}
+
+// parseFirewall extracts the fields of a netfilter log line
+func parseFirewall(l models.Log) [][2]string {
+	event, ok := parseNetfilter(l)
+	if !ok {
+		return nil
+	}
+
+	var pairs [][2]string
+	for _, pair := range [][2]string{
+		{"event", "firewall"},
+		{"action", event.Action},
+		{"prefix", event.Prefix},
+		{"in", event.In},
+		{"out", event.Out},
+		{"src", event.Src},
+		{"dst", event.Dst},
+		{"proto", event.Proto},
+		{"spt", formatPort(event.SrcPort)},
+		{"dpt", formatPort(event.DstPort)},
+	} {
+		if pair[1] != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// formatPort formats a port number, or "" for packets without ports
+func formatPort(number int) string {
+	if number == 0 {
+		return ""
+	}
+	return strconv.Itoa(number)
+}
+
+// formatPacket summarizes a logged packet, such as "TCP 203.0.113.9:51234 → 192.168.1.1:22 in eth1"
+func formatPacket(e models.FirewallEvent) string {
+	endpoint := func(address string, port int) string {
+		if port == 0 {
+			return address
+		}
+		if strings.Contains(address, ":") {
+			return fmt.Sprintf("[%s]:%d", address, port)
+		}
+		return fmt.Sprintf("%s:%d", address, port)
+	}
+
+	text := fmt.Sprintf("%s %s → %s", strings.ToUpper(e.Proto), endpoint(e.Src, e.SrcPort), endpoint(e.Dst, e.DstPort))
+	if e.In != "" {
+		text += " in " + e.In
+	}
+	if e.Out != "" {
+		text += " out " + e.Out
+	}
+	return text
+}
+
+// dropRateSeries spreads the drop rates of each router over the buckets from since
+// to now, including the empty ones
+func dropRateSeries(rates []models.DropRate, since, now time.Time, interval time.Duration) map[uint][]int64 {
+	// Buckets start at multiples of the interval since the Unix epoch, as in the database
+	seconds := int64(interval.Seconds())
+	start := time.Unix(since.Unix()/seconds*seconds, 0)
+	buckets := int(now.Sub(start)/interval) + 1
+
+	series := make(map[uint][]int64)
+	for _, rate := range rates {
+		if series[rate.HostID] == nil {
+			series[rate.HostID] = make([]int64, buckets)
+		}
+		if i := int(rate.Bucket.Sub(start) / interval); i >= 0 && i < buckets {
+			series[rate.HostID][i] += rate.Count
+		}
+	}
+	return series
+}
+
+// sparkBars are the levels of a sparkline, from none to the peak
+var sparkBars = []rune(" ▁▂▃▄▅▆▇█")
+
+// sparkline draws counts as a line of bars scaled to the highest count
+func sparkline(counts []int64) string {
+	peak := slices.Max(append([]int64{0}, counts...))
+	bars := make([]rune, 0, len(counts))
+	for _, count := range counts {
+		level := 0
+		if count > 0 {
+			level = 1 + int(count*int64(len(sparkBars)-2)/peak)
+		}
+		bars = append(bars, sparkBars[level])
+	}
+	return string(bars)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// TestParseNetfilter recognizes fw4 and fw3 log lines and leaves other messages alone
+func TestParseNetfilter(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		tag, content string
+		want         string // formatPacket of the event, or "" when it is not a firewall line
+		action       string
+	}{
+		{"kernel", "[ 9123.456789] drop wan in: IN=eth1 OUT= MAC=00:11:22:33:44:55:66:77:88:99:aa:bb:08:00 SRC=203.0.113.9 DST=192.168.1.1 LEN=60 TOS=0x00 PREC=0x00 TTL=50 ID=4242 DF PROTO=TCP SPT=51234 DPT=22 WINDOW=64240 RES=0x00 SYN URGP=0",
+			"TCP 203.0.113.9:51234 → 192.168.1.1:22 in eth1", "drop"},
+		{"kernel", "REJECT(src lan)IN=br-lan OUT=eth1 SRC=192.168.1.20 DST=198.51.100.7 LEN=84 PROTO=ICMP TYPE=8 CODE=0 ID=1 SEQ=1",
+			"ICMP 192.168.1.20 → 198.51.100.7 in br-lan out eth1", ""},
+		{"", "accept lan forward: IN=br-lan OUT=eth1 SRC=2001:db8::20 DST=2001:db8:1::1 LEN=80 PROTO=UDP SPT=5353 DPT=53",
+			"UDP [2001:db8::20]:5353 → [2001:db8:1::1]:53 in br-lan out eth1", "accept"},
+		{"kernel", "[ 12.3] eth0: link up", "", ""},
+		{"kernel", "LOGIN=root SRC=1.2.3.4 PROTO=TCP", "", ""},
+		{"dropbear", "drop IN=eth1 OUT= SRC=203.0.113.9 DST=192.168.1.1 PROTO=TCP SPT=1 DPT=2", "", ""},
+	} {
+		event, ok := parseNetfilter(models.Log{Tag: test.tag, Content: test.content})
+		got := ""
+		if ok {
+			got = formatPacket(event)
+		}
+		if got != test.want {
+			t.Errorf("Expected %q from %q, got %q", test.want, test.content, got)
+		}
+		if test.action != "" && event.Action != test.action {
+			t.Errorf("Expected action %s from %q, got %s", test.action, test.content, event.Action)
+		}
+	}
+}
+
+// TestFirewallAnalytics counts the blocked packets of a scan by source, port and router
+func TestFirewallAnalytics(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	now := time.Now()
+	var routers []uint
+	for _, clientIP := range []string{"192.168.1.1", "192.168.2.1"} {
+		id, err := store.ResolveHost(clientIP, "", now)
+		if err != nil {
+			t.Fatalf("ResolveHost returned an error: %v", err)
+		}
+		routers = append(routers, id)
+	}
+
+	record := func(router uint, age time.Duration, content string) {
+		t.Helper()
+		event, ok := parseNetfilter(models.Log{Tag: "kernel", HostID: router, ReceivedAt: now.Add(-age), Content: content})
+		if !ok {
+			t.Fatalf("Expected a firewall event from %q", content)
+		}
+		if err := store.SaveFirewallEvent(&event); err != nil {
+			t.Fatalf("SaveFirewallEvent returned an error: %v", err)
+		}
+	}
+	// A scan of 25 ports from one source, a few knocks on SSH and traffic let through
+	for port := 1; port <= 25; port++ {
+		record(routers[0], 30*time.Minute, fmt.Sprintf("drop wan in: IN=eth1 OUT= SRC=203.0.113.9 DST=192.168.1.1 PROTO=TCP SPT=40000 DPT=%d", port))
+	}
+	for i := 0; i < 3; i++ {
+		record(routers[1], 3*time.Hour, "reject wan in: IN=eth1 OUT= SRC=198.51.100.4 DST=192.168.2.1 PROTO=TCP SPT=40001 DPT=22")
+	}
+	record(routers[0], time.Hour, "accept lan forward: IN=br-lan OUT=eth1 SRC=192.168.1.20 DST=198.51.100.7 PROTO=UDP SPT=5353 DPT=53")
+	record(routers[0], 48*time.Hour, "drop wan in: IN=eth1 OUT= SRC=192.0.2.99 DST=192.168.1.1 PROTO=TCP SPT=1 DPT=23")
+
+	query := models.FirewallQuery{Since: now.Add(-firewallWindow), Limit: 10}
+	sources, err := store.TopBlockedSources(query)
+	if err != nil {
+		t.Fatalf("TopBlockedSources returned an error: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Src != "203.0.113.9" || sources[0].Count != 25 || sources[0].Ports != 25 ||
+		sources[1].Src != "198.51.100.4" || sources[1].Ports != 1 || sources[0].Last.IsZero() {
+		t.Errorf("Expected the scanner before the SSH knocks, got %+v", sources)
+	}
+
+	ports, err := store.TopBlockedPorts(query)
+	if err != nil {
+		t.Fatalf("TopBlockedPorts returned an error: %v", err)
+	}
+	if len(ports) != 10 || ports[0].Proto != "tcp" || ports[0].DstPort != 22 || ports[0].Count != 4 || ports[0].Sources != 2 {
+		t.Errorf("Expected SSH as the top port, got %+v", ports)
+	}
+
+	query.HostIDs = routers[1:]
+	rates, err := store.GetDropRates(query, time.Hour)
+	if err != nil {
+		t.Fatalf("GetDropRates returned an error: %v", err)
+	}
+	if len(rates) != 1 || rates[0].HostID != routers[1] || rates[0].Count != 3 {
+		t.Errorf("Expected one bucket of the second router, got %+v", rates)
+	}
+
+	series := dropRateSeries(rates, query.Since, now, time.Hour)[routers[1]]
+	if len(series) < 24 || series[len(series)-4] != 3 {
+		t.Errorf("Expected the packets three hours back, got %v", series)
+	}
+	if line := sparkline([]int64{0, 1, 8}); line != " ▁█" {
+		t.Errorf("Expected a scaled sparkline, got %q", line)
+	}
+}
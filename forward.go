@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hostlog/models"
+)
+
+// ForwarderConfig relays a filtered subset of stored messages to an upstream syslog collector
+type ForwarderConfig struct {
+	MessageFilter
+	Name          string `json:"name"`
+	Protocol      string `json:"protocol"` // udp, tcp or tls
+	Address       string `json:"address"`
+	Format        string `json:"format"`    // rfc3164 or rfc5424
+	QueueDir      string `json:"queue_dir"` // Defaults to a directory next to the database
+	MaxQueueBytes int64  `json:"max_queue_bytes"`
+	CAFile        string `json:"ca_file"`
+	Insecure      bool   `json:"insecure_skip_verify"`
+}
+
+// forwardMaxUDP is the longest message sent over UDP; longer ones are cut, as a
+// datagram over the limit of the socket or the collector would never be delivered
+const forwardMaxUDP = 8192
+
+// Forwarder queues matching messages on disk and delivers them to its upstream in order
+type Forwarder struct {
+	config ForwarderConfig
+	queue  *diskQueue
+	conn   net.Conn
+	tls    *tls.Config
+}
+
+// Forwarders fans stored messages out to every configured forwarder
+type Forwarders []*Forwarder
+
+// NewForwarders opens the queues of all configured forwarders and starts delivering.
+// Queues without a configured directory are kept under dataDir.
+func NewForwarders(configs []ForwarderConfig, dataDir string) (Forwarders, error) {
+	var forwarders Forwarders
+	for _, config := range configs {
+		forwarder, err := NewForwarder(config, dataDir)
+		if err != nil {
+			return nil, err
+		}
+		go forwarder.Run()
+		forwarders = append(forwarders, forwarder)
+	}
+	return forwarders, nil
+}
+
+// Forward queues a message for every forwarder whose filter matches
+func (fs Forwarders) Forward(l models.Log) {
+	for _, f := range fs {
+		if err := f.Enqueue(l); err != nil {
+			log.Printf("Error queueing log for forwarder %s: %v", f.config.Name, err)
+		}
+	}
+}
+
+// NewForwarder validates the configuration and opens the forwarder's queue
+func NewForwarder(config ForwarderConfig, dataDir string) (*Forwarder, error) {
+	if config.Name == "" || config.Address == "" {
+		return nil, fmt.Errorf("forwarder requires a name and an address")
+	}
+	if config.Protocol == "" {
+		config.Protocol = "udp"
+	}
+	if config.Protocol != "udp" && config.Protocol != "tcp" && config.Protocol != "tls" {
+		return nil, fmt.Errorf("forwarder %s: unknown protocol %s", config.Name, config.Protocol)
+	}
+	if config.Format == "" {
+		config.Format = "rfc3164"
+	}
+	if config.Format != "rfc3164" && config.Format != "rfc5424" {
+		return nil, fmt.Errorf("forwarder %s: unknown format %s", config.Name, config.Format)
+	}
+	if config.QueueDir == "" {
+		config.QueueDir = filepath.Join(dataDir, "forward", config.Name)
+	}
+	if config.MaxQueueBytes == 0 {
+		config.MaxQueueBytes = 100 << 20
+	}
+	if err := config.Compile(); err != nil {
+		return nil, fmt.Errorf("forwarder %s: %w", config.Name, err)
+	}
+
+	f := &Forwarder{config: config}
+
+	if config.Protocol == "tls" {
+		host, _, err := net.SplitHostPort(config.Address)
+		if err != nil {
+			return nil, fmt.Errorf("forwarder %s: %w", config.Name, err)
+		}
+		f.tls = &tls.Config{ServerName: host, InsecureSkipVerify: config.Insecure}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("forwarder %s: %w", config.Name, err)
+			}
+			f.tls.RootCAs = x509.NewCertPool()
+			if !f.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("forwarder %s: no certificates in %s", config.Name, config.CAFile)
+			}
+		}
+	}
+
+	queue, err := openDiskQueue(config.QueueDir, config.MaxQueueBytes)
+	if err != nil {
+		return nil, fmt.Errorf("forwarder %s: %w", config.Name, err)
+	}
+	f.queue = queue
+
+	return f, nil
+}
+
+// Enqueue formats a matching message and appends it to the queue
+func (f *Forwarder) Enqueue(l models.Log) error {
+	if !f.config.Matches(l) {
+		return nil
+	}
+	record := FormatRFC3164(l)
+	if f.config.Format == "rfc5424" {
+		record = FormatRFC5424(l)
+	}
+	if f.config.Protocol == "udp" && len(record) > forwardMaxUDP {
+		record = strings.ToValidUTF8(record[:forwardMaxUDP], "")
+	}
+	return f.queue.Push([]byte(record))
+}
+
+// Run delivers queued messages, reconnecting with backoff while the upstream is down; it never returns
+func (f *Forwarder) Run() {
+	backoff := time.Second
+	for {
+		record, ok, err := f.queue.Peek()
+		if err != nil {
+			log.Printf("Error reading queue of forwarder %s: %v", f.config.Name, err)
+			time.Sleep(backoff)
+			continue
+		}
+		if !ok {
+			<-f.queue.Ready()
+			continue
+		}
+
+		if err := f.send(record); err != nil {
+			log.Printf("Error forwarding to %s: %v", f.config.Address, err)
+			f.disconnect()
+			time.Sleep(backoff)
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+
+		if err := f.queue.Ack(record); err != nil {
+			log.Printf("Error updating queue of forwarder %s: %v", f.config.Name, err)
+		}
+	}
+}
+
+func (f *Forwarder) send(record []byte) error {
+	if f.conn == nil {
+		if err := f.connect(); err != nil {
+			return err
+		}
+	}
+
+	if f.config.Protocol != "udp" {
+		// RFC 6587 octet-counting framing
+		record = append([]byte(fmt.Sprintf("%d ", len(record))), record...)
+	}
+
+	f.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := f.conn.Write(record)
+	return err
+}
+
+func (f *Forwarder) connect() error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var err error
+	switch f.config.Protocol {
+	case "tls":
+		f.conn, err = tls.DialWithDialer(dialer, "tcp", f.config.Address, f.tls)
+	default:
+		f.conn, err = dialer.Dial(f.config.Protocol, f.config.Address)
+	}
+	return err
+}
+
+func (f *Forwarder) disconnect() {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+}
+
+// forwardHostname is the HOSTNAME field of a forwarded message
+func forwardHostname(l models.Log) string {
+	for _, name := range []string{l.Hostname, l.ClientIP} {
+		if name != "" {
+			return strings.ReplaceAll(name, " ", "_")
+		}
+	}
+	return "-"
+}
+
+// forwardTimestamp prefers the device time and falls back to the time the message was received
+func forwardTimestamp(l models.Log) time.Time {
+	if !l.DeviceTime.IsZero() {
+		return l.DeviceTime
+	}
+	if !l.ReceivedAt.IsZero() {
+		return l.ReceivedAt
+	}
+	return time.Now()
+}
+
+// FormatRFC3164 renders a message in the BSD syslog format
+func FormatRFC3164(l models.Log) string {
+	msg := fmt.Sprintf("<%d>%s %s ", l.Priority, forwardTimestamp(l).Format(time.Stamp), forwardHostname(l))
+	if l.Tag != "" {
+		msg += l.Tag + ": "
+	}
+	return msg + l.Content
+}
+
+// FormatRFC5424 renders a message in the IETF syslog format
+func FormatRFC5424(l models.Log) string {
+	appName, procID := "-", "-"
+	if l.Tag != "" {
+		appName = l.Tag
+		if name, pid, ok := strings.Cut(strings.TrimSuffix(l.Tag, "]"), "["); ok {
+			appName, procID = name, pid
+		}
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		l.Priority,
+		forwardTimestamp(l).Format(time.RFC3339Nano),
+		forwardHostname(l),
+		appName,
+		procID,
+		l.Content)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"hostlog/models"
+)
+
+// TestFormatSyslog verifies the RFC 3164 and RFC 5424 output formats
+func TestFormatSyslog(t *testing.T) {
+	l := models.Log{
+		ClientIP:   "192.168.1.1",
+		Hostname:   "ap-kitchen",
+		Tag:        "hostapd[812]",
+		Content:    "wlan0: STA aa:bb:cc:dd:ee:ff IEEE 802.11: associated",
+		Priority:   30,
+		DeviceTime: time.Date(2025, 6, 1, 9, 5, 3, 0, time.UTC),
+	}
+
+	expected := "<30>Jun  1 09:05:03 ap-kitchen hostapd[812]: wlan0: STA aa:bb:cc:dd:ee:ff IEEE 802.11: associated"
+	if msg := FormatRFC3164(l); msg != expected {
+		t.Errorf("FormatRFC3164 = %q, expected %q", msg, expected)
+	}
+
+	expected = "<30>1 2025-06-01T09:05:03Z ap-kitchen hostapd 812 - - wlan0: STA aa:bb:cc:dd:ee:ff IEEE 802.11: associated"
+	if msg := FormatRFC5424(l); msg != expected {
+		t.Errorf("FormatRFC5424 = %q, expected %q", msg, expected)
+	}
+}
+
+// TestForwarderQueuesWhileUpstreamDown verifies that messages queued while the collector is down are delivered in order with octet counting
+func TestForwarderQueuesWhileUpstreamDown(t *testing.T) {
+	// Reserve an address and leave it closed until messages are queued
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	forwarder, err := NewForwarder(ForwarderConfig{
+		MessageFilter: MessageFilter{Hosts: []string{"192.168.1.1"}},
+		Name:          "central",
+		Protocol:      "tcp",
+		Address:       addr,
+		QueueDir:      t.TempDir(),
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewForwarder returned an error: %v", err)
+	}
+	defer forwarder.queue.Close()
+
+	for _, l := range []models.Log{
+		{ClientIP: "192.168.1.1", Content: "first", Priority: 13},
+		{ClientIP: "192.168.1.2", Content: "filtered out", Priority: 13},
+		{ClientIP: "192.168.1.1", Content: "second", Priority: 13},
+	} {
+		if err := forwarder.Enqueue(l); err != nil {
+			t.Fatalf("Enqueue returned an error: %v", err)
+		}
+	}
+	go forwarder.Run()
+
+	// Bring the collector up after the first delivery attempt failed
+	time.Sleep(200 * time.Millisecond)
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	for _, expected := range []string{"first", "second"} {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatalf("Failed to read frame length: %v", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("Invalid frame length %q", length)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		if !strings.HasSuffix(string(frame), " 192.168.1.1 "+expected) {
+			t.Errorf("Expected frame ending in %q, got %q", expected, frame)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for forwarder.queue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pending := forwarder.queue.Len(); pending != 0 {
+		t.Errorf("Expected empty queue after delivery, %d bytes pending", pending)
+	}
+}
+
+// TestForwarderTruncatesUDP verifies that a message too long for a datagram is cut instead of blocking the queue
+func TestForwarderTruncatesUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	forwarder, err := NewForwarder(ForwarderConfig{Name: "central", Address: conn.LocalAddr().String(), QueueDir: t.TempDir()}, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewForwarder returned an error: %v", err)
+	}
+	defer forwarder.queue.Close()
+
+	for _, content := range []string{strings.Repeat("ž", 64<<10), "next"} {
+		if err := forwarder.Enqueue(models.Log{ClientIP: "192.168.1.1", Content: content, Priority: 13}); err != nil {
+			t.Fatalf("Enqueue returned an error: %v", err)
+		}
+	}
+	go forwarder.Run()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	buf := make([]byte, 1<<16)
+	for _, check := range []func(string) bool{
+		func(datagram string) bool {
+			return len(datagram) <= forwardMaxUDP && len(datagram) > forwardMaxUDP-2 && utf8.ValidString(datagram)
+		},
+		func(datagram string) bool { return strings.HasSuffix(datagram, " next") },
+	} {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read datagram: %v", err)
+		}
+		if !check(string(buf[:n])) {
+			t.Errorf("Unexpected datagram of %d bytes: %.60q", n, buf[:n])
+		}
+	}
+}
+
+// TestDiskQueueSurvivesReopen verifies that pending records persist across restarts
+func TestDiskQueueSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	for _, record := range []string{"one", "two", "three"} {
+		if err := q.Push([]byte(record)); err != nil {
+			t.Fatalf("Push returned an error: %v", err)
+		}
+	}
+	record, _, _ := q.Peek()
+	if err := q.Ack(record); err != nil {
+		t.Fatalf("Ack returned an error: %v", err)
+	}
+	q.Close()
+
+	q, err = openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	defer q.Close()
+
+	for _, expected := range []string{"two", "three"} {
+		record, ok, err := q.Peek()
+		if err != nil || !ok {
+			t.Fatalf("Peek returned %v, %v", ok, err)
+		}
+		if string(record) != expected {
+			t.Errorf("Expected %q, got %q", expected, record)
+		}
+		q.Ack(record)
+	}
+	if _, ok, _ := q.Peek(); ok {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+// TestDiskQueueCompacts drops the consumed prefix of a queue that never drains, and keeps the pending records in order
+func TestDiskQueueCompacts(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+
+	record := func(i int) []byte {
+		return append([]byte(strconv.Itoa(i)+" "), bytes.Repeat([]byte("x"), 64<<10)...)
+	}
+	const total = 40
+	for i := 0; i < total; i++ {
+		if err := q.Push(record(i)); err != nil {
+			t.Fatalf("Push returned an error: %v", err)
+		}
+	}
+	next := 0
+	ack := func(count int) {
+		t.Helper()
+		for ; count > 0; count-- {
+			r, ok, err := q.Peek()
+			if err != nil || !ok || !bytes.Equal(r, record(next)) {
+				t.Fatalf("Expected record %d, got %.8q, %v, %v", next, r, ok, err)
+			}
+			if err := q.Ack(r); err != nil {
+				t.Fatalf("Ack returned an error: %v", err)
+			}
+			next++
+		}
+	}
+	ack(total/2 + 1)
+
+	info, err := os.Stat(filepath.Join(dir, "queue.dat"))
+	if err != nil {
+		t.Fatalf("Failed to stat the data file: %v", err)
+	}
+	if pushed := int64(total * (4 + len(record(total)))); info.Size() >= pushed/2 {
+		t.Errorf("Expected the consumed records dropped from the %d bytes pushed, got %d", pushed, info.Size())
+	}
+
+	// Pushing continues after the compacted records, and the order survives a reopen
+	if err := q.Push(record(total)); err != nil {
+		t.Fatalf("Push returned an error: %v", err)
+	}
+	ack(1)
+	q.Close()
+	if q, err = openDiskQueue(dir, 0); err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	defer q.Close()
+	ack(total - next + 1)
+	if _, ok, _ := q.Peek(); ok {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+// TestDiskQueueRecovers replays acknowledged records that were not committed before a crash, and drops a corrupt length
+func TestDiskQueueRecovers(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	for _, record := range []string{"one", "two"} {
+		q.Push([]byte(record))
+	}
+	record, _, _ := q.Peek()
+	q.Ack(record)
+
+	// Without Close, as after a crash
+	crashed, err := openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	if record, ok, _ := crashed.Peek(); !ok || string(record) != "one" {
+		t.Errorf("Expected the uncommitted record delivered again, got %q", record)
+	}
+	crashed.Close()
+	q.Close()
+
+	// A length beyond the largest record is corruption, not an allocation
+	corrupt := make([]byte, 4)
+	binary.BigEndian.PutUint32(corrupt, 0xFFFFFFF0)
+	if err := os.WriteFile(filepath.Join(dir, "queue.dat"), append(corrupt, "rest"...), 0o644); err != nil {
+		t.Fatalf("Failed to corrupt the data file: %v", err)
+	}
+	os.Remove(filepath.Join(dir, "queue.offset"))
+	if q, err = openDiskQueue(dir, 0); err != nil {
+		t.Fatalf("openDiskQueue returned an error: %v", err)
+	}
+	defer q.Close()
+	if _, ok, err := q.Peek(); ok || err == nil {
+		t.Errorf("Expected the corrupt record dropped with an error, got %v, %v", ok, err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected the queue to be empty, got %d bytes", q.Len())
+	}
+	if err := q.Push(make([]byte, queueMaxRecord+1)); err == nil {
+		t.Error("Expected a record over the largest size to be rejected")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlog/models"
+)
+
+// GroupConfig declares a named set of hosts. A host belongs to the group when any
+// of its addresses, hostnames or tags matches; tags are the way to add hosts by hand.
+type GroupConfig struct {
+	Name      string   `json:"name"`
+	Hosts     []string `json:"hosts"`     // Member addresses
+	CIDRs     []string `json:"cidrs"`     // Networks whose hosts are members
+	Hostnames []string `json:"hostnames"` // Shell patterns such as "ap-*", matched against hostnames, router names and display names
+	Tags      []string `json:"tags"`      // Hosts carrying any of these tags
+}
+
+// tagGroupPrefix names the implicit group of every tag, e.g. "tag:camera"
+const tagGroupPrefix = "tag:"
+
+// groupRefreshInterval is how long group memberships computed for ingest are reused
+const groupRefreshInterval = time.Minute
+
+// HostGroup is a compiled GroupConfig
+type HostGroup struct {
+	GroupConfig
+	networks []*net.IPNet
+}
+
+// Compile parses the networks and checks the hostname patterns
+func (g *HostGroup) Compile() error {
+	for _, cidr := range g.CIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		g.networks = append(g.networks, network)
+	}
+	for _, pattern := range g.Hostnames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("hostname pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAddress reports whether an address is a member by the address and network rules
+func (g *HostGroup) matchesAddress(address string) bool {
+	if slices.Contains(g.Hosts, address) {
+		return true
+	}
+	ip := net.ParseIP(address)
+	for _, network := range g.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesHostname reports whether a name matches one of the hostname patterns
+func (g *HostGroup) matchesHostname(name string) bool {
+	for _, pattern := range g.Hostnames {
+		if matched, _ := path.Match(pattern, name); matched && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether an inventory host belongs to the group
+func (g *HostGroup) Contains(h models.Host) bool {
+	for _, address := range h.AddressList() {
+		if g.matchesAddress(address) {
+			return true
+		}
+	}
+	for _, name := range slices.Concat(h.HostnameList(), h.Neighbor.Names, []string{h.DisplayName()}) {
+		if g.matchesHostname(name) {
+			return true
+		}
+	}
+	for _, tag := range h.TagList() {
+		if slices.Contains(g.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostGroups resolves the configured groups and the implicit tag groups against the host inventory
+type HostGroups struct {
+	store  *models.Store
+	groups []*HostGroup
+
+	mu        sync.Mutex
+	members   map[string][]uint // Group name to member host IDs, for ingest
+	refreshed time.Time
+}
+
+// NewHostGroups compiles the configured groups
+func NewHostGroups(store *models.Store, configs []GroupConfig) (*HostGroups, error) {
+	groups := &HostGroups{store: store}
+	for _, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("host group without a name")
+		}
+		if strings.HasPrefix(config.Name, tagGroupPrefix) {
+			return nil, fmt.Errorf("host group %s: names starting with %s are reserved for tags", config.Name, tagGroupPrefix)
+		}
+		if _, ok := groups.configured(config.Name); ok {
+			return nil, fmt.Errorf("host group %s is declared twice", config.Name)
+		}
+		group := &HostGroup{GroupConfig: config}
+		if err := group.Compile(); err != nil {
+			return nil, fmt.Errorf("host group %s: %w", config.Name, err)
+		}
+		groups.groups = append(groups.groups, group)
+	}
+	return groups, nil
+}
+
+// configured returns the configured group with the given name
+func (gs *HostGroups) configured(name string) (*HostGroup, bool) {
+	for _, group := range gs.groups {
+		if group.Name == name {
+			return group, true
+		}
+	}
+	return nil, false
+}
+
+// Find returns a configured group or the implicit group of a tag
+func (gs *HostGroups) Find(name string) (*HostGroup, bool) {
+	if tag, ok := strings.CutPrefix(name, tagGroupPrefix); ok && tag != "" {
+		return &HostGroup{GroupConfig: GroupConfig{Name: name, Tags: []string{tag}}}, true
+	}
+	return gs.configured(name)
+}
+
+// All returns the configured groups followed by the tag groups of the given hosts
+func (gs *HostGroups) All(hosts []models.Host) []*HostGroup {
+	all := slices.Clone(gs.groups)
+	var tags []string
+	for _, host := range hosts {
+		for _, tag := range host.TagList() {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		group, _ := gs.Find(tagGroupPrefix + tag)
+		all = append(all, group)
+	}
+	return all
+}
+
+// Members returns the hosts of the given inventory that belong to a group
+func (g *HostGroup) Members(hosts []models.Host) []models.Host {
+	var members []models.Host
+	for _, host := range hosts {
+		if g.Contains(host) {
+			members = append(members, host)
+		}
+	}
+	return members
+}
+
+// HostIDs resolves group names to the IDs of their member hosts. The result is
+// only nil without names, so that groups without members match no logs.
+func (gs *HostGroups) HostIDs(names []string) ([]uint, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	hosts, err := gs.store.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	for _, name := range names {
+		group, ok := gs.Find(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown host group %q", name)
+		}
+		for _, host := range group.Members(hosts) {
+			if !slices.Contains(ids, host.ID) {
+				ids = append(ids, host.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Of returns the names of the groups a log's host belongs to. Memberships are
+// refreshed from the inventory every minute; until then a new host is placed by
+// its address and hostname alone.
+func (gs *HostGroups) Of(l models.Log) []string {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if gs.members == nil || time.Since(gs.refreshed) > groupRefreshInterval {
+		gs.refresh()
+	}
+
+	var names []string
+	for name, members := range gs.members {
+		if slices.Contains(members, l.HostID) {
+			names = append(names, name)
+		}
+	}
+	for _, group := range gs.groups {
+		if !slices.Contains(names, group.Name) && (group.matchesAddress(l.ClientIP) || group.matchesHostname(l.Hostname)) {
+			names = append(names, group.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// refresh recomputes the memberships used by Of
+func (gs *HostGroups) refresh() {
+	gs.refreshed = time.Now()
+	hosts, err := gs.store.GetHosts()
+	if err != nil {
+		log.Printf("Error retrieving hosts for groups: %v", err)
+		if gs.members == nil {
+			gs.members = make(map[string][]uint)
+		}
+		return
+	}
+
+	gs.members = make(map[string][]uint)
+	for _, group := range gs.All(hosts) {
+		for _, host := range group.Members(hosts) {
+			gs.members[group.Name] = append(gs.members[group.Name], host.ID)
+		}
+	}
+}
+
+// GroupScore aggregates the visibility scores of a group's hosts
+type GroupScore struct {
+	Group   string
+	Score   float64 // Mean score of the member hosts
+	Max     float64
+	MaxHost string // Address with the highest score
+	Hosts   int    // Member hosts with a score
+}
+
+// GetGroupScores aggregates host scores per group, highest mean first. A host is
+// scored by the addresses it currently holds.
+func (gs *HostGroups) GetGroupScores(hostScores []HostScore) ([]GroupScore, error) {
+	hosts, err := gs.store.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, score := range hostScores {
+		addresses = append(addresses, score.Host)
+	}
+	owners, err := gs.store.GetAddressOwners(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// The score of a host is that of its busiest address
+	byHost := make(map[uint]HostScore)
+	for _, score := range hostScores {
+		id := owners[score.Host]
+		if best, ok := byHost[id]; id != 0 && (!ok || score.Score > best.Score) {
+			byHost[id] = score
+		}
+	}
+
+	var groupScores []GroupScore
+	for _, group := range gs.All(hosts) {
+		groupScore := GroupScore{Group: group.Name}
+		var total float64
+		for _, host := range group.Members(hosts) {
+			score, ok := byHost[host.ID]
+			if !ok {
+				continue
+			}
+			total += score.Score
+			groupScore.Hosts++
+			if score.Score > groupScore.Max {
+				groupScore.Max = score.Score
+				groupScore.MaxHost = score.Host
+			}
+		}
+		if groupScore.Hosts > 0 {
+			groupScore.Score = total / float64(groupScore.Hosts)
+		}
+		groupScores = append(groupScores, groupScore)
+	}
+
+	sort.SliceStable(groupScores, func(i, j int) bool {
+		return groupScores[i].Score > groupScores[j].Score
+	})
+	return groupScores, nil
+}
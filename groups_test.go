@@ -0,0 +1,129 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// TestHostGroups verifies membership by address, network, hostname pattern and tag
+func TestHostGroups(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	now := time.Now()
+	resolve := func(clientIP, hostname string) uint {
+		t.Helper()
+		id, err := store.ResolveHost(clientIP, hostname, now)
+		if err != nil {
+			t.Fatalf("ResolveHost(%s, %s) returned an error: %v", clientIP, hostname, err)
+		}
+		return id
+	}
+	router := resolve("192.168.1.1", "router")
+	kitchen := resolve("192.168.1.20", "ap-kitchen")
+	camera := resolve("10.0.0.5", "cam-door")
+	resolve("10.1.0.9", "laptop")
+	if _, err := store.UpdateHost(camera, "", []string{"camera"}, ""); err != nil {
+		t.Fatalf("UpdateHost returned an error: %v", err)
+	}
+
+	groups, err := NewHostGroups(store, []GroupConfig{
+		{Name: "core", Hosts: []string{"192.168.1.1"}},
+		{Name: "lan", CIDRs: []string{"192.168.1.0/24"}},
+		{Name: "aps", Hostnames: []string{"ap-*"}},
+		{Name: "empty", CIDRs: []string{"172.16.0.0/12"}},
+	})
+	if err != nil {
+		t.Fatalf("NewHostGroups returned an error: %v", err)
+	}
+
+	for _, test := range []struct {
+		groups []string
+		want   []uint
+	}{
+		{[]string{"core"}, []uint{router}},
+		{[]string{"lan"}, []uint{router, kitchen}},
+		{[]string{"aps", "tag:camera"}, []uint{kitchen, camera}},
+		{[]string{"empty"}, []uint{}},
+	} {
+		ids, err := groups.HostIDs(test.groups)
+		if err != nil {
+			t.Fatalf("HostIDs(%v) returned an error: %v", test.groups, err)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, test.want) || ids == nil {
+			t.Errorf("Expected hosts %v in %v, got %v", test.want, test.groups, ids)
+		}
+	}
+	if _, err := groups.HostIDs([]string{"missing"}); err == nil {
+		t.Error("Expected an error for an unknown group")
+	}
+
+	// A group without members must not fall back to all logs
+	page, err := store.GetFilteredLogs(models.LogFilter{HostIDs: []uint{}}, nil, nil, true)
+	if err != nil {
+		t.Fatalf("GetFilteredLogs returned an error: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("Expected no logs for an empty group, got %d", page.Total)
+	}
+
+	if names := groups.Of(models.Log{ClientIP: "192.168.1.77", Hostname: "ap-attic"}); !slices.Equal(names, []string{"aps", "lan"}) {
+		t.Errorf("Expected an unknown host to be placed by its address and hostname, got %v", names)
+	}
+	if names := groups.Of(models.Log{ClientIP: "10.0.0.5", HostID: camera}); !slices.Equal(names, []string{"tag:camera"}) {
+		t.Errorf("Expected the camera in its tag group, got %v", names)
+	}
+
+	for _, configs := range [][]GroupConfig{
+		{{Name: "tag:camera"}},
+		{{Name: "lan"}, {Name: "lan"}},
+		{{Name: "bad", CIDRs: []string{"192.168.1.0/33"}}},
+	} {
+		if _, err := NewHostGroups(store, configs); err == nil {
+			t.Errorf("Expected an error for groups %+v", configs)
+		}
+	}
+}
+
+// TestGetGroupScores verifies that group scores are the mean of the member hosts
+func TestGetGroupScores(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	for _, address := range []string{"192.168.1.1", "192.168.1.2", "10.0.0.1"} {
+		if _, err := store.ResolveHost(address, "", time.Now()); err != nil {
+			t.Fatalf("ResolveHost returned an error: %v", err)
+		}
+	}
+
+	groups, err := NewHostGroups(store, []GroupConfig{
+		{Name: "lan", CIDRs: []string{"192.168.1.0/24"}},
+		{Name: "lab", CIDRs: []string{"10.0.0.0/8"}},
+	})
+	if err != nil {
+		t.Fatalf("NewHostGroups returned an error: %v", err)
+	}
+
+	scores, err := groups.GetGroupScores([]HostScore{
+		{Host: "192.168.1.1", Score: 0.2},
+		{Host: "192.168.1.2", Score: 0.6},
+		{Host: "10.0.0.1", Score: 0.3},
+	})
+	if err != nil {
+		t.Fatalf("GetGroupScores returned an error: %v", err)
+	}
+	if len(scores) != 2 {
+		t.Fatalf("Expected 2 group scores, got %d", len(scores))
+	}
+	lan := scores[0]
+	if lan.Group != "lan" || lan.Hosts != 2 || lan.Score < 0.399 || lan.Score > 0.401 || lan.Max != 0.6 || lan.MaxHost != "192.168.1.2" {
+		t.Errorf("Unexpected lan score: %+v", lan)
+	}
+	if scores[1].Group != "lab" || scores[1].Score != 0.3 {
+		t.Errorf("Unexpected lab score: %+v", scores[1])
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"hostlog/models"
+
+	"gopkg.in/mcuadros/go-syslog.v2"
+)
+
+// ingestQueueSize bounds the messages waiting for the ingest loop
+const ingestQueueSize = 1024
+
+// ingestQueueThreshold is how many messages may wait while hostlog is ready
+const ingestQueueThreshold = ingestQueueSize * 3 / 4
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health tracks what hostlog needs to accept messages, for /readyz
+type Health struct {
+	store   *models.Store
+	queue   syslog.LogPartsChannel
+	started time.Time
+
+	mu        sync.Mutex
+	listeners map[string]error // Why each listener failed to bind; nil when bound
+}
+
+// NewHealth returns the health of a daemon storing into store the messages waiting in queue
+func NewHealth(store *models.Store, queue syslog.LogPartsChannel) *Health {
+	return &Health{store: store, queue: queue, started: time.Now(), listeners: make(map[string]error)}
+}
+
+// Listening records whether a listener bound its port
+func (h *Health) Listening(listener string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[listener] = err
+}
+
+// Ready runs the readiness checks and reports whether all passed
+func (h *Health) Ready() (bool, map[string]HealthCheck) {
+	checks := make(map[string]HealthCheck)
+
+	if err := h.store.CheckWritable(); err != nil {
+		checks["database"] = HealthCheck{Detail: err.Error()}
+	} else {
+		checks["database"] = HealthCheck{OK: true, Detail: h.store.Path}
+	}
+
+	h.mu.Lock()
+	for _, listener := range []string{ListenerTCP, ListenerUDP} {
+		err, reported := h.listeners[listener]
+		switch {
+		case !reported:
+			checks["listener_"+listener] = HealthCheck{Detail: "not started"}
+		case err != nil:
+			checks["listener_"+listener] = HealthCheck{Detail: err.Error()}
+		default:
+			checks["listener_"+listener] = HealthCheck{OK: true}
+		}
+	}
+	h.mu.Unlock()
+
+	waiting := len(h.queue)
+	checks["ingest_queue"] = HealthCheck{
+		OK:     waiting < ingestQueueThreshold,
+		Detail: fmt.Sprintf("%d of %d messages waiting", waiting, cap(h.queue)),
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return ready, checks
+}
+
+// writeJSON writes value as the JSON response with the status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// handleHealthz answers as long as the process serves requests
+func (ui *webUI) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "ok",
+		"uptime": time.Since(ui.health.started).Round(time.Second).String(),
+	})
+}
+
+// handleReadyz answers 200 when hostlog can accept and store messages, and 503 otherwise
+func (ui *webUI) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := ui.health.Ready()
+	response := struct {
+		Status string                 `json:"status"`
+		Checks map[string]HealthCheck `json:"checks"`
+	}{Status: "ready", Checks: checks}
+	status := http.StatusOK
+	if !ready {
+		response.Status = "not ready"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
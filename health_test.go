@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hostlog/models"
+
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// TestReadiness needs a writable database, both listeners bound and room in the ingest queue
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	queue := make(syslog.LogPartsChannel, ingestQueueSize)
+	health := NewHealth(store, queue)
+	if ready, checks := health.Ready(); ready || checks["listener_udp"].Detail != "not started" {
+		t.Errorf("Expected not ready before the listeners start, got %+v", checks)
+	}
+
+	health.Listening(ListenerTCP, nil)
+	health.Listening(ListenerUDP, nil)
+	if ready, checks := health.Ready(); !ready || !checks["database"].OK {
+		t.Errorf("Expected ready, got %+v", checks)
+	}
+
+	for i := 0; i < ingestQueueThreshold; i++ {
+		queue <- format.LogParts{}
+	}
+	if ready, checks := health.Ready(); ready || checks["ingest_queue"].OK {
+		t.Errorf("Expected a full queue to fail, got %+v", checks)
+	}
+	for len(queue) > 0 {
+		<-queue
+	}
+
+	health.Listening(ListenerUDP, errors.New("address already in use"))
+	if ready, checks := health.Ready(); ready || checks["listener_udp"].Detail != "address already in use" {
+		t.Errorf("Expected an unbound listener to fail, got %+v", checks)
+	}
+
+	readOnly, err := models.OpenStore(store.Path, true)
+	if err != nil {
+		t.Fatalf("Failed to open the database read-only: %v", err)
+	}
+	t.Cleanup(func() { readOnly.Close() })
+	if err := readOnly.CheckWritable(); err == nil {
+		t.Error("Expected a read-only database to fail the write check")
+	}
+}
+
+// TestDoctor checks a migrated database and reports a missing one without creating it
+func TestDoctor(t *testing.T) {
+	store := openTestDB(t)
+	t.Setenv("HOSTLOG_CONFIG", "")
+	t.Setenv("HOSTLOG_DB_DSN", "")
+	t.Setenv("HOSTLOG_DB_PATH", store.Path)
+	t.Setenv("HOSTLOG_SYSLOG_PORT", "0")
+	t.Setenv("HOSTLOG_HTTP_PORT", "0")
+
+	var out strings.Builder
+	if !runDoctor(&out) {
+		t.Errorf("Expected all checks to pass, got\n%s", out.String())
+	}
+	for _, want := range []string{"ok    database: " + store.Path + " is writable\n", "ok    integrity: no problems found\n", "ok    port http/0: free\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, out.String())
+		}
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	t.Setenv("HOSTLOG_DB_PATH", missing)
+	out.Reset()
+	runDoctor(&out)
+	if !strings.Contains(out.String(), "warn  database: "+missing+" does not exist yet") {
+		t.Errorf("Expected a missing database reported, got\n%s", out.String())
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected doctor not to create the database")
+	}
+}
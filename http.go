@@ -3,13 +3,19 @@ package main
 import (
 	"bytes"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"hostlog/models"
 
@@ -24,6 +30,9 @@ type Broadcaster struct {
 	entering chan chan models.Log
 	leaving  chan chan models.Log
 	Messages chan models.Log
+
+	clientCount atomic.Int64 // Clients connected
+	dropped     atomic.Int64 // Messages not sent to a slow client
 }
 
 var logBroadcaster = Broadcaster{
@@ -42,19 +51,34 @@ func (b *Broadcaster) Start() {
 				case client <- msg:
 				default:
 					// Drop message if client is slow
+					b.dropped.Add(1)
 				}
 			}
 		case client := <-b.entering:
 			b.clients[client] = true
+			b.clientCount.Store(int64(len(b.clients)))
 		case client := <-b.leaving:
 			delete(b.clients, client)
 			close(client)
+			b.clientCount.Store(int64(len(b.clients)))
 		}
 	}
 }
 
+// webUI serves the web interface from one store
+type webUI struct {
+	store   *models.Store
+	hosts   *HostGroups
+	limiter *RateLimiter   // nil when nothing is limited
+	sources *SourceFilters // nil when no listener is filtered
+	health  *Health
+	scores  scoreCache // Visibility scores exposed to /metrics
+}
+
 // StartHTTPServer initializes and starts the HTTP server with static files and dynamic routes
-func StartHTTPServer(port string, staticFiles embed.FS) {
+func StartHTTPServer(port string, staticFiles embed.FS, store *models.Store, hosts *HostGroups, limiter *RateLimiter, sources *SourceFilters, health *Health) {
+	ui := &webUI{store: store, hosts: hosts, limiter: limiter, sources: sources, health: health}
+
 	// Create a new ServeMux
 	mux := http.NewServeMux()
 
@@ -68,9 +92,13 @@ func StartHTTPServer(port string, staticFiles embed.FS) {
 	fileServer := http.FileServer(http.FS(staticContent))
 
 	// Set up routes on our mux
-	mux.HandleFunc("/", handleIndex)
-	mux.HandleFunc("/messages", handleMessages)
-	mux.HandleFunc("/events", handleEvents)
+	mux.HandleFunc("/", ui.handleIndex)
+	mux.HandleFunc("/messages", ui.handleMessages)
+	mux.HandleFunc("/events", ui.handleEvents)
+	mux.HandleFunc("POST /hosts/{id}", sameOrigin(ui.handleUpdateHost))
+	mux.HandleFunc("GET /metrics", ui.handleMetrics)
+	mux.HandleFunc("GET /healthz", ui.handleHealthz)
+	mux.HandleFunc("GET /readyz", ui.handleReadyz)
 	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
 
 	// Create the HTTP server
@@ -80,21 +108,16 @@ func StartHTTPServer(port string, staticFiles embed.FS) {
 	}
 
 	// Register MCP endpoint
-	mcpServer := NewMCPServer()
+	mcpServer := NewMCPServer(store, hosts)
 	sse := server.NewSSEServer(mcpServer,
 		server.WithHTTPServer(srv),
 		server.WithStaticBasePath("/mcp"),
+		server.WithSSEContextFunc(sseWriteContext),
 	)
 	mux.Handle("/mcp/", sse)
 
-	// Create template functions map
-	funcMap := template.FuncMap{
-		"add":      func(a, b int) int { return a + b },
-		"subtract": func(a, b int) int { return a - b },
-	}
-
-	// Parse templates with functions
-	templates = template.Must(template.New("").Funcs(funcMap).ParseFS(staticFiles, "templates/*.html"))
+	// Parse templates
+	templates = template.Must(template.New("").Funcs(template.FuncMap{"join": strings.Join}).ParseFS(staticFiles, "templates/*.html"))
 
 	log.Printf("Web server started. Listening on HTTP port %s...", port)
 	go logBroadcaster.Start()
@@ -104,16 +127,16 @@ func StartHTTPServer(port string, staticFiles embed.FS) {
 }
 
 // handleIndex handles the main page request
-func handleIndex(w http.ResponseWriter, r *http.Request) {
+func (ui *webUI) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Get recent logs from database
-	logs, maxPage, err := models.GetFilteredLogs([]string{}, 0) // Get the 100 most recent logs
+	page, err := ui.store.GetFilteredLogs(models.LogFilter{}, nil, nil, false) // Get the 100 most recent logs
 	if err != nil {
 		log.Printf("Error retrieving logs: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	hostScores, err := GetAllHostScores()
+	hostScores, err := GetAllHostScores(ui.store)
 	if err != nil {
 		log.Printf("Error retrieving host scores: %v", err)
 		hostScores = []HostScore{}
@@ -121,21 +144,56 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
 	topHostScores := GetTopHostScores(hostScores, 3)
 
+	hosts, err := ui.store.GetHosts()
+	if err != nil {
+		log.Printf("Error retrieving hosts: %v", err)
+	}
+
+	notes, err := ui.getNotes()
+	if err != nil {
+		log.Printf("Error retrieving notes: %v", err)
+	}
+
+	alerts, err := ui.store.GetAlerts("")
+	if err != nil {
+		log.Printf("Error retrieving alerts: %v", err)
+	}
+
+	skews, err := ui.store.GetSkewedClocks()
+	if err != nil {
+		log.Printf("Error retrieving clock skews: %v", err)
+	}
+
+	inventory := formatHostsForDisplay(hosts, skews)
+
+	groupScores, err := ui.hosts.GetGroupScores(hostScores)
+	if err != nil {
+		log.Printf("Error retrieving group scores: %v", err)
+	}
+
 	// Prepare data for template
 	data := struct {
+		LogPageDisplay
 		DBPath   string
-		Logs     []LogDisplay
-		Page     int
-		MaxPage  int
-		Hosts    []HostScore
-		TopHosts []HostScore
+		Hosts    []HostDisplay
+		TopHosts []HostDisplay
+		Groups   []GroupDisplay
+		Notes    Notes
+		Alerts   []models.Alert
+		Firewall FirewallDisplay
+		Limits   RateLimitDisplay
+		Rejected []RejectedDisplay
 	}{
-		DBPath:   models.DBPath,
-		Logs:     formatLogsForDisplay(logs),
-		Page:     0,
-		MaxPage:  maxPage,
-		Hosts:    hostScores,
-		TopHosts: topHostScores,
+		LogPageDisplay: ui.formatLogPage(page),
+		DBPath:         ui.store.Path,
+		Hosts:          inventory,
+		TopHosts:       ui.topHosts(topHostScores, inventory),
+		Groups:         ui.formatGroupsForDisplay(hosts, groupScores),
+		Notes:          notes,
+		Alerts:         alerts,
+		Firewall:       ui.formatFirewallForDisplay(time.Now()),
+		Limits:         ui.formatRateLimitsForDisplay(),
+		Rejected:       ui.formatRejectedForDisplay(),
 	}
 
 	// Render template
@@ -146,29 +204,416 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HostDisplay is an inventory host formatted for display
+type HostDisplay struct {
+	ID        uint
+	Name      string // Display name
+	Custom    string // Name set by the user
+	Addresses []string
+	Hostnames []string
+	MAC       string
+	Vendor    string
+	Known     []string // Names from DHCP leases and static mappings
+	Tags      []string
+	Notes     string
+	FirstSeen string
+	LastSeen  string
+	BadClock  string // Skew of the first of its addresses with a skewed clock
+}
+
+// GroupDisplay is a host group formatted for display
+type GroupDisplay struct {
+	Name    string
+	Members []string // Display names of the member hosts
+	Score   string   // Mean visibility score of the members
+	Max     string   // Highest member score and its address
+}
+
+// RateLimitDisplay shows the rate limits and the sources that went over them
+type RateLimitDisplay struct {
+	Enabled  bool
+	Config   RateLimitConfig
+	Received int64
+	Sources  []RateStats
+}
+
+// formatRateLimitsForDisplay reads the counters of the rate limiter
+func (ui *webUI) formatRateLimitsForDisplay() RateLimitDisplay {
+	display := RateLimitDisplay{Enabled: ui.limiter != nil, Config: ui.limiter.Config()}
+	display.Received, display.Sources = ui.limiter.Stats()
+	return display
+}
+
+// RejectedDisplay is a source a listener rejected messages from
+type RejectedDisplay struct {
+	RejectedSource
+	FirstSeen string
+	LastSeen  string
+}
+
+// formatRejectedForDisplay lists the recently rejected sources, redacting their last messages
+func (ui *webUI) formatRejectedForDisplay() []RejectedDisplay {
+	var display []RejectedDisplay
+	for _, rejected := range ui.sources.Rejected() {
+		rejected.Message, _ = ui.store.Redactor.Redact(rejected.Message)
+		display = append(display, RejectedDisplay{
+			RejectedSource: rejected,
+			FirstSeen:      rejected.First.Format("2006-01-02 15:04:05"),
+			LastSeen:       rejected.Last.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return display
+}
+
+// FirewallDisplay summarizes the packets router firewalls blocked over the last day
+type FirewallDisplay struct {
+	Sources []models.BlockedSource
+	Ports   []models.BlockedPort
+	Rates   []DropRateDisplay
+}
+
+// DropRateDisplay is the number of packets a router blocked per hour
+type DropRateDisplay struct {
+	Host      string
+	Total     int64
+	Peak      int64 // Most packets blocked in one hour
+	Sparkline string
+}
+
+// formatFirewallForDisplay summarizes the blocked packets of the day before now
+func (ui *webUI) formatFirewallForDisplay(now time.Time) FirewallDisplay {
+	var display FirewallDisplay
+	query := models.FirewallQuery{Since: now.Add(-firewallWindow), Limit: 10}
+
+	var err error
+	if display.Sources, err = ui.store.TopBlockedSources(query); err != nil {
+		log.Printf("Error retrieving blocked sources: %v", err)
+	}
+	if display.Ports, err = ui.store.TopBlockedPorts(query); err != nil {
+		log.Printf("Error retrieving blocked ports: %v", err)
+	}
+	rates, err := ui.store.GetDropRates(query, time.Hour)
+	if err != nil {
+		log.Printf("Error retrieving drop rates: %v", err)
+	}
+
+	routers := dropRateSeries(rates, query.Since, now, time.Hour)
+	hosts, err := ui.store.GetHostsByID(slices.Sorted(maps.Keys(routers)))
+	if err != nil {
+		log.Printf("Error retrieving hosts: %v", err)
+	}
+	for _, id := range slices.Sorted(maps.Keys(routers)) {
+		counts := routers[id]
+		rate := DropRateDisplay{Host: fmt.Sprintf("#%d", id), Sparkline: sparkline(counts)}
+		if host, ok := hosts[id]; ok {
+			rate.Host = host.DisplayName()
+		}
+		for _, count := range counts {
+			rate.Total += count
+			rate.Peak = max(rate.Peak, count)
+		}
+		display.Rates = append(display.Rates, rate)
+	}
+	return display
+}
+
+// formatGroupsForDisplay lists the host groups with their members and scores
+func (ui *webUI) formatGroupsForDisplay(hosts []models.Host, scores []GroupScore) []GroupDisplay {
+	var display []GroupDisplay
+	for _, group := range ui.hosts.All(hosts) {
+		g := GroupDisplay{Name: group.Name}
+		for _, member := range group.Members(hosts) {
+			g.Members = append(g.Members, member.DisplayName())
+		}
+		for _, score := range scores {
+			if score.Group == group.Name && score.Hosts > 0 {
+				g.Score = fmt.Sprintf("%.2f", score.Score)
+				g.Max = fmt.Sprintf("%.2f (%s)", score.Max, score.MaxHost)
+			}
+		}
+		display = append(display, g)
+	}
+	return display
+}
+
+// formatHostsForDisplay converts inventory hosts to display format
+func formatHostsForDisplay(hosts []models.Host, skews map[string]models.ClockSkew) []HostDisplay {
+	display := make([]HostDisplay, 0, len(hosts))
+	for _, host := range hosts {
+		h := HostDisplay{
+			ID:        host.ID,
+			Name:      host.DisplayName(),
+			Custom:    host.Name,
+			Addresses: host.AddressLabels(),
+			Hostnames: host.HostnameList(),
+			MAC:       host.Neighbor.MAC,
+			Vendor:    host.Neighbor.Vendor,
+			Known:     host.Neighbor.Names,
+			Tags:      host.TagList(),
+			Notes:     host.Notes,
+			FirstSeen: host.FirstSeen.Format("2006-01-02 15:04:05"),
+			LastSeen:  host.LastSeen.Format("2006-01-02 15:04:05"),
+		}
+		for _, address := range host.AddressList() {
+			if skew, ok := skews[address]; ok {
+				h.BadClock = formatSkew(skew.Skew)
+				break
+			}
+		}
+		display = append(display, h)
+	}
+	return display
+}
+
+// topHosts returns the inventory hosts currently holding the addresses with the top scores
+func (ui *webUI) topHosts(scores []HostScore, inventory []HostDisplay) []HostDisplay {
+	var addresses []string
+	for _, score := range scores {
+		addresses = append(addresses, score.Host)
+	}
+	owners, err := ui.store.GetAddressOwners(addresses)
+	if err != nil {
+		log.Printf("Error retrieving address owners: %v", err)
+		return nil
+	}
+
+	var top []HostDisplay
+	for _, address := range addresses {
+		i := slices.IndexFunc(inventory, func(h HostDisplay) bool { return h.ID == owners[address] })
+		if i >= 0 && !slices.ContainsFunc(top, func(h HostDisplay) bool { return h.ID == inventory[i].ID }) {
+			top = append(top, inventory[i])
+		}
+	}
+	return top
+}
+
+// handleUpdateHost saves the details edited on the Hosts tab
+func (ui *webUI) handleUpdateHost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid host ID", http.StatusBadRequest)
+		return
+	}
+
+	host, err := ui.store.GetHost(uint(id))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = ui.store.UpdateHost(host.ID, r.FormValue("name"), strings.Split(r.FormValue("tags"), ","), r.FormValue("notes"))
+	if err != nil {
+		log.Printf("Error updating host: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/#tab5", http.StatusSeeOther)
+}
+
+// sameOrigin rejects state-changing requests that a page of another site may have sent;
+// browsers name the page in Origin, or at least in Referer
+func sameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := r.Header.Get("Origin")
+		if source == "" {
+			source = r.Header.Get("Referer")
+		}
+		if u, err := url.Parse(source); err != nil || source == "" || u.Host != r.Host {
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Notes holds annotations, acknowledgements and silences shown in the UI
+type Notes struct {
+	Annotations      []models.Annotation
+	Acknowledgements []models.Acknowledgement
+	Silences         []models.Silence
+}
+
+// getNotes loads everything written through the MCP write tools
+func (ui *webUI) getNotes() (Notes, error) {
+	var notes Notes
+	var err error
+
+	if notes.Annotations, err = ui.store.GetAnnotations(); err != nil {
+		return notes, err
+	}
+	if notes.Acknowledgements, err = ui.store.GetAcknowledgements(); err != nil {
+		return notes, err
+	}
+	notes.Silences, err = ui.store.GetActiveSilences()
+	return notes, err
+}
+
 // LogDisplay represents a log entry formatted for display
 type LogDisplay struct {
-	Timestamp string
+	ID        uint
+	Cursor    string
+	Timestamp string // On the store's clock
+	Received  string
+	Device    string
+	BadClock  bool // The host's clock is skewed
 	Source    string
+	HostID    uint
+	Host      string // Display name of the inventory host
+	Groups    string // Names of the host's groups as a JSON array
 	Severity  string
 	Message   string
+	Repeats   int                   // Times the host sent the message in a row
+	Last      string                // When the last repeat was received
+	Vendors   []models.MACVendor    // MAC addresses in the message with known vendors
+	Fields    []string              // Extracted fields as name=value
+	FieldKeys string                // Fields as a JSON array, for filtering live rows
+	Firewall  *models.FirewallEvent // Packet of a netfilter log line
+	Packet    string                // Summary of the packet
+	Notes     []string
+	Muted     bool   // Matches an active silence
 	Class     string // CSS class for styling based on severity
 }
 
+// LogPageDisplay is a page of logs with the cursors of the neighbouring pages
+type LogPageDisplay struct {
+	Logs  []LogDisplay
+	Newer string
+	Older string
+	Total int64 // -1 when not counted
+}
+
+// formatLogPage converts a page of logs to display format
+func (ui *webUI) formatLogPage(page models.LogPage) LogPageDisplay {
+	display := LogPageDisplay{
+		Logs:  ui.formatLogsForDisplay(page.Logs),
+		Total: page.Total,
+	}
+	if page.Newer != nil {
+		display.Newer = page.Newer.String()
+	}
+	if page.Older != nil {
+		display.Older = page.Older.String()
+	}
+	return display
+}
+
+// logHosts returns the distinct hosts of the given logs
+func logHosts(logs []models.Log) []string {
+	var hosts []string
+	for _, l := range logs {
+		if !slices.Contains(hosts, l.ClientIP) {
+			hosts = append(hosts, l.ClientIP)
+		}
+	}
+	return hosts
+}
+
+// formatSkew renders a clock skew with its sign
+func formatSkew(skew time.Duration) string {
+	if skew > 0 {
+		return "+" + skew.Round(time.Second).String()
+	}
+	return skew.Round(time.Second).String()
+}
+
+// logHostIDs returns the distinct inventory hosts of the given logs
+func logHostIDs(logs []models.Log) []uint {
+	var ids []uint
+	for _, l := range logs {
+		if l.HostID != 0 && !slices.Contains(ids, l.HostID) {
+			ids = append(ids, l.HostID)
+		}
+	}
+	return ids
+}
+
+// hostLabel names the sender of a log by its inventory host and address
+func hostLabel(hosts map[uint]models.Host, l models.Log) string {
+	host, ok := hosts[l.HostID]
+	if !ok || host.DisplayName() == l.ClientIP {
+		return l.ClientIP
+	}
+	return fmt.Sprintf("%s (%s)", host.DisplayName(), l.ClientIP)
+}
+
+// logIDs returns the IDs of the given logs
+func logIDs(logs []models.Log) []uint {
+	ids := make([]uint, 0, len(logs))
+	for _, l := range logs {
+		ids = append(ids, l.ID)
+	}
+	return ids
+}
+
 // formatLogsForDisplay converts database logs to display format
-func formatLogsForDisplay(logs []models.Log) []LogDisplay {
+func (ui *webUI) formatLogsForDisplay(logs []models.Log) []LogDisplay {
 	var displayLogs []LogDisplay
 
-	for _, log := range logs {
-		severity, class := getSeverityInfo(log.Priority)
+	annotations, err := ui.store.GetAnnotationsForLogs(logIDs(logs))
+	if err != nil {
+		log.Printf("Error retrieving annotations: %v", err)
+	}
+	silences, err := ui.store.GetActiveSilences()
+	if err != nil {
+		log.Printf("Error retrieving silences: %v", err)
+	}
+	var skews map[string]models.ClockSkew
+	if len(logs) > 0 {
+		if skews, err = ui.store.GetClockSkews(logHosts(logs)); err != nil {
+			log.Printf("Error retrieving clock skews: %v", err)
+		}
+	}
+	hosts, err := ui.store.GetHostsByID(logHostIDs(logs))
+	if err != nil {
+		log.Printf("Error retrieving hosts: %v", err)
+	}
+	fields, err := ui.store.GetFieldsForLogs(logIDs(logs))
+	if err != nil {
+		log.Printf("Error retrieving fields: %v", err)
+	}
+
+	for _, l := range logs {
+		severity, class := getSeverityInfo(l.Priority)
+		skew := skews[l.ClientIP]
 
 		displayLog := LogDisplay{
-			Timestamp: log.Timestamp.Format("2006-01-02 15:04:05"),
-			Source:    log.ClientIP,
+			ID:        l.ID,
+			Cursor:    models.CursorOf(l).String(),
+			Timestamp: l.Time(ui.store.ResolveClock(ui.store.Clock, skew)).Format("2006-01-02 15:04:05"),
+			Received:  l.ReceivedAt.Format("2006-01-02 15:04:05"),
+			Device:    l.DeviceTime.Format("2006-01-02 15:04:05"),
+			BadClock:  skew.Skewed(ui.store.SkewTolerance),
+			Source:    l.ClientIP,
+			HostID:    l.HostID,
+			Host:      l.ClientIP,
 			Severity:  severity,
-			Message:   log.Content,
+			Message:   l.Content,
+			Repeats:   l.Repeats,
+			Last:      l.LastReceived().Format("2006-01-02 15:04:05"),
+			Vendors:   ui.store.Vendors.Annotate(l.Content),
+			Muted:     models.IsSilenced(silences, l.ClientIP, l.Content),
 			Class:     class,
 		}
+		if host, ok := hosts[l.HostID]; ok {
+			displayLog.Host = host.DisplayName()
+		}
+		if groups, err := json.Marshal(ui.hosts.Of(l)); err == nil {
+			displayLog.Groups = string(groups)
+		}
+		if event, ok := parseNetfilter(l); ok {
+			displayLog.Firewall = &event
+			displayLog.Packet = formatPacket(event)
+		}
+		for _, field := range fields[l.ID] {
+			displayLog.Fields = append(displayLog.Fields, models.FieldMatch{Name: field.Name, Value: field.Value}.String())
+		}
+		if keys, err := json.Marshal(displayLog.Fields); err == nil {
+			displayLog.FieldKeys = string(keys)
+		}
+		for _, annotation := range annotations[l.ID] {
+			displayLog.Notes = append(displayLog.Notes, annotation.Text)
+		}
 
 		displayLogs = append(displayLogs, displayLog)
 	}
@@ -194,31 +639,58 @@ func getSeverityInfo(priority int) (string, string) {
 }
 
 // handleMessages handles requests for the messages endpoint
-func handleMessages(w http.ResponseWriter, r *http.Request) {
-	hosts := r.URL.Query()["hosts[]"]
-	page := 0
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p >= 0 {
-			page = p
+func (ui *webUI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LogFilter{Hosts: query["hosts[]"]}
+	for _, value := range query["host_ids[]"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid host ID", http.StatusBadRequest)
+			return
+		}
+		filter.HostIDs = append(filter.HostIDs, uint(id))
+	}
+	if groups := query["groups[]"]; len(groups) > 0 {
+		members, err := ui.hosts.HostIDs(groups)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		filter.HostIDs = append(members, filter.HostIDs...)
+	}
+	for _, value := range query["fields[]"] {
+		match, err := models.ParseFieldMatch(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Fields = append(filter.Fields, match)
 	}
 
-	logs, maxPage, err := models.GetFilteredLogs(hosts, page)
+	var before, after *models.Cursor
+	var err error
+	if cursor := query.Get("before"); cursor != "" {
+		if before, err = models.ParseCursor(cursor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if cursor := query.Get("after"); cursor != "" {
+		if after, err = models.ParseCursor(cursor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	count, _ := strconv.ParseBool(query.Get("count"))
+
+	page, err := ui.store.GetFilteredLogs(filter, before, after, count)
 	if err != nil {
 		log.Printf("Error retrieving logs: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	data := struct {
-		Logs    []LogDisplay
-		Page    int
-		MaxPage int
-	}{
-		Logs:    formatLogsForDisplay(logs),
-		Page:    page,
-		MaxPage: maxPage,
-	}
+	data := ui.formatLogPage(page)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -229,7 +701,7 @@ func handleMessages(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleEvents(w http.ResponseWriter, r *http.Request) {
+func (ui *webUI) handleEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -253,7 +725,7 @@ func handleEvents(w http.ResponseWriter, r *http.Request) {
 			if !ok {
 				return
 			}
-			displayLogs := formatLogsForDisplay([]models.Log{logEntry})
+			displayLogs := ui.formatLogsForDisplay([]models.Log{logEntry})
 			if len(displayLogs) == 0 {
 				continue
 			}
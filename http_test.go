@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSameOrigin accepts state-changing requests from the web UI's own pages only
+func TestSameOrigin(t *testing.T) {
+	t.Parallel()
+	handler := sameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, test := range []struct {
+		name, origin, referer string
+		want                  int
+	}{
+		{"same origin", "http://hostlog.lan:8080", "", http.StatusNoContent},
+		{"same referer", "", "http://hostlog.lan:8080/#tab5", http.StatusNoContent},
+		{"other origin", "http://evil.example", "http://hostlog.lan:8080/", http.StatusForbidden},
+		{"other port", "http://hostlog.lan:9090", "", http.StatusForbidden},
+		{"other referer", "", "http://evil.example/page", http.StatusForbidden},
+		{"opaque origin", "null", "", http.StatusForbidden},
+		{"neither", "", "", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("POST", "http://hostlog.lan:8080/hosts/1", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.referer != "" {
+			r.Header.Set("Referer", test.referer)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s: expected %d, got %d", test.name, test.want, w.Code)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"hostlog/models"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
 	"gopkg.in/mcuadros/go-syslog.v2"
@@ -17,17 +19,97 @@ var staticFiles embed.FS
 
 func main() {
 	mcpFlag := flag.Bool("mcp", false, "Run as an MCP server")
+	ouiFlag := flag.String("update-oui", "", "Replace the MAC vendor database with the IEEE oui.txt or oui.csv at this path")
 	flag.Parse()
 
 	if *mcpFlag {
 		runMCPServer()
 		return
 	}
+	if *ouiFlag != "" {
+		updateVendors(*ouiFlag)
+		return
+	}
+	if flag.Arg(0) == "doctor" {
+		if !runDoctor(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
 
-	_, err := models.InitDB()
+	config, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	store, err := models.InitDB()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := config.Clock.Apply(store); err != nil {
+		log.Fatalf("Failed to set up clock: %v", err)
+	}
+	if err := config.Neighbors.Apply(store); err != nil {
+		log.Fatalf("Failed to read neighbor files: %v", err)
+	}
+	if err := config.Auth.Apply(store); err != nil {
+		log.Fatalf("Failed to set up brute-force detection: %v", err)
+	}
+	if err := config.Redaction.Apply(store); err != nil {
+		log.Fatalf("Failed to set up redaction: %v", err)
+	}
+	if err := config.Dedup.Apply(store); err != nil {
+		log.Fatalf("Failed to set up duplicate suppression: %v", err)
+	}
+
+	if config.Retention > 0 {
+		go RunRetention(store, time.Duration(config.Retention))
+	}
+
+	hostGroups, err := NewHostGroups(store, config.Groups)
+	if err != nil {
+		log.Fatalf("Failed to set up host groups: %v", err)
+	}
+
+	alertEngine, err := NewAlertEngine(store, config.Alerts, hostGroups)
+	if err != nil {
+		log.Fatalf("Failed to set up alert rules: %v", err)
+	}
+	go alertEngine.Run()
+
+	if config.Digest.Email != "" {
+		notifier, _ := alertEngine.Notifier(config.Digest.Email)
+		sender, ok := notifier.(*EmailNotifier)
+		if !ok {
+			log.Fatalf("Digest refers to unknown email notifier %s", config.Digest.Email)
+		}
+		go RunDigest(store, config.Digest, sender)
+	}
+
+	forwarders, err := NewForwarders(config.Forwarders, store.DataDir())
+	if err != nil {
+		log.Fatalf("Failed to set up forwarders: %v", err)
+	}
+
+	parsers, err := NewParsers(config.Parsers)
+	if err != nil {
+		log.Fatalf("Failed to set up parsers: %v", err)
+	}
+
+	sources, err := NewSourceFilters(config.Listeners)
+	if err != nil {
+		log.Fatalf("Failed to set up source lists: %v", err)
+	}
+
+	limiter, err := NewRateLimiter(config.RateLimit)
+	if err != nil {
+		log.Fatalf("Failed to set up rate limits: %v", err)
+	}
+
+	reverseDNS := NewReverseResolver(store, config.ReverseDNS)
+	if reverseDNS != nil {
+		go reverseDNS.Run()
+	}
 
 	// Set up syslog server
 	syslogPort := os.Getenv("HOSTLOG_SYSLOG_PORT")
@@ -35,34 +117,109 @@ func main() {
 		syslogPort = "514"
 	}
 
-	channel := make(syslog.LogPartsChannel)
-	handler := syslog.NewChannelHandler(channel)
-
-	server := syslog.NewServer()
-	server.SetFormat(syslog.RFC3164)
-	server.SetHandler(handler)
-	server.ListenTCP("0.0.0.0:" + syslogPort)
-	server.ListenUDP("0.0.0.0:" + syslogPort)
-	err = server.Boot()
-	if err != nil {
-		log.Fatalf("Failed to start syslog server: %v", err)
+	// Each listener has a server of its own, so that its sources are filtered by its lists
+	channel := make(syslog.LogPartsChannel, ingestQueueSize)
+	health := NewHealth(store, channel)
+	var servers []*syslog.Server
+	for _, listener := range []string{ListenerTCP, ListenerUDP} {
+		received := make(syslog.LogPartsChannel)
+		server := syslog.NewServer()
+		server.SetFormat(syslog.RFC3164)
+		server.SetHandler(metricsHandler{listener: listener, next: syslog.NewChannelHandler(received)})
+		if listener == ListenerTCP {
+			err = server.ListenTCP("0.0.0.0:" + syslogPort)
+		} else {
+			err = server.ListenUDP("0.0.0.0:" + syslogPort)
+		}
+		health.Listening(listener, err)
+		if err != nil {
+			// Reported by /readyz while the other listener keeps running
+			log.Printf("Error listening on %s port %s: %v", listener, syslogPort, err)
+			continue
+		}
+		if err := server.Boot(); err != nil {
+			log.Fatalf("Failed to start syslog server: %v", err)
+		}
+		servers = append(servers, server)
+		go sources.Relay(listener, received, channel)
+	}
+	if len(servers) == 0 {
+		log.Fatalf("Failed to start syslog server: no listener bound port %s", syslogPort)
 	}
 
+	metrics.Listen("0.0.0.0:" + syslogPort)
 	fmt.Printf("Syslog server started. Listening on port %s...\n", syslogPort)
 
+	// Summarize the messages over the rate limits
+	go limiter.Run(channel)
+
 	// Process incoming log messages
 	go func(channel syslog.LogPartsChannel) {
 		for logParts := range channel {
+			listener := receivedOn(logParts)
+			unknown := fromUnknownSource(logParts)
+			if !limiter.Allow(logParts, time.Now()) {
+				metrics.Dropped(listener, DropRateLimited)
+				continue
+			}
+
 			// Save log message to database
-			if logEntry, err := models.SaveLog(logParts); err != nil {
+			started := time.Now()
+			if logEntry, err := store.SaveLog(logParts); err != nil {
+				metrics.FailedWrite(listener, time.Since(started))
 				log.Printf("Error saving log: %v", err)
 			} else {
+				metrics.Stored(listener, logEntry.ClientIP, time.Since(started))
+
+				// Extract fields before the log is shown or evaluated; a repeat has them stored already
+				logEntry.Fields = parsers.Parse(logEntry)
+				if unknown {
+					logEntry.Fields = append(logEntry.Fields, unknownSourceField)
+				}
+				if logEntry.Repeats == 1 {
+					if err := store.SaveFields(logEntry.ID, logEntry.Fields); err != nil {
+						log.Printf("Error saving fields: %v", err)
+					}
+				}
+
+				// A repeat updates its row, but counts, alerts and relays as the message received now
+				occurrence := logEntry
+				occurrence.ReceivedAt = logEntry.LastReceived()
+
+				// Count the message towards its pattern for the digest
+				if err := store.SaveLogPattern(occurrence.ClientIP, occurrence.Content, occurrence.ReceivedAt); err != nil {
+					log.Printf("Error saving pattern: %v", err)
+				}
+
+				// Count the packets logged by router firewalls
+				if event, ok := parseNetfilter(occurrence); ok {
+					if err := store.SaveFirewallEvent(&event); err != nil {
+						log.Printf("Error saving firewall event: %v", err)
+					}
+				}
+
+				// Track logins for brute-force detection
+				if event, ok := parseAuth(occurrence); ok {
+					if err := store.SaveAuthEvent(&event); err != nil {
+						log.Printf("Error saving login attempt: %v", err)
+					}
+				}
+
 				// Send to SSE broadcaster
 				logBroadcaster.Messages <- logEntry
 
+				// Evaluate alert rules
+				alertEngine.Observe(occurrence)
+
+				// Relay to upstream collectors
+				forwarders.Forward(occurrence)
+
+				// Look up the sender's name in the background
+				reverseDNS.Observe(logEntry.ClientIP)
+
 				// Print a brief confirmation (optional)
-				if content, ok := logParts["content"].(string); ok {
-					fmt.Printf("Saved log: %s\n", content)
+				if logEntry.Content != "" {
+					fmt.Printf("Saved log: %s\n", logEntry.Content)
 				} else {
 					fmt.Println("Saved log entry")
 				}
@@ -76,17 +233,64 @@ func main() {
 		httpPort = "8080"
 	}
 
-	go StartHTTPServer("8080", staticFiles)
+	go StartHTTPServer(httpPort, staticFiles, store, hostGroups, limiter, sources, health)
 
-	server.Wait()
+	for _, server := range servers {
+		server.Wait()
+	}
 }
 
 func runMCPServer() {
-	_, err := models.InitDB()
+	// The stdio server shares the file with a running daemon, so it never
+	// migrates and only opens it writable when granted write access.
+	config, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	readOnly := !canWrite(os.Getenv("HOSTLOG_MCP_TOKEN"))
+	store, err := models.OpenDB(readOnly)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := config.Clock.Apply(store); err != nil {
+		log.Fatalf("Failed to set up clock: %v", err)
+	}
+	if err := config.Neighbors.Apply(store); err != nil {
+		log.Fatalf("Failed to read neighbor files: %v", err)
+	}
+	if err := config.Auth.Apply(store); err != nil {
+		log.Fatalf("Failed to set up brute-force detection: %v", err)
+	}
+	if err := config.Redaction.Apply(store); err != nil {
+		log.Fatalf("Failed to set up redaction: %v", err)
+	}
+	if err := config.Dedup.Apply(store); err != nil {
+		log.Fatalf("Failed to set up duplicate suppression: %v", err)
+	}
 
-	s := NewMCPServer()
-	server.ServeStdio(s)
+	hostGroups, err := NewHostGroups(store, config.Groups)
+	if err != nil {
+		log.Fatalf("Failed to set up host groups: %v", err)
+	}
+
+	s := NewMCPServer(store, hostGroups)
+	server.ServeStdio(s, server.WithStdioContextFunc(stdioWriteContext))
+}
+
+// updateVendors installs a vendor database next to the database, where it
+// replaces the embedded one on the next start
+func updateVendors(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open vendor database: %v", err)
+	}
+	defer file.Close()
+
+	dataDir := models.DataDirFromEnv()
+	count, err := models.UpdateVendors(dataDir, file)
+	if err != nil {
+		log.Fatalf("Failed to update vendor database: %v", err)
+	}
+	fmt.Printf("Wrote %d MAC vendor prefixes to %s\n", count, filepath.Join(dataDir, models.VendorsFile))
 }
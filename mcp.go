@@ -4,54 +4,182 @@ import (
 	"context"
 	"fmt"
 	"hostlog/models"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func NewMCPServer() *server.MCPServer {
+// mcpTools implements the MCP tools on top of one store
+type mcpTools struct {
+	store *models.Store
+	hosts *HostGroups
+}
+
+func NewMCPServer(store *models.Store, hosts *HostGroups) *server.MCPServer {
+	t := &mcpTools{store: store, hosts: hosts}
 	s := server.NewMCPServer(
 		"hostlog",
 		"1.0.0",
 		server.WithLogging(),
+		server.WithToolFilter(filterWriteTools),
+		server.WithToolHandlerMiddleware(requireWriteAccess),
+		server.WithToolHandlerMiddleware(t.redactResults),
 	)
 
 	// Tool to list all hosts
 	s.AddTool(mcp.NewTool("list_hosts",
-		mcp.WithDescription("List all hosts that have sent logs"),
-	), listHostsHandler)
+		mcp.WithDescription("List the host inventory: every device that has sent logs with its addresses, hostnames, tags and notes"),
+	), t.listHostsHandler)
 
 	// Tool to get logs for a specific host
 	s.AddTool(mcp.NewTool("get_logs",
 		mcp.WithDescription("Get recent logs, optionally filtered by host"),
 		mcp.WithArray("hosts", mcp.Description("Optional list of host IPs to filter by"), mcp.WithStringItems()),
-		mcp.WithNumber("page", mcp.Description("Page number (100 logs per page)"), mcp.DefaultNumber(0)),
-	), getLogsHandler)
+		mcp.WithArray("host_ids", mcp.Description("Optional list of host IDs from list_hosts to filter by, covering every address of each host"), mcp.WithNumberItems()),
+		mcp.WithArray("groups", mcp.Description("Optional list of host groups from list_groups to filter by, such as \"access-points\" or \"tag:camera\""), mcp.WithStringItems()),
+		mcp.WithArray("fields", mcp.Description("Optional list of extracted field conditions as name=value, such as \"SRC=192.168.1.20\"; all must match"), mcp.WithStringItems()),
+		mcp.WithString("before", mcp.Description("Cursor from a previous result; returns the 100 logs older than it")),
+		mcp.WithString("after", mcp.Description("Cursor from a previous result; returns the 100 logs newer than it")),
+		mcp.WithBoolean("count", mcp.Description("Also count all matching logs, which is slow on large databases"), mcp.DefaultBool(false)),
+		mcp.WithString("clock", mcp.Description("Which time to show: when hostlog received the log, the sender's timestamp, or the sender's unless its clock is skewed"),
+			mcp.Enum(string(models.ClockReceived), string(models.ClockDevice), string(models.ClockAuto))),
+	), t.getLogsHandler)
+
+	// Tool to list host groups
+	s.AddTool(mcp.NewTool("list_groups",
+		mcp.WithDescription("List host groups with their members and aggregated visibility scores; every host tag also forms a group named tag:<tag>"),
+	), t.listGroupsHandler)
 
 	// Tool to get host visibility scores
 	s.AddTool(mcp.NewTool("get_host_scores",
 		mcp.WithDescription("Get visibility scores for all hosts"),
-	), getHostScoresHandler)
+	), t.getHostScoresHandler)
+
+	// Tool to list alerts
+	s.AddTool(mcp.NewTool("get_alerts",
+		mcp.WithDescription("List alerts raised by alert rules; the alert key can be passed to acknowledge_alert"),
+		mcp.WithString("state", mcp.Description("Only list alerts in this state"), mcp.Enum(models.AlertFiring, models.AlertResolved)),
+	), t.getAlertsHandler)
+
+	// Tools to analyze the packets router firewalls blocked
+	s.AddTool(mcp.NewTool("get_blocked_sources",
+		mcp.WithDescription("List the source addresses whose packets router firewalls blocked most, with the number of distinct destination ports; many ports from one source suggest a scan"),
+		mcp.WithNumber("hours", mcp.Description("How many hours back to count"), mcp.DefaultNumber(24)),
+		mcp.WithNumber("limit", mcp.Description("Maximum number of sources"), mcp.DefaultNumber(10)),
+		mcp.WithArray("host_ids", mcp.Description("Optional list of router host IDs from list_hosts to count"), mcp.WithNumberItems()),
+	), t.getBlockedSourcesHandler)
+
+	s.AddTool(mcp.NewTool("get_blocked_ports",
+		mcp.WithDescription("List the destination ports router firewalls blocked most packets to, with the number of distinct sources"),
+		mcp.WithNumber("hours", mcp.Description("How many hours back to count"), mcp.DefaultNumber(24)),
+		mcp.WithNumber("limit", mcp.Description("Maximum number of ports"), mcp.DefaultNumber(10)),
+		mcp.WithArray("host_ids", mcp.Description("Optional list of router host IDs from list_hosts to count"), mcp.WithNumberItems()),
+	), t.getBlockedPortsHandler)
+
+	s.AddTool(mcp.NewTool("get_drop_rates",
+		mcp.WithDescription("Count the packets each router's firewall blocked per time interval, to spot bursts such as scans"),
+		mcp.WithNumber("hours", mcp.Description("How many hours back to count"), mcp.DefaultNumber(24)),
+		mcp.WithNumber("interval_minutes", mcp.Description("Width of each interval in minutes"), mcp.DefaultNumber(60)),
+		mcp.WithArray("host_ids", mcp.Description("Optional list of router host IDs from list_hosts to count"), mcp.WithNumberItems()),
+	), t.getDropRatesHandler)
+
+	// Tool to list login failures and brute-force attacks
+	s.AddTool(mcp.NewTool("get_auth_failures",
+		mcp.WithDescription("List login attempts (SSH, LuCI, su and sudo) per source address and target host, most failures first, flagging the sources whose failures cross the brute-force thresholds right now"),
+		mcp.WithNumber("hours", mcp.Description("How many hours back to count"), mcp.DefaultNumber(24)),
+		mcp.WithArray("host_ids", mcp.Description("Optional list of target host IDs from list_hosts"), mcp.WithNumberItems()),
+	), t.getAuthFailuresHandler)
+
+	// Tool to count the secrets redacted from logs
+	s.AddTool(mcp.NewTool("get_redactions",
+		mcp.WithDescription("Count the secrets each redaction rule replaced in messages before they were stored, and in the output of this MCP server"),
+	), t.getRedactionsHandler)
+
+	addWriteTools(s, t)
 
 	return s
 }
 
-func listHostsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	hosts, err := models.GetAllHosts()
+// redactResults applies the MCP redaction rules to the text of every tool result
+func (t *mcpTools) redactResults(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if result == nil {
+			return result, err
+		}
+		for i, content := range result.Content {
+			if text, ok := content.(mcp.TextContent); ok {
+				text.Text, _ = t.store.MCPRedactor.Redact(text.Text)
+				result.Content[i] = text
+			}
+		}
+		return result, err
+	}
+}
+
+func (t *mcpTools) listHostsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	hosts, err := t.store.GetHosts()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get hosts: %v", err)), nil
 	}
 
+	notes, err := t.store.GetHostAnnotations()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get annotations: %v", err)), nil
+	}
+
+	skews, err := t.store.GetSkewedClocks()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get clock skews: %v", err)), nil
+	}
+
 	text := "Hosts:\n"
 	for _, host := range hosts {
-		text += fmt.Sprintf("- %s\n", host)
+		text += fmt.Sprintf("- #%d %s: %s\n", host.ID, host.DisplayName(), strings.Join(host.AddressLabels(), ", "))
+		if hostnames := host.HostnameList(); len(hostnames) > 0 {
+			text += fmt.Sprintf("  hostnames: %s\n", strings.Join(hostnames, ", "))
+		}
+		if host.Neighbor.MAC != "" {
+			text += fmt.Sprintf("  MAC: %s\n", host.Neighbor.MAC)
+			if host.Neighbor.Vendor != "" {
+				text += fmt.Sprintf("  vendor: %s\n", host.Neighbor.Vendor)
+			}
+		}
+		if len(host.Neighbor.Names) > 0 {
+			text += fmt.Sprintf("  router names: %s\n", strings.Join(host.Neighbor.Names, ", "))
+		}
+		if tags := host.TagList(); len(tags) > 0 {
+			text += fmt.Sprintf("  tags: %s\n", strings.Join(tags, ", "))
+		}
+		text += fmt.Sprintf("  seen %s to %s\n",
+			host.FirstSeen.Format("2006-01-02 15:04:05"),
+			host.LastSeen.Format("2006-01-02 15:04:05"))
+		if host.Notes != "" {
+			text += fmt.Sprintf("  notes: %s\n", host.Notes)
+		}
+		for _, address := range host.AddressList() {
+			if skew, ok := skews[address]; ok {
+				text += fmt.Sprintf("  clock at %s skewed by %s; its own timestamps are not trusted\n", address, formatSkew(skew.Skew))
+			}
+			for _, note := range notes[address] {
+				text += fmt.Sprintf("  note on %s: %s\n", address, note.Text)
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		text += "No hosts found."
 	}
 
 	return mcp.NewToolResultText(text), nil
 }
 
-func getLogsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	var hosts []string
+func (t *mcpTools) getLogsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var filter models.LogFilter
 	// request.Params.Arguments is any, usually map[string]interface{}
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
@@ -63,43 +191,126 @@ func getLogsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 		if slice, ok := h.([]interface{}); ok {
 			for _, v := range slice {
 				if s, ok := v.(string); ok {
-					hosts = append(hosts, s)
+					filter.Hosts = append(filter.Hosts, s)
+				}
+			}
+		}
+	}
+	if h, ok := args["host_ids"]; ok {
+		if slice, ok := h.([]interface{}); ok {
+			for _, v := range slice {
+				if id, ok := v.(float64); ok && id > 0 {
+					filter.HostIDs = append(filter.HostIDs, uint(id))
 				}
 			}
 		}
 	}
 
-	page := 0
-	if p, ok := args["page"]; ok {
-		if f, ok := p.(float64); ok {
-			page = int(f)
+	if groups := request.GetStringSlice("groups", nil); len(groups) > 0 {
+		members, err := t.hosts.HostIDs(groups)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		filter.HostIDs = append(members, filter.HostIDs...)
+	}
+	for _, value := range request.GetStringSlice("fields", nil) {
+		match, err := models.ParseFieldMatch(value)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		filter.Fields = append(filter.Fields, match)
+	}
+
+	clock, err := models.ParseClock(request.GetString("clock", string(t.store.Clock)))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var before, after *models.Cursor
+	if cursor := request.GetString("before", ""); cursor != "" {
+		if before, err = models.ParseCursor(cursor); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	if cursor := request.GetString("after", ""); cursor != "" {
+		if after, err = models.ParseCursor(cursor); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
 		}
 	}
 
-	logs, _, err := models.GetFilteredLogs(hosts, page)
+	page, err := t.store.GetFilteredLogs(filter, before, after, request.GetBool("count", false))
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get logs: %v", err)), nil
 	}
+	logs := page.Logs
+
+	annotations, err := t.store.GetAnnotationsForLogs(logIDs(logs))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get annotations: %v", err)), nil
+	}
+
+	var skews map[string]models.ClockSkew
+	if len(logs) > 0 {
+		if skews, err = t.store.GetClockSkews(logHosts(logs)); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get clock skews: %v", err)), nil
+		}
+	}
 
-	text := fmt.Sprintf("Logs (Page %d):\n", page)
+	hosts, err := t.store.GetHostsByID(logHostIDs(logs))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get hosts: %v", err)), nil
+	}
+
+	fields, err := t.store.GetFieldsForLogs(logIDs(logs))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get fields: %v", err)), nil
+	}
+
+	text := "Logs:\n"
+	if page.Total >= 0 {
+		text = fmt.Sprintf("Logs (%d matching):\n", page.Total)
+	}
 	for _, l := range logs {
 		severity, _ := getSeverityInfo(l.Priority)
-		text += fmt.Sprintf("[%s] %s [%s]: %s\n",
-			l.Timestamp.Format("2006-01-02 15:04:05"),
-			l.ClientIP,
+		text += fmt.Sprintf("#%d [%s] %s [%s]: %s\n",
+			l.ID,
+			l.Time(t.store.ResolveClock(clock, skews[l.ClientIP])).Format("2006-01-02 15:04:05"),
+			hostLabel(hosts, l),
 			severity,
 			l.Content)
+		if l.Repeats > 1 {
+			text += fmt.Sprintf("  repeated %d times, last at %s\n", l.Repeats, l.LastReceived().Format("2006-01-02 15:04:05"))
+		}
+		for _, found := range t.store.Vendors.Annotate(l.Content) {
+			text += fmt.Sprintf("  MAC %s: %s\n", found.MAC, found.Vendor)
+		}
+		if len(fields[l.ID]) > 0 {
+			pairs := make([]string, 0, len(fields[l.ID]))
+			for _, field := range fields[l.ID] {
+				pairs = append(pairs, models.FieldMatch{Name: field.Name, Value: field.Value}.String())
+			}
+			text += fmt.Sprintf("  fields: %s\n", strings.Join(pairs, ", "))
+		}
+		for _, annotation := range annotations[l.ID] {
+			text += fmt.Sprintf("  note: %s\n", annotation.Text)
+		}
 	}
 
 	if len(logs) == 0 {
 		text += "No logs found."
 	}
+	if page.Older != nil {
+		text += fmt.Sprintf("Older logs: before=%s\n", page.Older)
+	}
+	if page.Newer != nil {
+		text += fmt.Sprintf("Newer logs: after=%s\n", page.Newer)
+	}
 
 	return mcp.NewToolResultText(text), nil
 }
 
-func getHostScoresHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	hostScores, err := GetAllHostScores()
+func (t *mcpTools) getHostScoresHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	hostScores, err := GetAllHostScores(t.store)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get host scores: %v", err)), nil
 	}
@@ -115,3 +326,239 @@ func getHostScoresHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 
 	return mcp.NewToolResultText(text), nil
 }
+
+func (t *mcpTools) listGroupsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	hosts, err := t.store.GetHosts()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get hosts: %v", err)), nil
+	}
+
+	hostScores, err := GetAllHostScores(t.store)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get host scores: %v", err)), nil
+	}
+	groupScores, err := t.hosts.GetGroupScores(hostScores)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get group scores: %v", err)), nil
+	}
+
+	text := "Host Groups:\n"
+	for _, score := range groupScores {
+		group, _ := t.hosts.Find(score.Group)
+		var members []string
+		for _, member := range group.Members(hosts) {
+			members = append(members, fmt.Sprintf("#%d %s", member.ID, member.DisplayName()))
+		}
+		text += fmt.Sprintf("- %s: %d hosts", score.Group, len(members))
+		if score.Hosts > 0 {
+			text += fmt.Sprintf(", mean score %.2f, highest %.2f (%s)", score.Score, score.Max, score.MaxHost)
+		}
+		text += "\n"
+		if len(members) > 0 {
+			text += fmt.Sprintf("  members: %s\n", strings.Join(members, ", "))
+		}
+	}
+
+	if len(groupScores) == 0 {
+		text += "No host groups found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+func (t *mcpTools) getAlertsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	alerts, err := t.store.GetAlerts(request.GetString("state", ""))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get alerts: %v", err)), nil
+	}
+
+	text := "Alerts:\n"
+	for _, alert := range alerts {
+		text += fmt.Sprintf("- %s [%s] since %s: %s\n",
+			alert.Fingerprint,
+			alert.State,
+			alert.StartsAt.Format("2006-01-02 15:04:05"),
+			alert.Summary)
+	}
+
+	if len(alerts) == 0 {
+		text += "No alerts found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+// firewallQuery reads the period, limit and routers of a firewall tool request
+func firewallQuery(request mcp.CallToolRequest) models.FirewallQuery {
+	query := models.FirewallQuery{
+		Since: time.Now().Add(-time.Duration(max(request.GetInt("hours", 24), 1)) * time.Hour),
+		Limit: max(request.GetInt("limit", 10), 1),
+	}
+	for _, id := range request.GetIntSlice("host_ids", nil) {
+		if id > 0 {
+			query.HostIDs = append(query.HostIDs, uint(id))
+		}
+	}
+	return query
+}
+
+func (t *mcpTools) getBlockedSourcesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sources, err := t.store.TopBlockedSources(firewallQuery(request))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get blocked sources: %v", err)), nil
+	}
+
+	text := "Blocked sources:\n"
+	for _, source := range sources {
+		text += fmt.Sprintf("- %s: %d packets to %d ports, last at %s\n",
+			source.Src, source.Count, source.Ports, source.Last.Format("2006-01-02 15:04:05"))
+	}
+
+	if len(sources) == 0 {
+		text += "No blocked packets found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+func (t *mcpTools) getBlockedPortsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ports, err := t.store.TopBlockedPorts(firewallQuery(request))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get blocked ports: %v", err)), nil
+	}
+
+	text := "Blocked destination ports:\n"
+	for _, port := range ports {
+		text += fmt.Sprintf("- %s/%d: %d packets from %d sources\n", port.Proto, port.DstPort, port.Count, port.Sources)
+	}
+
+	if len(ports) == 0 {
+		text += "No blocked packets found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+func (t *mcpTools) getDropRatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query := firewallQuery(request)
+	interval := time.Duration(max(request.GetInt("interval_minutes", 60), 1)) * time.Minute
+
+	rates, err := t.store.GetDropRates(query, interval)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get drop rates: %v", err)), nil
+	}
+
+	routers := make(map[uint][]models.DropRate)
+	for _, rate := range rates {
+		routers[rate.HostID] = append(routers[rate.HostID], rate)
+	}
+	hosts, err := t.store.GetHostsByID(slices.Sorted(maps.Keys(routers)))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get hosts: %v", err)), nil
+	}
+
+	series := dropRateSeries(rates, query.Since, time.Now(), interval)
+	text := fmt.Sprintf("Blocked packets per %s:\n", interval)
+	for _, id := range slices.Sorted(maps.Keys(routers)) {
+		var total int64
+		for _, rate := range routers[id] {
+			total += rate.Count
+		}
+		text += fmt.Sprintf("- #%d %s: %d packets %s\n", id, hosts[id].DisplayName(), total, sparkline(series[id]))
+		for _, rate := range routers[id] {
+			text += fmt.Sprintf("  %s: %d\n", rate.Bucket.Format("2006-01-02 15:04"), rate.Count)
+		}
+	}
+
+	if len(routers) == 0 {
+		text += "No blocked packets found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+func (t *mcpTools) getAuthFailuresHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	now := time.Now()
+	hours := max(request.GetInt("hours", 24), 1)
+	query := models.AuthQuery{Since: now.Add(-time.Duration(hours) * time.Hour)}
+	for _, id := range request.GetIntSlice("host_ids", nil) {
+		if id > 0 {
+			query.HostIDs = append(query.HostIDs, uint(id))
+		}
+	}
+
+	summaries, err := t.store.GetAuthSummaries(query)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get login attempts: %v", err)), nil
+	}
+	attacks, err := t.store.GetBruteForce(now)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get brute-force attacks: %v", err)), nil
+	}
+
+	var hostIDs []uint
+	for _, summary := range append(summaries, attacks...) {
+		if !slices.Contains(hostIDs, summary.HostID) {
+			hostIDs = append(hostIDs, summary.HostID)
+		}
+	}
+	hosts, err := t.store.GetHostsByID(hostIDs)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get hosts: %v", err)), nil
+	}
+	describe := func(summary models.AuthSummary) string {
+		source := summary.Src
+		if source == "" {
+			source = "local"
+		}
+		return fmt.Sprintf("%s -> #%d %s: %d failed, %d succeeded, %d users tried, last at %s",
+			source, summary.HostID, hosts[summary.HostID].DisplayName(),
+			summary.Failures, summary.Successes, summary.Users, summary.Last.Format("2006-01-02 15:04:05"))
+	}
+
+	thresholds := t.store.BruteForce
+	text := fmt.Sprintf("Brute-force attacks (%d failures or %d users within %s):\n", thresholds.Failures, thresholds.Users, thresholds.Window)
+	for _, attack := range attacks {
+		text += fmt.Sprintf("- %s\n", describe(attack))
+	}
+	if len(attacks) == 0 {
+		text += "None.\n"
+	}
+
+	text += fmt.Sprintf("\nLogin attempts in the last %d hours:\n", hours)
+	for _, summary := range summaries {
+		text += fmt.Sprintf("- %s\n", describe(summary))
+	}
+	if len(summaries) == 0 {
+		text += "No login attempts found."
+	}
+
+	return mcp.NewToolResultText(text), nil
+}
+
+func (t *mcpTools) getRedactionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	stored, err := t.store.GetRedactionCounts()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get redaction counts: %v", err)), nil
+	}
+
+	// describe lists the configured rules first, then rules no longer configured that still have counts
+	describe := func(title string, rules []string, counts map[string]int64) string {
+		text := title + ":\n"
+		for _, name := range slices.Sorted(maps.Keys(counts)) {
+			if !slices.Contains(rules, name) {
+				rules = append(rules, name)
+			}
+		}
+		for _, name := range rules {
+			text += fmt.Sprintf("- %s: %d\n", name, counts[name])
+		}
+		if len(rules) == 0 {
+			text += "No rules.\n"
+		}
+		return text
+	}
+	text := describe("Redacted at ingest", t.store.Redactor.Rules(), stored)
+	text += describe("Redacted from MCP output since start", t.store.MCPRedactor.Rules(), t.store.MCPRedactor.Counts())
+	return mcp.NewToolResultText(text), nil
+}
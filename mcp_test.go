@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"hostlog/models"
+)
+
+// callTool calls a tool through the server's middleware and returns the text of its result
+func callTool(t *testing.T, ctx context.Context, s *server.MCPServer, name string, args map[string]interface{}) (string, bool) {
+	t.Helper()
+	message, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  mcp.MethodToolsCall,
+		"params":  map[string]interface{}{"name": name, "arguments": args},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	response, ok := s.HandleMessage(ctx, message).(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("Expected a result from %s", name)
+	}
+	result := response.Result.(mcp.CallToolResult)
+	var text string
+	for _, content := range result.Content {
+		if c, ok := content.(mcp.TextContent); ok {
+			text += c.Text
+		}
+	}
+	return text, result.IsError
+}
+
+// TestReadOnlyDBDoesNotMigrate verifies that opening a database read-only leaves the schema untouched
+func TestReadOnlyDBDoesNotMigrate(t *testing.T) {
+	t.Parallel()
+
+	reader, err := models.OpenStore(filepath.Join(t.TempDir(), "logs.db"), true)
+	if err != nil {
+		t.Fatalf("Failed to open read-only database: %v", err)
+	}
+	defer reader.Close()
+
+	if reader.DB.Migrator().HasTable(&models.Log{}) {
+		t.Error("Expected read-only open not to create the logs table")
+	}
+}
+
+// TestConcurrentIngestAndMCPQueries runs a writer and the MCP read tools against one database file
+func TestConcurrentIngestAndMCPQueries(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	// The daemon owns the schema and writes through its own connection
+	writer, err := models.OpenStore(dbPath, false)
+	if err != nil {
+		t.Fatalf("Failed to open writer database: %v", err)
+	}
+	defer writer.Close()
+	if err := writer.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	reader, err := models.OpenStore(dbPath, true)
+	if err != nil {
+		t.Fatalf("Failed to open read-only database: %v", err)
+	}
+	defer reader.Close()
+
+	// The MCP tools read through their own handle
+	tools := &mcpTools{store: reader, hosts: &HostGroups{store: reader}}
+
+	const total = 300
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	writeErrs := make(chan error, total)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < total; i++ {
+			log := models.Log{
+				ClientIP:   fmt.Sprintf("192.168.1.%d", i%5+1),
+				Content:    fmt.Sprintf("concurrent log %d", i),
+				Priority:   i % 8,
+				DeviceTime: time.Now(),
+			}
+			if err := writer.DB.Create(&log).Error; err != nil {
+				writeErrs <- err
+				return
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	queries := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		for name, handler := range map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+			"list_hosts": tools.listHostsHandler,
+			"get_logs":   tools.getLogsHandler,
+		} {
+			result, err := handler(ctx, mcp.CallToolRequest{})
+			if err != nil {
+				t.Fatalf("%s returned an error: %v", name, err)
+			}
+			if result.IsError {
+				t.Fatalf("%s returned an error result: %v", name, result.Content)
+			}
+		}
+		queries++
+	}
+	wg.Wait()
+	close(writeErrs)
+
+	for err := range writeErrs {
+		t.Fatalf("Writer failed while MCP queries were running: %v", err)
+	}
+	t.Logf("Ran %d MCP query rounds during ingest", queries)
+
+	var count int64
+	if err := reader.DB.Model(&models.Log{}).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count logs: %v", err)
+	}
+	if count != total {
+		t.Errorf("Expected %d logs, got %d", total, count)
+	}
+
+	// The read-only handle must reject writes
+	if err := reader.DB.Create(&models.Log{ClientIP: "10.0.0.1"}).Error; err == nil {
+		t.Error("Expected write through read-only database to fail")
+	}
+}
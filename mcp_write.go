@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"hostlog/models"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type mcpWriteKey struct{}
+
+// writeTools lists the MCP tools that modify state and require a write-capable token
+var writeTools = map[string]bool{
+	"annotate":          true,
+	"acknowledge_alert": true,
+	"create_silence":    true,
+	"update_host":       true,
+}
+
+// mcpWriteToken returns the configured write-capable token; writes are disabled when it is empty
+func mcpWriteToken() string {
+	return os.Getenv("HOSTLOG_MCP_WRITE_TOKEN")
+}
+
+// canWrite reports whether the presented token grants write access. The tokens are
+// compared as digests, so that neither their contents nor their lengths show in the timing.
+func canWrite(token string) bool {
+	writeToken := mcpWriteToken()
+	presented := sha256.Sum256([]byte(token))
+	expected := sha256.Sum256([]byte(writeToken))
+	matches := subtle.ConstantTimeCompare(presented[:], expected[:]) == 1
+	return matches && writeToken != "" && token != ""
+}
+
+// withWriteAccess stores the write permission in the context
+func withWriteAccess(ctx context.Context, allowed bool) context.Context {
+	return context.WithValue(ctx, mcpWriteKey{}, allowed)
+}
+
+func hasWriteAccess(ctx context.Context) bool {
+	allowed, _ := ctx.Value(mcpWriteKey{}).(bool)
+	return allowed
+}
+
+// sseWriteContext grants write access to SSE clients presenting the token as a bearer header
+func sseWriteContext(ctx context.Context, r *http.Request) context.Context {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return withWriteAccess(ctx, ok && canWrite(token))
+}
+
+// stdioWriteContext grants write access to the stdio server when HOSTLOG_MCP_TOKEN holds the write token
+func stdioWriteContext(ctx context.Context) context.Context {
+	return withWriteAccess(ctx, canWrite(os.Getenv("HOSTLOG_MCP_TOKEN")))
+}
+
+// filterWriteTools hides write tools from clients without write access
+func filterWriteTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if hasWriteAccess(ctx) {
+		return tools
+	}
+	var filtered []mcp.Tool
+	for _, tool := range tools {
+		if !writeTools[tool.Name] {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// requireWriteAccess rejects calls to write tools from clients without write access
+func requireWriteAccess(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if writeTools[request.Params.Name] && !hasWriteAccess(ctx) {
+			return mcp.NewToolResultError("This tool requires a write-capable API token"), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+func addWriteTools(s *server.MCPServer, t *mcpTools) {
+	// Tool to annotate a log entry or a host
+	s.AddTool(mcp.NewTool("annotate",
+		mcp.WithDescription("Attach a note to a log entry or a host, e.g. \"known issue, firmware bug\""),
+		mcp.WithString("text", mcp.Description("Note text"), mcp.Required()),
+		mcp.WithNumber("log_id", mcp.Description("ID of the log entry to annotate")),
+		mcp.WithString("host", mcp.Description("Host IP to annotate")),
+		mcp.WithString("author", mcp.Description("Who is writing the note"), mcp.DefaultString("mcp")),
+		mcp.WithDestructiveHintAnnotation(false),
+	), t.annotateHandler)
+
+	// Tool to acknowledge an alert
+	s.AddTool(mcp.NewTool("acknowledge_alert",
+		mcp.WithDescription("Acknowledge an alert so it no longer demands attention"),
+		mcp.WithString("alert", mcp.Description("Alert key to acknowledge"), mcp.Required()),
+		mcp.WithString("comment", mcp.Description("Optional comment")),
+		mcp.WithString("author", mcp.Description("Who is acknowledging"), mcp.DefaultString("mcp")),
+		mcp.WithDestructiveHintAnnotation(false),
+	), t.acknowledgeAlertHandler)
+
+	// Tool to mute a noisy pattern for a while
+	s.AddTool(mcp.NewTool("create_silence",
+		mcp.WithDescription("Mute messages matching a host and/or content regex for a limited time"),
+		mcp.WithString("host", mcp.Description("Host IP to silence; empty silences all hosts")),
+		mcp.WithString("pattern", mcp.Description("Regular expression matched against message content")),
+		mcp.WithNumber("duration_minutes", mcp.Description("How long the silence lasts"), mcp.DefaultNumber(60)),
+		mcp.WithString("comment", mcp.Description("Why the messages are silenced")),
+		mcp.WithString("author", mcp.Description("Who is creating the silence"), mcp.DefaultString("mcp")),
+		mcp.WithDestructiveHintAnnotation(false),
+	), t.createSilenceHandler)
+
+	// Tool to name, tag and describe an inventory host
+	s.AddTool(mcp.NewTool("update_host",
+		mcp.WithDescription("Set the display name, tags and notes of a host from list_hosts; omitted fields are kept"),
+		mcp.WithNumber("host_id", mcp.Description("ID of the host"), mcp.Required()),
+		mcp.WithString("name", mcp.Description("Display name; empty shows the latest hostname")),
+		mcp.WithArray("tags", mcp.Description("Tags, replacing the current ones"), mcp.WithStringItems()),
+		mcp.WithString("notes", mcp.Description("Free-form notes, replacing the current ones")),
+		mcp.WithDestructiveHintAnnotation(false),
+	), t.updateHostHandler)
+}
+
+func (t *mcpTools) annotateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	text, err := request.RequireString("text")
+	if err != nil || strings.TrimSpace(text) == "" {
+		return mcp.NewToolResultError("text is required"), nil
+	}
+
+	annotation := models.Annotation{
+		LogID:     uint(request.GetInt("log_id", 0)),
+		ClientIP:  request.GetString("host", ""),
+		Text:      text,
+		CreatedBy: request.GetString("author", "mcp"),
+	}
+	if annotation.LogID == 0 && annotation.ClientIP == "" {
+		return mcp.NewToolResultError("Either log_id or host is required"), nil
+	}
+
+	if err := t.store.SaveAnnotation(&annotation); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to save annotation: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Annotation %d saved.", annotation.ID)), nil
+}
+
+func (t *mcpTools) acknowledgeAlertHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	alertKey, err := request.RequireString("alert")
+	if err != nil || alertKey == "" {
+		return mcp.NewToolResultError("alert is required"), nil
+	}
+
+	ack := models.Acknowledgement{
+		AlertKey:  alertKey,
+		Comment:   request.GetString("comment", ""),
+		CreatedBy: request.GetString("author", "mcp"),
+	}
+	if err := t.store.SaveAcknowledgement(&ack); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to acknowledge alert: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Alert %s acknowledged.", alertKey)), nil
+}
+
+func (t *mcpTools) createSilenceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	silence := models.Silence{
+		ClientIP:  request.GetString("host", ""),
+		Pattern:   request.GetString("pattern", ""),
+		Comment:   request.GetString("comment", ""),
+		CreatedBy: request.GetString("author", "mcp"),
+	}
+	if silence.ClientIP == "" && silence.Pattern == "" {
+		return mcp.NewToolResultError("Either host or pattern is required"), nil
+	}
+	minutes := request.GetInt("duration_minutes", 60)
+	if minutes <= 0 {
+		return mcp.NewToolResultError("duration_minutes must be positive"), nil
+	}
+	silence.ExpiresAt = time.Now().Add(time.Duration(minutes) * time.Minute)
+
+	if err := t.store.SaveSilence(&silence); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to save silence: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Silence %d active until %s.",
+		silence.ID, silence.ExpiresAt.Format("2006-01-02 15:04:05"))), nil
+}
+
+func (t *mcpTools) updateHostHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id := request.GetInt("host_id", 0)
+	if id <= 0 {
+		return mcp.NewToolResultError("host_id is required"), nil
+	}
+
+	host, err := t.store.GetHost(uint(id))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get host %d: %v", id, err)), nil
+	}
+
+	host, err = t.store.UpdateHost(host.ID,
+		request.GetString("name", host.Name),
+		request.GetStringSlice("tags", host.TagList()),
+		request.GetString("notes", host.Notes))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to update host: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Host %d is now %s.", host.ID, host.DisplayName())), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const testWriteToken = "s3cret-write-token-0123456789abcdef"
+
+// listTools returns the names of the tools the server lists in ctx
+func listTools(t *testing.T, ctx context.Context, s *server.MCPServer) []string {
+	t.Helper()
+	message, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": mcp.MethodToolsList})
+	response, ok := s.HandleMessage(ctx, message).(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatal("Expected a tool list")
+	}
+	var names []string
+	for _, tool := range response.Result.(mcp.ListToolsResult).Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+// TestMCPWriteAccess lists and accepts write tools only for clients presenting the write token over SSE or stdio
+func TestMCPWriteAccess(t *testing.T) {
+	t.Setenv("HOSTLOG_MCP_WRITE_TOKEN", testWriteToken)
+	store := openTestDB(t)
+	s := NewMCPServer(store, &HostGroups{store: store})
+
+	sse := func(authorization string) context.Context {
+		r := httptest.NewRequest("GET", "/mcp/sse", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		return sseWriteContext(context.Background(), r)
+	}
+	stdio := func(token string) context.Context {
+		t.Setenv("HOSTLOG_MCP_TOKEN", token)
+		return stdioWriteContext(context.Background())
+	}
+
+	for name, ctx := range map[string]context.Context{
+		"sse without a token":      sse(""),
+		"sse with a wrong token":   sse("Bearer " + testWriteToken[:len(testWriteToken)-1] + "x"),
+		"sse without the scheme":   sse(testWriteToken),
+		"stdio without a token":    stdio(""),
+		"stdio with a wrong token": stdio("not-the-token"),
+	} {
+		tools := listTools(t, ctx, s)
+		for tool := range writeTools {
+			if slices.Contains(tools, tool) {
+				t.Errorf("%s: expected %s to be hidden", name, tool)
+			}
+		}
+		if !slices.Contains(tools, "get_logs") {
+			t.Errorf("%s: expected the read tools listed, got %v", name, tools)
+		}
+
+		text, isError := callTool(t, ctx, s, "annotate", map[string]interface{}{"host": "192.168.1.1", "text": "rejected"})
+		if !isError || !strings.Contains(text, "write-capable") {
+			t.Errorf("%s: expected annotate to be rejected, got %q", name, text)
+		}
+	}
+
+	annotations, err := store.GetAnnotations()
+	if err != nil || len(annotations) != 0 {
+		t.Fatalf("Expected rejected calls to write nothing, got %v, %v", annotations, err)
+	}
+
+	for name, ctx := range map[string]context.Context{
+		"sse":   sse("Bearer " + testWriteToken),
+		"stdio": stdio(testWriteToken),
+	} {
+		tools := listTools(t, ctx, s)
+		for tool := range writeTools {
+			if !slices.Contains(tools, tool) {
+				t.Errorf("%s: expected %s to be listed", name, tool)
+			}
+		}
+
+		text, isError := callTool(t, ctx, s, "annotate", map[string]interface{}{"host": "192.168.1.1", "text": "accepted over " + name})
+		if isError {
+			t.Errorf("%s: expected annotate to be accepted, got %q", name, text)
+		}
+	}
+
+	annotations, err = store.GetAnnotations()
+	if err != nil || len(annotations) != 2 {
+		t.Errorf("Expected 2 annotations written, got %v, %v", annotations, err)
+	}
+
+	// Without a configured write token nobody can write, not even with an empty token
+	t.Setenv("HOSTLOG_MCP_WRITE_TOKEN", "")
+	if canWrite("") || canWrite(testWriteToken) {
+		t.Error("Expected writes disabled without a configured token")
+	}
+}
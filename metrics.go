@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlog/models"
+
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// Why messages are dropped before they are stored
+const (
+	DropRejected    = "rejected"     // By the source lists
+	DropRateLimited = "rate_limited" // Over the rate limits
+	DropStoreError  = "store_error"  // Failed to save
+)
+
+// listenerInternal is the listener of the messages hostlog logs itself, such as rate limit summaries
+const listenerInternal = "internal"
+
+// metricsMaxHosts bounds the hosts counted one by one, so that spoofed sources
+// cannot add series without end; further hosts are counted under metricsOtherHosts
+const metricsMaxHosts = 256
+
+// metricsOtherHosts counts the hosts over metricsMaxHosts
+const metricsOtherHosts = "other"
+
+// metricsScoreInterval is how long scrapes reuse the visibility scores
+const metricsScoreInterval = time.Minute
+
+// writeBuckets are the upper bounds of the database write latency histogram in seconds
+var writeBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Metrics counts what happens to the messages hostlog receives, for /metrics
+type Metrics struct {
+	mu          sync.Mutex
+	address     string              // Address the listeners listen on
+	received    map[string]int64    // By listener
+	parseErrors map[string]int64    // By listener
+	stored      map[string]int64    // By listener
+	dropped     map[[2]string]int64 // By listener and reason
+	hosts       map[string]int64    // Stored messages by client IP, up to metricsMaxHosts
+	writes      []int64             // Writes per bucket of writeBuckets, and above the last
+	writeSum    float64             // Seconds spent writing
+	writeCount  int64
+}
+
+// metrics is shared by the listeners, the ingest loop and the web server
+var metrics = NewMetrics()
+
+// NewMetrics returns empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		received:    make(map[string]int64),
+		parseErrors: make(map[string]int64),
+		stored:      make(map[string]int64),
+		dropped:     make(map[[2]string]int64),
+		hosts:       make(map[string]int64),
+		writes:      make([]int64, len(writeBuckets)+1),
+	}
+}
+
+// Listen records the address the listeners listen on
+func (m *Metrics) Listen(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.address = address
+}
+
+// Received counts a message a listener received, and whether it failed to parse
+func (m *Metrics) Received(listener string, parseError bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received[listener]++
+	if parseError {
+		m.parseErrors[listener]++
+	}
+}
+
+// Stored counts a stored message of a host and how long writing it took
+func (m *Metrics) Stored(listener, clientIP string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stored[listener]++
+	if _, ok := m.hosts[clientIP]; !ok && len(m.hosts) >= metricsMaxHosts {
+		clientIP = metricsOtherHosts
+	}
+	m.hosts[clientIP]++
+	m.observeWrite(took)
+}
+
+// Dropped counts a message that was not stored
+func (m *Metrics) Dropped(listener, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[[2]string{listener, reason}]++
+}
+
+// FailedWrite counts a write that failed and how long it took
+func (m *Metrics) FailedWrite(listener string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[[2]string{listener, DropStoreError}]++
+	m.observeWrite(took)
+}
+
+// observeWrite adds a write to the latency histogram
+func (m *Metrics) observeWrite(took time.Duration) {
+	seconds := took.Seconds()
+	bucket, _ := slices.BinarySearch(writeBuckets, seconds)
+	m.writes[bucket]++
+	m.writeSum += seconds
+	m.writeCount++
+}
+
+// metricsHandler counts the messages and parse errors of a listener before passing them on
+type metricsHandler struct {
+	listener string
+	next     syslog.Handler
+}
+
+func (h metricsHandler) Handle(logParts format.LogParts, length int64, err error) {
+	metrics.Received(h.listener, err != nil)
+	h.next.Handle(logParts, length, err)
+}
+
+// listenerLabel is the address of a listener
+func (m *Metrics) listenerLabel(listener string) string {
+	if listener == listenerInternal {
+		return listenerInternal
+	}
+	return m.address
+}
+
+// metricsWriter writes metrics in the Prometheus text format
+type metricsWriter struct {
+	w io.Writer
+}
+
+// family writes the header of a metric
+func (mw metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value of a metric with labels given as name, value pairs
+func (mw metricsWriter) sample(name string, value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(mw.w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Expose writes the counters in the Prometheus text format
+func (m *Metrics) Expose(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mw := metricsWriter{w}
+
+	perListener := func(name, help string, counts map[string]int64) {
+		mw.family(name, "counter", help)
+		for _, listener := range slices.Sorted(maps.Keys(counts)) {
+			mw.sample(name, float64(counts[listener]), "listener", m.listenerLabel(listener), "protocol", listener)
+		}
+	}
+	perListener("hostlog_messages_received_total", "Messages received per listener.", m.received)
+	perListener("hostlog_parse_errors_total", "Messages received per listener that failed to parse as syslog.", m.parseErrors)
+	perListener("hostlog_messages_stored_total", "Messages stored per listener.", m.stored)
+
+	mw.family("hostlog_messages_dropped_total", "counter", "Messages not stored per listener and reason.")
+	for _, key := range slices.SortedFunc(maps.Keys(m.dropped), func(a, b [2]string) int { return strings.Compare(a[0]+a[1], b[0]+b[1]) }) {
+		mw.sample("hostlog_messages_dropped_total", float64(m.dropped[key]), "listener", m.listenerLabel(key[0]), "protocol", key[0], "reason", key[1])
+	}
+
+	mw.family("hostlog_host_messages_total", "counter", "Messages stored per sending address.")
+	for _, host := range slices.Sorted(maps.Keys(m.hosts)) {
+		mw.sample("hostlog_host_messages_total", float64(m.hosts[host]), "host", host)
+	}
+
+	mw.family("hostlog_db_write_duration_seconds", "histogram", "Time taken to store a message.")
+	var cumulative int64
+	for i, bound := range writeBuckets {
+		cumulative += m.writes[i]
+		mw.sample("hostlog_db_write_duration_seconds_bucket", float64(cumulative), "le", strconv.FormatFloat(bound, 'g', -1, 64))
+	}
+	mw.sample("hostlog_db_write_duration_seconds_bucket", float64(m.writeCount), "le", "+Inf")
+	mw.sample("hostlog_db_write_duration_seconds_sum", m.writeSum)
+	mw.sample("hostlog_db_write_duration_seconds_count", float64(m.writeCount))
+}
+
+// scoreCache keeps the visibility scores for metricsScoreInterval, so that
+// scrapes do not score every host each time
+type scoreCache struct {
+	mu     sync.Mutex
+	at     time.Time
+	scores []HostScore
+}
+
+// get returns the cached scores, scoring the hosts when they are older than metricsScoreInterval
+func (c *scoreCache) get(store *models.Store, now time.Time) ([]HostScore, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.at.IsZero() && now.Sub(c.at) < metricsScoreInterval {
+		return c.scores, nil
+	}
+	scores, err := GetAllHostScores(store)
+	if err != nil {
+		return nil, err
+	}
+	c.at, c.scores = now, scores
+	return scores, nil
+}
+
+// handleMetrics serves the metrics of hostlog in the Prometheus text format
+func (ui *webUI) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Expose(w)
+	mw := metricsWriter{w}
+
+	mw.family("hostlog_sse_clients", "gauge", "Web clients following the live log stream.")
+	mw.sample("hostlog_sse_clients", float64(logBroadcaster.clientCount.Load()))
+	mw.family("hostlog_sse_dropped_total", "counter", "Live log messages not sent to a web client that was too slow.")
+	mw.sample("hostlog_sse_dropped_total", float64(logBroadcaster.dropped.Load()))
+
+	_, limited := ui.limiter.Stats()
+	mw.family("hostlog_rate_limited_total", "counter", "Messages over the rate limits per source.")
+	for _, stats := range limited {
+		mw.sample("hostlog_rate_limited_total", float64(stats.Limited), "source", stats.Source)
+	}
+
+	scores, err := ui.scores.get(ui.store, time.Now())
+	if err != nil {
+		log.Printf("Error retrieving host scores: %v", err)
+	}
+	mw.family("hostlog_host_visibility_score", "gauge", "Current visibility score per sending address.")
+	for _, score := range scores {
+		mw.sample("hostlog_host_visibility_score", score.Score, "host", score.Host)
+	}
+}
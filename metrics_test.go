@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// TestMetrics exposes counters per listener and host and the write latency histogram in the Prometheus text format
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics()
+	m.Listen("0.0.0.0:514")
+	for i := 0; i < 3; i++ {
+		m.Received(ListenerUDP, i == 0)
+	}
+	m.Received(ListenerTCP, false)
+	m.Stored(ListenerUDP, "192.168.1.1", 2*time.Millisecond)
+	m.Stored(ListenerTCP, "192.168.1.1", 30*time.Millisecond)
+	m.Stored(listenerInternal, "192.168.1.66", time.Millisecond)
+	m.Dropped(ListenerUDP, DropRateLimited)
+	m.FailedWrite(ListenerUDP, 5*time.Second)
+
+	var out strings.Builder
+	m.Expose(&out)
+	text := out.String()
+	for _, want := range []string{
+		"# TYPE hostlog_messages_received_total counter\n",
+		`hostlog_messages_received_total{listener="0.0.0.0:514",protocol="udp"} 3` + "\n",
+		`hostlog_messages_received_total{listener="0.0.0.0:514",protocol="tcp"} 1` + "\n",
+		`hostlog_parse_errors_total{listener="0.0.0.0:514",protocol="udp"} 1` + "\n",
+		`hostlog_messages_stored_total{listener="internal",protocol="internal"} 1` + "\n",
+		`hostlog_messages_dropped_total{listener="0.0.0.0:514",protocol="udp",reason="rate_limited"} 1` + "\n",
+		`hostlog_messages_dropped_total{listener="0.0.0.0:514",protocol="udp",reason="store_error"} 1` + "\n",
+		`hostlog_host_messages_total{host="192.168.1.1"} 2` + "\n",
+		"# TYPE hostlog_db_write_duration_seconds histogram\n",
+		`hostlog_db_write_duration_seconds_bucket{le="0.001"} 1` + "\n",
+		`hostlog_db_write_duration_seconds_bucket{le="0.0025"} 2` + "\n",
+		`hostlog_db_write_duration_seconds_bucket{le="0.05"} 3` + "\n",
+		`hostlog_db_write_duration_seconds_bucket{le="2.5"} 3` + "\n",
+		`hostlog_db_write_duration_seconds_bucket{le="+Inf"} 4` + "\n",
+		"hostlog_db_write_duration_seconds_count 4\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in\n%s", want, text)
+		}
+	}
+
+	// Hosts beyond the limit are counted together
+	for i := 0; i < metricsMaxHosts+10; i++ {
+		m.Stored(ListenerUDP, fmt.Sprintf("10.0.%d.%d", i/256, i%256), time.Millisecond)
+	}
+	out.Reset()
+	m.Expose(&out)
+	if hosts := strings.Count(out.String(), "hostlog_host_messages_total{"); hosts != metricsMaxHosts+1 {
+		t.Errorf("Expected %d host series, got %d", metricsMaxHosts+1, hosts)
+	}
+	if want := `hostlog_host_messages_total{host="other"} 12` + "\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in\n%s", want, out.String())
+	}
+
+	if escaped := escapeLabel("a\"b\\c\nd"); escaped != `a\"b\\c\nd` {
+		t.Errorf("Expected an escaped label, got %q", escaped)
+	}
+}
+
+// TestScoreCache scores the hosts at most once per interval
+func TestScoreCache(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	now := time.Now()
+	var cache scoreCache
+	if scores, err := cache.get(store, now); err != nil || len(scores) != 0 {
+		t.Fatalf("Expected no scores, got %v, %v", scores, err)
+	}
+	if err := store.DB.Create(&models.Log{ClientIP: "192.168.1.1", Content: "up", Priority: 6, ReceivedAt: now}).Error; err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+	if scores, _ := cache.get(store, now.Add(time.Second)); len(scores) != 0 {
+		t.Errorf("Expected the cached scores within the interval, got %v", scores)
+	}
+	if scores, _ := cache.get(store, now.Add(metricsScoreInterval)); len(scores) != 1 {
+		t.Errorf("Expected the host scored after the interval, got %v", scores)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert is the persisted state of one alert rule for one group of messages
+type Alert struct {
+	gorm.Model
+	Fingerprint    string `gorm:"uniqueIndex"`
+	Rule           string `gorm:"index"`
+	ClientIP       string
+	HostGroup      string
+	State          string `gorm:"index"`
+	Summary        string
+	Count          int
+	StartsAt       time.Time
+	EndsAt         time.Time
+	LastNotifiedAt time.Time
+}
+
+func (s *Store) SaveAlert(alert *Alert) error {
+	return s.DB.Save(alert).Error
+}
+
+func (s *Store) GetAlert(fingerprint string) (Alert, error) {
+	var alert Alert
+	result := s.DB.Where("fingerprint = ?", fingerprint).First(&alert)
+	return alert, result.Error
+}
+
+// GetAlerts returns alerts in the given state, or all alerts when state is empty, most recent first
+func (s *Store) GetAlerts(state string) ([]Alert, error) {
+	var alerts []Alert
+	query := s.DB.Order("starts_at desc")
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	result := query.Find(&alerts)
+	return alerts, result.Error
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Annotation is a free-form note attached either to a single log entry or to a host
+type Annotation struct {
+	gorm.Model
+	LogID     uint   `gorm:"index"`
+	ClientIP  string `gorm:"index"`
+	Text      string
+	CreatedBy string
+}
+
+// Acknowledgement marks an alert as seen so it no longer demands attention
+type Acknowledgement struct {
+	gorm.Model
+	AlertKey  string `gorm:"index"`
+	Comment   string
+	CreatedBy string
+}
+
+// Silence is a time-limited mute rule for messages matching a host and/or content pattern
+type Silence struct {
+	gorm.Model
+	ClientIP  string
+	Pattern   string
+	Comment   string
+	CreatedBy string
+	ExpiresAt time.Time `gorm:"index"`
+
+	re *regexp.Regexp // Compiled Pattern, set when the silence is saved or loaded
+}
+
+// silenceCache keeps the compiled patterns of the active silences, as they are
+// loaded for every alert check; nil marks a pattern that does not compile
+type silenceCache struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// compile sets the compiled pattern
+func (s *Silence) compile() error {
+	if s.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	s.re = re
+	return nil
+}
+
+// Matches reports whether the silence applies to a message from host with the given content.
+// A pattern that does not compile matches nothing.
+func (s Silence) Matches(host, content string) bool {
+	if s.ClientIP != "" && s.ClientIP != host {
+		return false
+	}
+	if s.Pattern == "" {
+		return true
+	}
+	return s.re != nil && s.re.MatchString(content)
+}
+
+func (s *Store) SaveAnnotation(annotation *Annotation) error {
+	return s.DB.Create(annotation).Error
+}
+
+func (s *Store) GetAnnotations() ([]Annotation, error) {
+	var annotations []Annotation
+	result := s.DB.Order("created_at desc").Find(&annotations)
+	return annotations, result.Error
+}
+
+// GetAnnotationsForLogs returns annotations keyed by log ID for the given logs
+func (s *Store) GetAnnotationsForLogs(logIDs []uint) (map[uint][]Annotation, error) {
+	annotations := make(map[uint][]Annotation)
+	if len(logIDs) == 0 {
+		return annotations, nil
+	}
+
+	var found []Annotation
+	result := s.DB.Where("log_id IN ?", logIDs).Order("created_at asc").Find(&found)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, annotation := range found {
+		annotations[annotation.LogID] = append(annotations[annotation.LogID], annotation)
+	}
+	return annotations, nil
+}
+
+// GetHostAnnotations returns host-level annotations keyed by client IP
+func (s *Store) GetHostAnnotations() (map[string][]Annotation, error) {
+	var found []Annotation
+	result := s.DB.Where("log_id = 0 AND client_ip <> ''").Order("created_at asc").Find(&found)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	annotations := make(map[string][]Annotation)
+	for _, annotation := range found {
+		annotations[annotation.ClientIP] = append(annotations[annotation.ClientIP], annotation)
+	}
+	return annotations, nil
+}
+
+func (s *Store) SaveAcknowledgement(ack *Acknowledgement) error {
+	return s.DB.Create(ack).Error
+}
+
+func (s *Store) GetAcknowledgements() ([]Acknowledgement, error) {
+	var acks []Acknowledgement
+	result := s.DB.Order("created_at desc").Find(&acks)
+	return acks, result.Error
+}
+
+// IsAcknowledged reports whether the alert was acknowledged after since, typically when it started firing
+func (s *Store) IsAcknowledged(alertKey string, since time.Time) (bool, error) {
+	var count int64
+	result := s.DB.Model(&Acknowledgement{}).Where("alert_key = ? AND created_at >= ?", alertKey, since).Count(&count)
+	return count > 0, result.Error
+}
+
+// SaveSilence creates a silence, rejecting a pattern that does not compile
+func (s *Store) SaveSilence(silence *Silence) error {
+	if err := silence.compile(); err != nil {
+		return err
+	}
+	return s.DB.Create(silence).Error
+}
+
+// GetActiveSilences returns silences that have not yet expired
+func (s *Store) GetActiveSilences() ([]Silence, error) {
+	var silences []Silence
+	result := s.DB.Where("expires_at > ?", time.Now()).Order("expires_at asc").Find(&silences)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// Each pattern is compiled once while a silence uses it
+	s.silences.mu.Lock()
+	defer s.silences.mu.Unlock()
+	patterns := make(map[string]*regexp.Regexp)
+	for i := range silences {
+		silence := &silences[i]
+		if silence.Pattern == "" {
+			continue
+		}
+		re, ok := s.silences.patterns[silence.Pattern]
+		if !ok {
+			// Silences stored before patterns were checked may not compile; they match nothing
+			if err := silence.compile(); err != nil {
+				log.Printf("Error in silence %d: %v", silence.ID, err)
+			}
+			re = silence.re
+		}
+		silence.re = re
+		patterns[silence.Pattern] = re
+	}
+	s.silences.patterns = patterns
+	return silences, nil
+}
+
+// IsSilenced reports whether any active silence matches the message
+func IsSilenced(silences []Silence, host, content string) bool {
+	for _, silence := range silences {
+		if silence.Matches(host, content) {
+			return true
+		}
+	}
+	return false
+}
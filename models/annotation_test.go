@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// TestGetActiveSilences compiles the patterns of active silences and forgets those of expired ones
+func TestGetActiveSilences(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	now := time.Now()
+	if err := store.SaveSilence(&Silence{Pattern: "firmware", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("SaveSilence returned an error: %v", err)
+	}
+	expiring := Silence{Pattern: "link (up|down)", ExpiresAt: now.Add(time.Second)}
+	if err := store.SaveSilence(&expiring); err != nil {
+		t.Fatalf("SaveSilence returned an error: %v", err)
+	}
+	// Stored before patterns were checked
+	if err := store.DB.Create(&Silence{Pattern: "(", ExpiresAt: now.Add(time.Hour)}).Error; err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+
+	silences, err := store.GetActiveSilences()
+	if err != nil || len(silences) != 3 {
+		t.Fatalf("Expected 3 active silences, got %d, %v", len(silences), err)
+	}
+	if !IsSilenced(silences, "10.0.0.1", "firmware upgraded") || !IsSilenced(silences, "10.0.0.1", "link down") {
+		t.Error("Expected the valid patterns to match")
+	}
+	if IsSilenced(silences, "10.0.0.1", "(") {
+		t.Error("Expected the invalid pattern to match nothing")
+	}
+	if len(store.silences.patterns) != 3 {
+		t.Errorf("Expected the 3 patterns cached, got %d", len(store.silences.patterns))
+	}
+
+	if err := store.DB.Model(&expiring).Update("expires_at", now.Add(-time.Second)).Error; err != nil {
+		t.Fatalf("Failed to expire silence: %v", err)
+	}
+	if silences, err = store.GetActiveSilences(); err != nil || len(silences) != 2 {
+		t.Fatalf("Expected 2 active silences, got %d, %v", len(silences), err)
+	}
+	if _, ok := store.silences.patterns["link (up|down)"]; ok || len(store.silences.patterns) != 2 {
+		t.Errorf("Expected the expired pattern forgotten, got %v", store.silences.patterns)
+	}
+}
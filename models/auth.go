@@ -0,0 +1,154 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// AuthEvent is a login attempt a host logged. Attempts are counted over time
+// through idx_auth_events_received_at.
+type AuthEvent struct {
+	ID         uint      `gorm:"primarykey"`
+	LogID      uint      `gorm:"not null;index"`
+	HostID     uint      `gorm:"not null;default:0"` // The host logged into
+	ClientIP   string    // The address it logged from
+	ReceivedAt time.Time `gorm:"not null;index:idx_auth_events_received_at"`
+	Service    string    // ssh, luci, su or sudo
+	Success    bool
+	Username   string // The account whose credentials were tried
+	Src        string // Remote address of the attempt; empty for local logins
+}
+
+// BruteForce sets when the failures from one source to one host are an attack
+type BruteForce struct {
+	Failures int // Failed attempts within Window
+	Users    int // Distinct user names tried within Window
+	Window   time.Duration
+}
+
+// DefaultBruteForce is used unless the configuration sets other thresholds
+var DefaultBruteForce = BruteForce{Failures: 10, Users: 5, Window: 10 * time.Minute}
+
+// AuthQuery selects the login attempts since Since, optionally on some hosts
+type AuthQuery struct {
+	Since   time.Time
+	HostIDs []uint
+}
+
+// AuthSummary counts the login attempts from one source to one host
+type AuthSummary struct {
+	Src        string
+	HostID     uint
+	Failures   int64
+	Successes  int64
+	Users      int64 // Distinct user names of the failed attempts
+	Last       time.Time
+	BruteForce bool // The failures cross the brute-force thresholds
+}
+
+// SaveAuthEvent records a login attempt
+func (s *Store) SaveAuthEvent(event *AuthEvent) error {
+	return s.DB.Create(event).Error
+}
+
+// GetAuthSummaries counts the login attempts per source and host, most failures first
+func (s *Store) GetAuthSummaries(query AuthQuery) ([]AuthSummary, error) {
+	q := s.DB.Model(&AuthEvent{}).Where("received_at > ?", query.Since)
+	if len(query.HostIDs) > 0 {
+		q = q.Where("host_id IN ?", query.HostIDs)
+	}
+
+	var rows []struct {
+		Src       string
+		HostID    uint
+		Failures  int64
+		Successes int64
+		Users     int64
+		LastID    uint
+	}
+	err := q.Select(`src, host_id,
+		SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures,
+		SUM(CASE WHEN success THEN 1 ELSE 0 END) AS successes,
+		COUNT(DISTINCT CASE WHEN success THEN NULL ELSE username END) AS users,
+		MAX(id) AS last_id`).
+		Group("src, host_id").Order("failures DESC, src, host_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The latest attempt is found by ID, since SQLite returns aggregated times as text
+	lastIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		lastIDs = append(lastIDs, row.LastID)
+	}
+	times, err := s.authTimes(lastIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]AuthSummary, 0, len(rows))
+	for _, row := range rows {
+		summaries = append(summaries, AuthSummary{
+			Src:       row.Src,
+			HostID:    row.HostID,
+			Failures:  row.Failures,
+			Successes: row.Successes,
+			Users:     row.Users,
+			Last:      times[row.LastID],
+		})
+	}
+	return summaries, nil
+}
+
+// authTimes returns when the given login attempts were received
+func (s *Store) authTimes(ids []uint) (map[uint]time.Time, error) {
+	times := make(map[uint]time.Time, len(ids))
+	if len(ids) == 0 {
+		return times, nil
+	}
+	var events []AuthEvent
+	if err := s.DB.Select("id, received_at").Where("id IN ?", ids).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		times[event.ID] = event.ReceivedAt
+	}
+	return times, nil
+}
+
+// GetBruteForce returns the sources whose failures against a host crossed the
+// brute-force thresholds within the window before now
+func (s *Store) GetBruteForce(now time.Time) ([]AuthSummary, error) {
+	summaries, err := s.GetAuthSummaries(AuthQuery{Since: now.Add(-s.BruteForce.Window)})
+	if err != nil {
+		return nil, err
+	}
+	var attacks []AuthSummary
+	for _, summary := range summaries {
+		if s.BruteForce.Crossed(summary) {
+			summary.BruteForce = true
+			attacks = append(attacks, summary)
+		}
+	}
+	return attacks, nil
+}
+
+// Crossed reports whether the failures of a summary are an attack
+func (b BruteForce) Crossed(summary AuthSummary) bool {
+	return (b.Failures > 0 && summary.Failures >= int64(b.Failures)) || (b.Users > 0 && summary.Users >= int64(b.Users))
+}
+
+// InBruteForce reports whether the address is the source or the target of a brute-force attack
+func (s *Store) InBruteForce(clientIP string, now time.Time) (bool, error) {
+	attacks, err := s.GetBruteForce(now)
+	if err != nil || len(attacks) == 0 {
+		return false, err
+	}
+	owners, err := s.GetAddressOwners([]string{clientIP})
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(attacks, func(attack AuthSummary) bool {
+		return attack.Src == clientIP || (owners[clientIP] != 0 && attack.HostID == owners[clientIP])
+	}), nil
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Clock selects which time of a log to trust
+type Clock string
+
+const (
+	ClockReceived Clock = "received" // When hostlog received the log
+	ClockDevice   Clock = "device"   // The timestamp the sender put in the message
+	ClockAuto     Clock = "auto"     // The device time, unless the host's clock is skewed
+)
+
+// DefaultSkewTolerance is how far a device clock may drift before it is considered skewed
+const DefaultSkewTolerance = 5 * time.Minute
+
+// skewSamples is the number of recent logs a host's clock skew is estimated from
+const skewSamples = 20
+
+// ParseClock validates a clock name; an empty name selects ClockAuto
+func ParseClock(name string) (Clock, error) {
+	switch clock := Clock(name); clock {
+	case "":
+		return ClockAuto, nil
+	case ClockReceived, ClockDevice, ClockAuto:
+		return clock, nil
+	default:
+		return "", fmt.Errorf("unknown clock %q", name)
+	}
+}
+
+// ClockSkew is how far a host's clock is off, estimated from its recent logs
+type ClockSkew struct {
+	ClientIP string
+	Skew     time.Duration // Median of device time minus received time
+	Samples  int           // Recent logs that carried a device time
+}
+
+// Skewed reports whether the host's clock is off by more than tolerance
+func (c ClockSkew) Skewed(tolerance time.Duration) bool {
+	return c.Samples > 0 && (c.Skew > tolerance || c.Skew < -tolerance)
+}
+
+// deviceTime reads an RFC 3164 timestamp, which the parser returns as a UTC time
+// in the current year, as a wall clock in the device zone, and moves it back a
+// year when it lies more than half a year ahead of received, as a message sent on
+// December 31 and received on January 1 does
+func (s *Store) deviceTime(t time.Time, received time.Time) time.Time {
+	if t.IsZero() || t.Location() != time.UTC {
+		return t
+	}
+	zone := s.DeviceZone
+	if zone == nil {
+		zone = time.Local
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+	if t.After(received.AddDate(0, 6, 0)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// Time returns the log's time according to clock, which must not be ClockAuto.
+// Logs without a device time fall back to the received time.
+func (l Log) Time(clock Clock) time.Time {
+	if clock == ClockDevice && !l.DeviceTime.IsZero() {
+		return l.DeviceTime
+	}
+	return l.ReceivedAt
+}
+
+// ResolveClock turns ClockAuto into the clock to trust for a host with the given skew
+func (s *Store) ResolveClock(clock Clock, skew ClockSkew) Clock {
+	if clock != ClockAuto {
+		return clock
+	}
+	if skew.Skewed(s.SkewTolerance) {
+		return ClockReceived
+	}
+	return ClockDevice
+}
+
+// HostClock resolves clock for one host
+func (s *Store) HostClock(host string, clock Clock) (Clock, error) {
+	if clock != ClockAuto {
+		return clock, nil
+	}
+	skew, err := s.GetClockSkew(host)
+	if err != nil {
+		return "", err
+	}
+	return s.ResolveClock(clock, skew), nil
+}
+
+// GetClockSkew estimates a host's clock skew from its most recent logs
+func (s *Store) GetClockSkew(host string) (ClockSkew, error) {
+	var logs []Log
+	result := s.DB.Select("received_at", "device_time").
+		Where("client_ip = ?", host).
+		Order("received_at desc").
+		Limit(skewSamples).
+		Find(&logs)
+	if result.Error != nil {
+		return ClockSkew{}, result.Error
+	}
+
+	skew := ClockSkew{ClientIP: host}
+	var offsets []time.Duration
+	for _, l := range logs {
+		if l.DeviceTime.IsZero() {
+			continue
+		}
+		offsets = append(offsets, l.DeviceTime.Sub(l.ReceivedAt))
+	}
+	if len(offsets) == 0 {
+		return skew, nil
+	}
+
+	slices.Sort(offsets)
+	skew.Skew = offsets[len(offsets)/2]
+	skew.Samples = len(offsets)
+	return skew, nil
+}
+
+// GetClockSkews estimates the clock skew of the given hosts, or of all hosts when hosts is empty
+func (s *Store) GetClockSkews(hosts []string) (map[string]ClockSkew, error) {
+	if len(hosts) == 0 {
+		var err error
+		if hosts, err = s.GetAllHosts(); err != nil {
+			return nil, err
+		}
+	}
+
+	skews := make(map[string]ClockSkew, len(hosts))
+	for _, host := range hosts {
+		if _, ok := skews[host]; ok {
+			continue
+		}
+		skew, err := s.GetClockSkew(host)
+		if err != nil {
+			return nil, err
+		}
+		skews[host] = skew
+	}
+	return skews, nil
+}
+
+// GetSkewedClocks returns the hosts whose clocks are off by more than the store's tolerance
+func (s *Store) GetSkewedClocks() (map[string]ClockSkew, error) {
+	skews, err := s.GetClockSkews(nil)
+	if err != nil {
+		return nil, err
+	}
+	for host, skew := range skews {
+		if !skew.Skewed(s.SkewTolerance) {
+			delete(skews, host)
+		}
+	}
+	return skews, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is a position in the logs ordered by received time and ID
+type Cursor struct {
+	ReceivedAt time.Time
+	ID         uint
+}
+
+// CursorOf returns the position of a log
+func CursorOf(l Log) *Cursor {
+	return &Cursor{ReceivedAt: l.ReceivedAt, ID: l.ID}
+}
+
+// String encodes the cursor for URLs and tool arguments
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d-%d", c.ReceivedAt.UnixNano(), c.ID)
+}
+
+// ParseCursor decodes a cursor produced by Cursor.String
+func ParseCursor(s string) (*Cursor, error) {
+	nanos, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	i, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	return &Cursor{ReceivedAt: time.Unix(0, n), ID: uint(i)}, nil
+}
+
+// LogPage is one page of logs, most recent first
+type LogPage struct {
+	Logs  []Log
+	Newer *Cursor // Pass as After to get the next newer page; nil on the newest page
+	Older *Cursor // Pass as Before to get the next older page; nil on the oldest page
+	Total int64   // Number of matching logs, or -1 when not counted
+}
@@ -1,58 +1,205 @@
 package models
 
 import (
-	"gorm.io/driver/sqlite"
+	"fmt"
 	"gorm.io/gorm"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
 )
 
-var DB *gorm.DB
-var DBPath string
+// Store carries the database handle used by every model function. Stores are
+// independent of each other, so one process can open several of them.
+type Store struct {
+	DB      *gorm.DB
+	Path    string // Database file, or the redacted PostgreSQL DSN
+	Backend Storage
+	dataDir string
+	hosts   hostCache
+
+	// Clock is the clock scoring and time-windowed queries trust by default
+	Clock Clock
+	// SkewTolerance is how far a device clock may drift before ClockAuto distrusts it
+	SkewTolerance time.Duration
+	// DeviceZone is the zone of device times, which RFC 3164 messages leave out; nil uses the local zone
+	DeviceZone *time.Location
+	// Neighbors attaches MAC addresses and names from the router's files to hosts; nil when not watched
+	Neighbors *Neighbors
+	// Vendors names the makers of MAC addresses
+	Vendors *Vendors
+	// BruteForce sets when login failures count as a brute-force attack
+	BruteForce BruteForce
+	// Redactor replaces secrets in messages before they are stored; nil stores them as sent
+	Redactor *Redactor
+	// MCPRedactor replaces secrets in the logs MCP tools return, on top of Redactor
+	MCPRedactor *Redactor
+	// DedupWindow is how long a message a host repeats is counted on its first row; zero stores every message
+	DedupWindow time.Duration
+	repeats     repeatCache
+	silences    silenceCache
+}
 
 // DefaultDBPath is the default path for the SQLite database file
 const DefaultDBPath = "logs.db"
 
-func InitDB() (*gorm.DB, error) {
-	// Check if DB path is provided via environment variable
-	DBPath = os.Getenv("HOSTLOG_DB_PATH")
-	if DBPath == "" {
-		DBPath = DefaultDBPath
+// InitDB opens the database configured by the environment read-write and migrates the schema
+func InitDB() (*Store, error) {
+	store, err := OpenDB(false)
+	if err != nil {
+		return nil, err
 	}
 
-	// Convert to absolute path
-	absPath, err := filepath.Abs(DBPath)
-	if err == nil {
-		DBPath = absPath
+	if err := store.Migrate(); err != nil {
+		return nil, err
 	}
 
-	DB, err = gorm.Open(sqlite.Open(DBPath), &gorm.Config{})
+	return store, nil
+}
+
+// OpenDB opens the database configured by the environment without migrating the
+// schema. HOSTLOG_DB_DSN selects PostgreSQL; otherwise the SQLite file at
+// HOSTLOG_DB_PATH is used.
+func OpenDB(readOnly bool) (*Store, error) {
+	return OpenStore(DSNFromEnv(), readOnly)
+}
+
+// DSNFromEnv returns the database configured by the environment: the PostgreSQL
+// connection string of HOSTLOG_DB_DSN, or else the SQLite file of HOSTLOG_DB_PATH
+func DSNFromEnv() string {
+	dsn := os.Getenv("HOSTLOG_DB_DSN")
+	if !IsPostgresDSN(dsn) {
+		// Check if DB path is provided via environment variable
+		dsn = os.Getenv("HOSTLOG_DB_PATH")
+		if dsn == "" {
+			dsn = DefaultDBPath
+		}
+	}
+	return dsn
+}
+
+// DataDirFromEnv returns the data directory of the database configured by the
+// environment without opening it
+func DataDirFromEnv() string {
+	dsn := DSNFromEnv()
+	if IsPostgresDSN(dsn) {
+		return "."
+	}
+	if absPath, err := filepath.Abs(dsn); err == nil {
+		dsn = absPath
+	}
+	return filepath.Dir(dsn)
+}
+
+// OpenStore opens the database named by dsn, a PostgreSQL connection string or a
+// SQLite file path. SQLite files are switched to WAL journaling with a busy timeout
+// so that a reader in another process, such as the stdio MCP server, never blocks
+// the syslog daemon. A read-only store rejects every write.
+func OpenStore(dsn string, readOnly bool) (*Store, error) {
+	store := &Store{Path: dsn, dataDir: ".", Clock: ClockAuto, SkewTolerance: DefaultSkewTolerance, BruteForce: DefaultBruteForce, DedupWindow: DefaultDedupWindow}
+	if IsPostgresDSN(dsn) {
+		store.Path = redactDSN(dsn)
+	} else {
+		// Convert to absolute path
+		if absPath, err := filepath.Abs(dsn); err == nil {
+			store.Path = absPath
+			dsn = absPath
+		}
+		store.dataDir = filepath.Dir(store.Path)
+	}
+
+	vendors, err := LoadVendors(store.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading MAC vendors: %w", err)
+	}
+	store.Vendors = vendors
+
+	storage, err := OpenStorage(dsn, readOnly)
 	if err != nil {
 		return nil, err
 	}
 
-	DB.AutoMigrate(&Log{}, &LogField{})
+	store.Backend = storage
+	store.DB = storage.DB()
+	return store, nil
+}
 
-	return DB, nil
+// Migrate creates or updates the schema
+func (s *Store) Migrate() error {
+	if err := s.migrateLogs(); err != nil {
+		return err
+	}
+	if err := s.migratePatterns(); err != nil {
+		return err
+	}
+	if err := s.DB.AutoMigrate(&Log{}, &LogField{}, &Annotation{}, &Acknowledgement{}, &Silence{}, &Alert{}, &Pattern{},
+		&Host{}, &HostAddress{}, &HostName{}, &ReverseName{}, &Field{}, &FirewallEvent{}, &AuthEvent{}, &RedactionCount{}); err != nil {
+		return err
+	}
+	return s.migrateHosts()
+}
+
+// Close releases the database connections
+func (s *Store) Close() error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
-func SaveLog(logParts map[string]interface{}) (Log, error) {
+// DataDir is the directory for files kept alongside the database
+func (s *Store) DataDir() string {
+	return s.dataDir
+}
+
+// redactDSN hides the password of a PostgreSQL URL for display
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsn
+}
+
+func (s *Store) SaveLog(logParts map[string]interface{}) (Log, error) {
 	clientString := GetStringValue(logParts, "client")
 	clientIP := ExtractIP(clientString)
 	log := Log{
-		ClientIP: clientIP,
+		ClientIP:   clientIP,
+		ReceivedAt: time.Now(),
 	}
 
 	log.Hostname = GetStringValue(logParts, "hostname")
-	log.Content = GetStringValue(logParts, "content")
+	log.Tag = GetStringValue(logParts, "tag")
+	var replaced map[string]int
+	log.Content, replaced = s.Redactor.Redact(GetStringValue(logParts, "content"))
 	log.Priority = GetIntValue(logParts, "priority")
-	log.Timestamp = GetTimeValue(logParts, "timestamp")
+	log.DeviceTime = s.deviceTime(GetTimeValue(logParts, "timestamp"), log.ReceivedAt)
+
+	hostID, err := s.ResolveHost(clientIP, log.Hostname, log.ReceivedAt)
+	if err != nil {
+		return log, err
+	}
+	log.HostID = hostID
+
+	go s.SaveLogFields(clientIP, logParts)
 
-	go SaveLogFields(clientIP, logParts)
+	log.Repeats = 1
+	log.LastReceivedAt = log.ReceivedAt
+	if repeated, ok, err := s.saveRepeat(log); err != nil || ok {
+		if err == nil {
+			err = s.countRedactions(replaced)
+		}
+		return repeated, err
+	}
 
-	return log, DB.Create(&log).Error
+	logs := []Log{log}
+	if err = s.Backend.InsertBatch(logs); err == nil {
+		s.rememberLog(logs[0])
+		err = s.countRedactions(replaced)
+	}
+	return logs[0], err
 }
 
 func GetStringValue(logParts map[string]interface{}, key string) string {
@@ -90,26 +237,53 @@ func GetIntValue(logParts map[string]interface{}, key string) int {
 	return 0
 }
 
-func GetFilteredLogs(hosts []string, page int) ([]Log, int, error) {
-	var logs []Log
-	query := DB.Order("created_at desc")
+// LogFilter selects logs by sender address or inventory host and by extracted
+// fields; an empty filter selects every log
+type LogFilter struct {
+	Hosts   []string
+	HostIDs []uint // Empty but not nil selects no logs, e.g. for a group without members
+	Fields  []FieldMatch
+}
 
-	if len(hosts) > 0 {
-		query = query.Where("client_ip IN ?", hosts)
+// GetFilteredLogs returns the page of up to 100 logs matching filter that comes
+// before or after a cursor, or the most recent page without one. The total number
+// of matching logs is only counted on request, as that reads every match.
+func (s *Store) GetFilteredLogs(filter LogFilter, before, after *Cursor, count bool) (LogPage, error) {
+	limit := 100
+	// One extra log tells whether another page follows
+	logs, total, err := s.Backend.QueryLogs(LogQuery{
+		Hosts:   filter.Hosts,
+		HostIDs: filter.HostIDs,
+		Fields:  filter.Fields,
+		Limit:   limit + 1,
+		Before:  before,
+		After:   after,
+		Count:   count,
+	})
+	if err != nil {
+		return LogPage{}, err
 	}
 
-	limit := 100
-	offset := max(page, 0) * limit
-	result := query.Offset(offset).Limit(limit).Find(&logs)
-	if result.Error != nil {
-		return nil, 0, result.Error
+	page := LogPage{Logs: logs, Total: total}
+	more := len(logs) > limit
+	switch {
+	case after != nil && !more:
+		// Paging up reached the newest logs
+		return s.GetFilteredLogs(filter, nil, nil, count)
+	case after != nil:
+		page.Logs = logs[1:]
+	case more:
+		page.Logs = logs[:limit]
+	}
+	if len(page.Logs) == 0 {
+		return page, nil
 	}
 
-	var count int64
-	result = query.Count(&count)
-	if result.Error != nil {
-		return nil, 0, result.Error
+	if before != nil || after != nil {
+		page.Newer = CursorOf(page.Logs[0])
+	}
+	if after != nil || more {
+		page.Older = CursorOf(page.Logs[len(page.Logs)-1])
 	}
-	maxPage := int((count+int64(limit)-1)/int64(limit) - 1)
-	return logs, maxPage, result.Error
+	return page, nil
 }
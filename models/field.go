@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is a value the parser pipeline extracted from a log message. Fields are
+// found by name and value through idx_fields_name_value_log_id, which also yields
+// the log IDs, and loaded per log through idx_fields_log_id.
+type Field struct {
+	ID    uint   `gorm:"primarykey"`
+	LogID uint   `gorm:"not null;index:idx_fields_log_id;index:idx_fields_name_value_log_id,priority:3"`
+	Name  string `gorm:"not null;index:idx_fields_name_value_log_id,priority:1"`
+	Value string `gorm:"not null;index:idx_fields_name_value_log_id,priority:2"`
+}
+
+// FieldMatch selects logs with a field of the given value
+type FieldMatch struct {
+	Name  string
+	Value string
+}
+
+// String renders the match as name=value
+func (m FieldMatch) String() string {
+	return m.Name + "=" + m.Value
+}
+
+// ParseFieldMatch parses a name=value condition
+func ParseFieldMatch(s string) (FieldMatch, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return FieldMatch{}, fmt.Errorf("field filter %q is not name=value", s)
+	}
+	return FieldMatch{Name: name, Value: strings.TrimSpace(value)}, nil
+}
+
+// SaveFields stores the fields extracted from a log
+func (s *Store) SaveFields(logID uint, fields []Field) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	for i := range fields {
+		fields[i].LogID = logID
+	}
+	return s.DB.CreateInBatches(fields, 100).Error
+}
+
+// GetFieldsForLogs returns the fields of the given logs keyed by log ID, in extraction order
+func (s *Store) GetFieldsForLogs(logIDs []uint) (map[uint][]Field, error) {
+	fields := make(map[uint][]Field)
+	if len(logIDs) == 0 {
+		return fields, nil
+	}
+
+	var found []Field
+	if err := s.DB.Where("log_id IN ?", logIDs).Order("id").Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, field := range found {
+		fields[field.LogID] = append(fields[field.LogID], field)
+	}
+	return fields, nil
+}
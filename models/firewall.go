@@ -0,0 +1,147 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FirewallEvent is a packet a router's netfilter rules logged. Events are counted
+// over time through idx_firewall_events_received_at, and per router through
+// idx_firewall_events_host_id_received_at.
+type FirewallEvent struct {
+	ID         uint      `gorm:"primarykey"`
+	LogID      uint      `gorm:"not null;index"`
+	HostID     uint      `gorm:"not null;default:0;index:idx_firewall_events_host_id_received_at,priority:1"` // The router that logged the packet
+	ReceivedAt time.Time `gorm:"not null;index:idx_firewall_events_received_at;index:idx_firewall_events_host_id_received_at,priority:2"`
+	Action     string    // drop, reject, accept or log
+	Prefix     string    // Log prefix of the rule, such as "drop wan in"
+	In         string
+	Out        string
+	Src        string
+	Dst        string
+	Proto      string
+	SrcPort    int
+	DstPort    int
+}
+
+// blockedActions are the actions that count as blocked packets
+var blockedActions = []string{"drop", "reject"}
+
+// Blocked reports whether the packet was dropped or rejected
+func (e FirewallEvent) Blocked() bool {
+	return slices.Contains(blockedActions, e.Action)
+}
+
+// FirewallQuery selects the blocked packets logged since Since, optionally by some routers
+type FirewallQuery struct {
+	Since   time.Time
+	HostIDs []uint
+	Limit   int
+}
+
+// BlockedSource is a source address with the packets blocked from it
+type BlockedSource struct {
+	Src   string
+	Count int64
+	Ports int64 // Distinct destination ports, a sign of a scan
+	Last  time.Time
+}
+
+// BlockedPort is a destination port with the packets blocked to it
+type BlockedPort struct {
+	Proto   string
+	DstPort int
+	Count   int64
+	Sources int64 // Distinct source addresses
+}
+
+// DropRate is the number of packets a router blocked in one time bucket
+type DropRate struct {
+	HostID uint
+	Bucket time.Time
+	Count  int64
+}
+
+// SaveFirewallEvent records a packet logged by a router
+func (s *Store) SaveFirewallEvent(event *FirewallEvent) error {
+	return s.DB.Create(event).Error
+}
+
+// blocked selects the blocked packets matching the query
+func (s *Store) blocked(query FirewallQuery) *gorm.DB {
+	q := s.DB.Model(&FirewallEvent{}).Where("received_at > ? AND action IN ?", query.Since, blockedActions)
+	if len(query.HostIDs) > 0 {
+		q = q.Where("host_id IN ?", query.HostIDs)
+	}
+	return q
+}
+
+// TopBlockedSources returns the source addresses with the most blocked packets
+func (s *Store) TopBlockedSources(query FirewallQuery) ([]BlockedSource, error) {
+	var rows []struct {
+		Src    string
+		Count  int64
+		Ports  int64
+		LastID uint
+	}
+	err := s.blocked(query).
+		Select("src, COUNT(*) AS count, COUNT(DISTINCT dst_port) AS ports, MAX(id) AS last_id").
+		Group("src").Order("count DESC, src").Limit(query.Limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The latest packet of each source is found by ID, since SQLite returns aggregated times as text
+	lastIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		lastIDs = append(lastIDs, row.LastID)
+	}
+	var last []FirewallEvent
+	if len(lastIDs) > 0 {
+		if err := s.DB.Select("id, received_at").Where("id IN ?", lastIDs).Find(&last).Error; err != nil {
+			return nil, err
+		}
+	}
+	times := make(map[uint]time.Time, len(last))
+	for _, event := range last {
+		times[event.ID] = event.ReceivedAt
+	}
+
+	sources := make([]BlockedSource, 0, len(rows))
+	for _, row := range rows {
+		sources = append(sources, BlockedSource{Src: row.Src, Count: row.Count, Ports: row.Ports, Last: times[row.LastID]})
+	}
+	return sources, nil
+}
+
+// TopBlockedPorts returns the destination ports with the most blocked packets
+func (s *Store) TopBlockedPorts(query FirewallQuery) ([]BlockedPort, error) {
+	var ports []BlockedPort
+	err := s.blocked(query).
+		Select("proto, dst_port, COUNT(*) AS count, COUNT(DISTINCT src) AS sources").
+		Group("proto, dst_port").Order("count DESC, dst_port").Limit(query.Limit).Scan(&ports).Error
+	return ports, err
+}
+
+// GetDropRates counts the blocked packets per router and time bucket of the given width
+func (s *Store) GetDropRates(query FirewallQuery, interval time.Duration) ([]DropRate, error) {
+	var rows []struct {
+		HostID uint
+		Bucket int64
+		Count  int64
+	}
+	err := s.blocked(query).
+		Select("host_id, " + s.Backend.Bucket(interval) + " AS bucket, COUNT(*) AS count").
+		Group("host_id, bucket").Order("host_id, bucket").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]DropRate, 0, len(rows))
+	for _, row := range rows {
+		rates = append(rates, DropRate{HostID: row.HostID, Bucket: time.Unix(row.Bucket, 0), Count: row.Count})
+	}
+	return rates, nil
+}
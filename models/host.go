@@ -0,0 +1,449 @@
+package models
+
+import (
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Host is one device, which may have sent logs from several addresses and under
+// several hostnames, e.g. when DHCP hands it a new lease
+type Host struct {
+	gorm.Model
+	Sighting
+	Name      string // Display name chosen by the user; empty shows the latest hostname or address
+	Tags      string // Comma-separated
+	Notes     string
+	Addresses []HostAddress
+	Hostnames []HostName
+	Neighbor  Neighbor `gorm:"-"` // What the router's files say about the host's addresses
+}
+
+// HostAddress is an address a host has sent logs from
+type HostAddress struct {
+	gorm.Model
+	Sighting
+	HostID      uint   `gorm:"uniqueIndex:idx_host_addresses_host_id_client_ip"`
+	ClientIP    string `gorm:"uniqueIndex:idx_host_addresses_host_id_client_ip;index"`
+	ReverseName string `gorm:"-"` // From the reverse DNS cache, when a lookup succeeded
+}
+
+// Label is the address followed by its reverse DNS name, when it has one
+func (a HostAddress) Label() string {
+	if a.ReverseName == "" {
+		return a.ClientIP
+	}
+	return a.ClientIP + " (" + a.ReverseName + ")"
+}
+
+// HostName is a hostname a host has put in its logs
+type HostName struct {
+	gorm.Model
+	Sighting
+	HostID   uint   `gorm:"uniqueIndex:idx_host_names_host_id_hostname"`
+	Hostname string `gorm:"uniqueIndex:idx_host_names_host_id_hostname;index"`
+}
+
+// Sighting is when something was first and last seen in the logs
+type Sighting struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// saw widens the sighting to include t
+func (s *Sighting) saw(t time.Time) {
+	if s.FirstSeen.IsZero() || t.Before(s.FirstSeen) {
+		s.FirstSeen = t
+	}
+	if t.After(s.LastSeen) {
+		s.LastSeen = t
+	}
+}
+
+// genericHostnames are shipped as defaults by many devices, so they do not tell devices apart
+var genericHostnames = []string{"localhost", "openwrt", "lede", "(none)", "-"}
+
+// hostSeenInterval is how often the sightings of a busy host are written back
+const hostSeenInterval = time.Minute
+
+// hostSighting is a cached host resolution
+type hostSighting struct {
+	id   uint
+	seen time.Time
+}
+
+// hostCache remembers recent host resolutions so that most logs need no lookup.
+// Entries are only used for hostSeenInterval, and dropped once per interval after
+// that, as senders choose the hostnames they are keyed by.
+type hostCache struct {
+	mu      sync.Mutex
+	entries map[string]hostSighting
+	swept   time.Time
+}
+
+// sweep drops the entries older than hostSeenInterval once per interval
+func (c *hostCache) sweep(now time.Time) {
+	if now.Sub(c.swept) < hostSeenInterval {
+		return
+	}
+	for key, entry := range c.entries {
+		if now.Sub(entry.seen) >= hostSeenInterval {
+			delete(c.entries, key)
+		}
+	}
+	c.swept = now
+}
+
+// DisplayName is the user's name for the host, else its latest hostname, the router's
+// name for it, a reverse DNS name or its address. Vendor default hostnames give way
+// to the router's and reverse DNS names.
+func (h Host) DisplayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	if len(h.Hostnames) > 0 && hostIdentity("", h.Hostnames[0].Hostname) != "" {
+		return h.Hostnames[0].Hostname
+	}
+	if len(h.Neighbor.Names) > 0 {
+		return h.Neighbor.Names[0]
+	}
+	for _, address := range h.Addresses {
+		if address.ReverseName != "" {
+			return address.ReverseName
+		}
+	}
+	if len(h.Hostnames) > 0 {
+		return h.Hostnames[0].Hostname
+	}
+	if len(h.Addresses) > 0 {
+		return h.Addresses[0].ClientIP
+	}
+	return ""
+}
+
+// TagList splits the host's tags
+func (h Host) TagList() []string {
+	var tags []string
+	for _, tag := range strings.Split(h.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// AddressLabels returns the host's addresses with their reverse DNS names, most recently seen first
+func (h Host) AddressLabels() []string {
+	labels := make([]string, 0, len(h.Addresses))
+	for _, address := range h.Addresses {
+		labels = append(labels, address.Label())
+	}
+	return labels
+}
+
+// AddressList returns the host's addresses, most recently seen first
+func (h Host) AddressList() []string {
+	addresses := make([]string, 0, len(h.Addresses))
+	for _, address := range h.Addresses {
+		addresses = append(addresses, address.ClientIP)
+	}
+	return addresses
+}
+
+// HostnameList returns the host's hostnames, most recently seen first
+func (h Host) HostnameList() []string {
+	hostnames := make([]string, 0, len(h.Hostnames))
+	for _, hostname := range h.Hostnames {
+		hostnames = append(hostnames, hostname.Hostname)
+	}
+	return hostnames
+}
+
+// hostIdentity returns the hostname that identifies a device, or "" when the
+// hostname is missing, an address or a vendor default
+func hostIdentity(clientIP, hostname string) string {
+	hostname = strings.TrimSpace(hostname)
+	if hostname == "" || hostname == clientIP || net.ParseIP(hostname) != nil {
+		return ""
+	}
+	if slices.Contains(genericHostnames, strings.ToLower(hostname)) {
+		return ""
+	}
+	return hostname
+}
+
+// ResolveHost returns the host that sent a log from clientIP under hostname and
+// records the sighting. A hostname identifies a device wherever it moves; logs
+// without one belong to the host last seen at the address.
+func (s *Store) ResolveHost(clientIP, hostname string, seen time.Time) (uint, error) {
+	name := hostIdentity(clientIP, hostname)
+	key := clientIP + "\x00" + name
+
+	s.hosts.mu.Lock()
+	defer s.hosts.mu.Unlock()
+
+	if cached, ok := s.hosts.entries[key]; ok && seen.Sub(cached.seen) < hostSeenInterval {
+		return cached.id, nil
+	}
+
+	id, err := s.observeHost(clientIP, name, seen)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.hosts.entries == nil {
+		s.hosts.entries = make(map[string]hostSighting)
+	}
+	s.hosts.sweep(seen)
+	s.hosts.entries[key] = hostSighting{id: id, seen: seen}
+	// The address now belongs to this host
+	s.hosts.entries[clientIP+"\x00"] = hostSighting{id: id, seen: seen}
+	return id, nil
+}
+
+// observeHost finds or creates the host for a sighting and widens its first and last seen times
+func (s *Store) observeHost(clientIP, name string, seen time.Time) (uint, error) {
+	var host Host
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var hostID uint
+		if name != "" {
+			var hostname HostName
+			if err := tx.Where("hostname = ?", name).Order("last_seen desc").Limit(1).Find(&hostname).Error; err != nil {
+				return err
+			}
+			hostID = hostname.HostID
+		}
+
+		if hostID == 0 {
+			var address HostAddress
+			if err := tx.Where("client_ip = ?", clientIP).Order("last_seen desc").Limit(1).Find(&address).Error; err != nil {
+				return err
+			}
+			if address.HostID != 0 && name != "" {
+				// A named device only takes over the address from a host that never gave a name
+				var named int64
+				if err := tx.Model(&HostName{}).Where("host_id = ?", address.HostID).Count(&named).Error; err != nil {
+					return err
+				}
+				if named > 0 {
+					address.HostID = 0
+				}
+			}
+			hostID = address.HostID
+		}
+
+		if hostID != 0 {
+			if err := tx.Take(&host, hostID).Error; err != nil {
+				return err
+			}
+		}
+		host.saw(seen)
+		if err := tx.Save(&host).Error; err != nil {
+			return err
+		}
+
+		var address HostAddress
+		if err := tx.Where(HostAddress{HostID: host.ID, ClientIP: clientIP}).FirstOrInit(&address).Error; err != nil {
+			return err
+		}
+		address.saw(seen)
+		if err := tx.Save(&address).Error; err != nil {
+			return err
+		}
+
+		if name == "" {
+			return nil
+		}
+		var hostname HostName
+		if err := tx.Where(HostName{HostID: host.ID, Hostname: name}).FirstOrInit(&hostname).Error; err != nil {
+			return err
+		}
+		hostname.saw(seen)
+		return tx.Save(&hostname).Error
+	})
+	return host.ID, err
+}
+
+// preloadHosts loads the addresses and hostnames of hosts, most recently seen first
+func preloadHosts(db *gorm.DB) *gorm.DB {
+	latest := func(db *gorm.DB) *gorm.DB {
+		return db.Order("last_seen desc")
+	}
+	return db.Preload("Addresses", latest).Preload("Hostnames", latest)
+}
+
+// enrichHosts fills in the cached reverse DNS names of the hosts' addresses and
+// what the neighbor files say about them
+func (s *Store) enrichHosts(hosts []Host) error {
+	var clientIPs []string
+	for _, host := range hosts {
+		clientIPs = append(clientIPs, host.AddressList()...)
+	}
+	reverse, err := s.GetReverseNames(clientIPs)
+	if err != nil {
+		return err
+	}
+
+	for i := range hosts {
+		for j := range hosts[i].Addresses {
+			hosts[i].Addresses[j].ReverseName = reverse[hosts[i].Addresses[j].ClientIP].Name
+		}
+		s.enrichHost(&hosts[i])
+	}
+	return nil
+}
+
+// enrichHost fills in what the neighbor files say about the host's addresses,
+// taking the MAC from the most recently seen address that has one
+func (s *Store) enrichHost(host *Host) {
+	for _, address := range host.Addresses {
+		neighbor, ok := s.Neighbors.Lookup(address.ClientIP)
+		if !ok {
+			continue
+		}
+		if host.Neighbor.MAC == "" {
+			host.Neighbor.MAC = neighbor.MAC
+			host.Neighbor.Vendor = s.Vendors.Lookup(neighbor.MAC)
+			host.Neighbor.Expires = neighbor.Expires
+		}
+		for _, name := range neighbor.Names {
+			host.Neighbor.Names = appendNew(host.Neighbor.Names, name)
+		}
+	}
+}
+
+// GetHosts returns the host inventory, most recently seen first
+func (s *Store) GetHosts() ([]Host, error) {
+	var hosts []Host
+	if err := preloadHosts(s.DB).Order("last_seen desc").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	return hosts, s.enrichHosts(hosts)
+}
+
+// GetHost returns one host with its addresses and hostnames
+func (s *Store) GetHost(id uint) (Host, error) {
+	var host Host
+	if err := preloadHosts(s.DB).Take(&host, id).Error; err != nil {
+		return host, err
+	}
+	hosts := []Host{host}
+	err := s.enrichHosts(hosts)
+	return hosts[0], err
+}
+
+// GetHostsByID returns the given hosts keyed by ID
+func (s *Store) GetHostsByID(ids []uint) (map[uint]Host, error) {
+	hosts := make(map[uint]Host)
+	if len(ids) == 0 {
+		return hosts, nil
+	}
+
+	var found []Host
+	if err := preloadHosts(s.DB).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if err := s.enrichHosts(found); err != nil {
+		return nil, err
+	}
+	for _, host := range found {
+		hosts[host.ID] = host
+	}
+	return hosts, nil
+}
+
+// GetAddressOwners returns the host last seen at each of the given addresses
+func (s *Store) GetAddressOwners(clientIPs []string) (map[string]uint, error) {
+	owners := make(map[string]uint)
+	if len(clientIPs) == 0 {
+		return owners, nil
+	}
+
+	var addresses []HostAddress
+	if err := s.DB.Where("client_ip IN ?", clientIPs).Order("last_seen").Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		owners[address.ClientIP] = address.HostID
+	}
+	return owners, nil
+}
+
+// UpdateHost sets the user-editable details of a host
+func (s *Store) UpdateHost(id uint, name string, tags []string, notes string) (Host, error) {
+	var cleaned []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+
+	result := s.DB.Model(&Host{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":  strings.TrimSpace(name),
+		"tags":  strings.Join(cleaned, ","),
+		"notes": notes,
+	})
+	if result.Error != nil {
+		return Host{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Host{}, gorm.ErrRecordNotFound
+	}
+	return s.GetHost(id)
+}
+
+// migrateHosts builds the inventory from logs stored before hosts were tracked
+func (s *Store) migrateHosts() error {
+	var unassigned []Log
+	if err := s.DB.Select("id").Where("host_id = 0").Limit(1).Find(&unassigned).Error; err != nil {
+		return err
+	}
+	if len(unassigned) == 0 {
+		return nil
+	}
+
+	var groups []struct {
+		ClientIP string
+		Hostname string
+		FirstID  uint
+		LastID   uint
+	}
+	err := s.DB.Model(&Log{}).
+		Select("client_ip, hostname, MIN(id) AS first_id, MAX(id) AS last_id").
+		Where("host_id = 0").
+		Group("client_ip, hostname").
+		Order("last_id").
+		Scan(&groups).Error
+	if err != nil {
+		return err
+	}
+	log.Printf("Building the host inventory from %d existing sources", len(groups))
+
+	for _, group := range groups {
+		var bounds []Log
+		if err := s.DB.Select("id", "received_at").Where("id IN ?", []uint{group.FirstID, group.LastID}).Find(&bounds).Error; err != nil {
+			return err
+		}
+
+		name := hostIdentity(group.ClientIP, group.Hostname)
+		var id uint
+		for _, bound := range bounds {
+			if id, err = s.observeHost(group.ClientIP, name, bound.ReceivedAt); err != nil {
+				return err
+			}
+		}
+
+		err := s.DB.Model(&Log{}).
+			Where("client_ip = ? AND hostname = ? AND host_id = 0", group.ClientIP, group.Hostname).
+			Update("host_id", id).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestResolveHost follows devices across DHCP leases by hostname
+func TestResolveHost(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	resolve := func(minute int, clientIP, hostname string) uint {
+		t.Helper()
+		id, err := store.ResolveHost(clientIP, hostname, start.Add(time.Duration(minute)*time.Minute))
+		if err != nil {
+			t.Fatalf("ResolveHost(%s, %s) returned an error: %v", clientIP, hostname, err)
+		}
+		return id
+	}
+
+	kitchen := resolve(0, "192.168.1.5", "ap-kitchen")
+	if moved := resolve(5, "192.168.1.9", "ap-kitchen"); moved != kitchen {
+		t.Errorf("Expected ap-kitchen to keep its host after a new lease, got %d and %d", kitchen, moved)
+	}
+	if unnamed := resolve(6, "192.168.1.9", ""); unnamed != kitchen {
+		t.Errorf("Expected a log without hostname to belong to the address holder, got %d", unnamed)
+	}
+	laptop := resolve(10, "192.168.1.5", "laptop")
+	if laptop == kitchen {
+		t.Error("Expected a new device on a reused address to get its own host")
+	}
+	if first, second := resolve(11, "192.168.1.20", "OpenWrt"), resolve(12, "192.168.1.21", "OpenWrt"); first == second {
+		t.Error("Expected devices sharing a default hostname to stay apart")
+	}
+
+	host, err := store.GetHost(kitchen)
+	if err != nil {
+		t.Fatalf("GetHost returned an error: %v", err)
+	}
+	if addresses := host.AddressList(); !slices.Equal(addresses, []string{"192.168.1.9", "192.168.1.5"}) {
+		t.Errorf("Expected both addresses, latest first, got %v", addresses)
+	}
+	if !host.FirstSeen.Equal(start) || !host.LastSeen.Equal(start.Add(6*time.Minute)) {
+		t.Errorf("Expected the host seen from minute 0 to 6, got %v to %v", host.FirstSeen, host.LastSeen)
+	}
+	if host.DisplayName() != "ap-kitchen" {
+		t.Errorf("Expected the hostname as display name, got %q", host.DisplayName())
+	}
+
+	host, err = store.UpdateHost(kitchen, " Kitchen AP ", []string{"wifi", " upstairs", "wifi", ""}, "ceiling mount")
+	if err != nil {
+		t.Fatalf("UpdateHost returned an error: %v", err)
+	}
+	if host.DisplayName() != "Kitchen AP" || host.Tags != "wifi,upstairs" || host.Notes != "ceiling mount" {
+		t.Errorf("Expected the edited details, got %q, %q, %q", host.DisplayName(), host.Tags, host.Notes)
+	}
+
+	owners, err := store.GetAddressOwners([]string{"192.168.1.5", "192.168.1.9"})
+	if err != nil {
+		t.Fatalf("GetAddressOwners returned an error: %v", err)
+	}
+	if owners["192.168.1.5"] != laptop || owners["192.168.1.9"] != kitchen {
+		t.Errorf("Expected the latest holders of each address, got %v", owners)
+	}
+
+	// Resolutions of hostnames a sender made up are not kept past their use
+	for i := 0; i < 50; i++ {
+		resolve(20, "192.168.1.66", fmt.Sprintf("spoofed-%d", i))
+	}
+	resolve(22, "192.168.1.5", "laptop")
+	if entries := len(store.hosts.entries); entries != 2 {
+		t.Errorf("Expected only the latest resolution and its address cached, got %d", entries)
+	}
+}
+
+// TestMigrateBuildsHostInventory verifies that logs stored before hosts were tracked are assigned hosts
+func TestMigrateBuildsHostInventory(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	now := time.Now()
+	logs := []Log{
+		{ClientIP: "10.0.0.1", Hostname: "nas", ReceivedAt: now.Add(-2 * time.Hour)},
+		{ClientIP: "10.0.0.2", Hostname: "nas", ReceivedAt: now.Add(-time.Hour)},
+		{ClientIP: "10.0.0.3", ReceivedAt: now},
+	}
+	if err := store.DB.Create(&logs).Error; err != nil {
+		t.Fatalf("Failed to create logs: %v", err)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate returned an error: %v", err)
+	}
+
+	if err := store.DB.Find(&logs).Error; err != nil {
+		t.Fatalf("Failed to read logs: %v", err)
+	}
+	if logs[0].HostID == 0 || logs[0].HostID != logs[1].HostID || logs[2].HostID == logs[0].HostID {
+		t.Fatalf("Expected the nas logs to share a host apart from 10.0.0.3, got %d, %d, %d",
+			logs[0].HostID, logs[1].HostID, logs[2].HostID)
+	}
+
+	hosts, err := store.GetHosts()
+	if err != nil {
+		t.Fatalf("GetHosts returned an error: %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].DisplayName() != "10.0.0.3" || hosts[1].DisplayName() != "nas" {
+		t.Errorf("Expected 10.0.0.3 and nas, most recent first, got %d hosts", len(hosts))
+	}
+	if len(hosts) == 2 && !hosts[1].FirstSeen.Equal(logs[0].ReceivedAt) {
+		t.Errorf("Expected nas first seen at its oldest log, got %v", hosts[1].FirstSeen)
+	}
+
+	page, err := store.GetFilteredLogs(LogFilter{HostIDs: []uint{logs[0].HostID}}, nil, nil, true)
+	if err != nil {
+		t.Fatalf("GetFilteredLogs returned an error: %v", err)
+	}
+	if page.Total != 2 {
+		t.Errorf("Expected both nas logs when filtering by host, got %d", page.Total)
+	}
+}
@@ -5,44 +5,102 @@ import (
 	"time"
 )
 
+// Log is a stored syslog message with two clocks: ReceivedAt is when hostlog
+// received it and DeviceTime the sender's timestamp, which may lack a year or zone
+// or come from a clock that was never set. Logs are paged by (received_at, id), and
+// deleted_at trails the indexes so that soft-delete filters are answered from them;
+// it has no index of its own because the SQLite planner would prefer it over the
+// ordered ones.
 type Log struct {
-	gorm.Model
-	ClientIP  string
-	Hostname  string
-	Content   string
-	Priority  int
-	Timestamp time.Time
+	ID         uint      `gorm:"primarykey;index:idx_logs_received_at,priority:2;index:idx_logs_client_ip_received_at,priority:3;index:idx_logs_host_id_received_at,priority:3"`
+	ReceivedAt time.Time `gorm:"autoCreateTime;index:idx_logs_received_at,priority:1;index:idx_logs_client_ip_received_at,priority:2;index:idx_logs_host_id_received_at,priority:2"`
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index:idx_logs_received_at,priority:3;index:idx_logs_client_ip_received_at,priority:4;index:idx_logs_host_id_received_at,priority:4"`
+	ClientIP   string         `gorm:"index:idx_logs_client_ip_received_at,priority:1;index:idx_logs_client_ip_device_time,priority:1"`
+	HostID     uint           `gorm:"not null;default:0;index:idx_logs_host_id_received_at,priority:1"` // The inventory host that sent the log
+	Hostname   string
+	Tag        string
+	Content    string
+	Priority   int
+	DeviceTime time.Time `gorm:"index:idx_logs_client_ip_device_time,priority:2"`
+	// Repeats counts the times the host sent the message in a row within the dedup
+	// window; ReceivedAt is the first time and LastReceivedAt the last
+	Repeats        int `gorm:"not null;default:1"`
+	LastReceivedAt time.Time
+	Fields         []Field `gorm:"-"` // Extracted by the parser pipeline; only set on ingest
 }
 
-func GetAllHosts() ([]string, error) {
+// logIndexes are the indexes declared on Log
+var logIndexes = []string{"idx_logs_received_at", "idx_logs_client_ip_received_at", "idx_logs_client_ip_device_time", "idx_logs_host_id_received_at"}
+
+// obsoleteLogIndexes were declared by earlier versions
+var obsoleteLogIndexes = []string{"idx_logs_deleted_at", "idx_logs_created_at", "idx_logs_client_ip_created_at", "idx_logs_client_ip_timestamp"}
+
+// GetAllHosts returns the distinct client IPs. Rather than scanning every row, it
+// seeks from one host to the next through idx_logs_client_ip_received_at.
+func (s *Store) GetAllHosts() ([]string, error) {
 	var hosts []string
-	result := DB.Model(&Log{}).Distinct("client_ip").Pluck("client_ip", &hosts)
+	result := s.DB.Raw(`WITH RECURSIVE hosts(client_ip) AS (
+		SELECT MIN(client_ip) FROM logs WHERE deleted_at IS NULL
+		UNION ALL
+		SELECT (SELECT MIN(client_ip) FROM logs WHERE client_ip > hosts.client_ip AND deleted_at IS NULL)
+		FROM hosts WHERE client_ip IS NOT NULL
+	) SELECT client_ip FROM hosts WHERE client_ip IS NOT NULL`).Scan(&hosts)
 	return hosts, result.Error
 }
 
-func GetLogs(host string, timeWindow time.Time) ([]Log, error) {
+// GetLogs returns the host's logs since the given time on the given clock
+func (s *Store) GetLogs(host string, since time.Time, clock Clock) ([]Log, error) {
+	column, err := s.timeColumn(host, clock)
+	if err != nil {
+		return nil, err
+	}
+
 	var logs []Log
-	result := DB.Model(&Log{}).Where("client_ip = ? AND timestamp > ?", host, timeWindow).Find(&logs)
+	result := s.DB.Model(&Log{}).Where("client_ip = ? AND "+column+" > ?", host, since).Find(&logs)
 	if result.Error != nil {
 		return logs, result.Error
 	}
 	return logs, nil
 }
 
-func GetCount(host string, oneHourAgo time.Time) (int64, error) {
+// GetCount counts the host's logs since the given time on the given clock
+func (s *Store) GetCount(host string, since time.Time, clock Clock) (int64, error) {
+	column, err := s.timeColumn(host, clock)
+	if err != nil {
+		return 0, err
+	}
+
 	var count int64
-	result := DB.Model(&Log{}).Where("client_ip = ? AND timestamp > ?", host, oneHourAgo).Count(&count)
+	result := s.DB.Model(&Log{}).Where("client_ip = ? AND "+column+" > ?", host, since).Count(&count)
 	if result.Error != nil {
 		return 0, result.Error
 	}
 	return count, nil
 }
 
-func GetFirst(host string) (Log, error) {
+// GetFirst returns the most recently received log of a host
+func (s *Store) GetFirst(host string) (Log, error) {
 	var log Log
-	result := DB.Where("client_ip = ?", host).Order("created_at desc").First(&log)
+	result := s.DB.Where("client_ip = ?", host).Order("received_at desc").Take(&log)
 	if result.Error != nil {
 		return log, result.Error
 	}
 	return log, nil
 }
+
+// deviceTimeColumn is the device time of a log, or its received time when it has
+// none, as Log.Time reads it; zero times are stored as 0001-01-01
+const deviceTimeColumn = "CASE WHEN device_time > '0001-01-02' THEN device_time ELSE received_at END"
+
+// timeColumn returns the expression of the host's times on clock
+func (s *Store) timeColumn(host string, clock Clock) (string, error) {
+	clock, err := s.HostClock(host, clock)
+	if err != nil {
+		return "", err
+	}
+	if clock == ClockDevice {
+		return deviceTimeColumn, nil
+	}
+	return "received_at", nil
+}
@@ -11,27 +11,27 @@ type LogField struct {
 	Count     int
 }
 
-func SaveLogFields(clientIP string, logParts map[string]interface{}) {
+func (s *Store) SaveLogFields(clientIP string, logParts map[string]interface{}) {
 	for fieldName := range logParts {
 		var logField LogField
-		result := DB.Where("client_ip = ? AND field_name = ?", clientIP, fieldName).First(&logField)
+		result := s.DB.Where("client_ip = ? AND field_name = ?", clientIP, fieldName).First(&logField)
 		if result.Error != nil {
 			logField = LogField{
 				ClientIP:  clientIP,
 				FieldName: fieldName,
 				Count:     1,
 			}
-			DB.Create(&logField)
+			s.DB.Create(&logField)
 		} else {
 			logField.Count++
-			DB.Save(&logField)
+			s.DB.Save(&logField)
 		}
 	}
 }
 
-func GetLogFieldsByClientIP(clientIP string) ([]LogField, error) {
+func (s *Store) GetLogFieldsByClientIP(clientIP string) ([]LogField, error) {
 	var logFields []LogField
-	result := DB.Where("client_ip = ?", clientIP).Order("count desc").Find(&logFields)
+	result := s.DB.Where("client_ip = ?", clientIP).Order("count desc").Find(&logFields)
 	if result.Error != nil {
 		return nil, result.Error
 	}
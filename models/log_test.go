@@ -0,0 +1,492 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// hotQuery is a log query whose SQLite plan must be served by an index
+type hotQuery struct {
+	name string
+	run  func(s *Store) error
+	// sorted allows a temporary B-tree, e.g. to merge several hosts into one order
+	sorted bool
+}
+
+var hotQueries = []hotQuery{
+	{name: "GetFilteredLogs", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{}, nil, nil, false)
+		return err
+	}},
+	{name: "GetFilteredLogsBefore", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{}, &Cursor{ReceivedAt: time.Now().Add(-24 * time.Hour), ID: 500}, nil, false)
+		return err
+	}},
+	{name: "GetFilteredLogsAfter", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{}, nil, &Cursor{ReceivedAt: time.Now().Add(-24 * time.Hour), ID: 500}, false)
+		return err
+	}},
+	{name: "GetFilteredLogsCount", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{}, nil, nil, true)
+		return err
+	}},
+	{name: "GetFilteredLogsByHost", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{Hosts: []string{"10.0.0.7"}}, &Cursor{ReceivedAt: time.Now().Add(-24 * time.Hour), ID: 500}, nil, false)
+		return err
+	}},
+	{name: "GetFilteredLogsByHostID", run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{HostIDs: []uint{8}}, &Cursor{ReceivedAt: time.Now().Add(-24 * time.Hour), ID: 500}, nil, false)
+		return err
+	}},
+	// A field match is selective, so the matches are read by ID and sorted
+	{name: "GetFilteredLogsByField", sorted: true, run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{Fields: []FieldMatch{{Name: "port", Value: "7"}}}, &Cursor{ReceivedAt: time.Now().Add(-24 * time.Hour), ID: 500}, nil, true)
+		return err
+	}},
+	{name: "GetFilteredLogsByHosts", sorted: true, run: func(s *Store) error {
+		_, err := s.GetFilteredLogs(LogFilter{Hosts: []string{"10.0.0.7", "10.0.0.8"}}, nil, nil, false)
+		return err
+	}},
+	{name: "GetAllHosts", run: func(s *Store) error {
+		_, err := s.GetAllHosts()
+		return err
+	}},
+	{name: "GetLogs", run: func(s *Store) error {
+		_, err := s.GetLogs("10.0.0.7", time.Now().Add(-24*time.Hour), ClockReceived)
+		return err
+	}},
+	{name: "GetLogsDeviceTime", run: func(s *Store) error {
+		_, err := s.GetLogs("10.0.0.7", time.Now().Add(-24*time.Hour), ClockDevice)
+		return err
+	}},
+	{name: "GetCount", run: func(s *Store) error {
+		_, err := s.GetCount("10.0.0.7", time.Now().Add(-time.Hour), ClockReceived)
+		return err
+	}},
+	{name: "GetCountAutoClock", run: func(s *Store) error {
+		_, err := s.GetCount("10.0.0.7", time.Now().Add(-time.Hour), ClockAuto)
+		return err
+	}},
+	{name: "GetFirst", run: func(s *Store) error {
+		_, err := s.GetFirst("10.0.0.7")
+		return err
+	}},
+}
+
+// TestLogQueryPlans verifies that the hot log queries use indexes
+func TestLogQueryPlans(t *testing.T) {
+	t.Parallel()
+	store := openLogFixture(t, filepath.Join(t.TempDir(), "logs.db"), 1000)
+	defer store.Close()
+
+	for _, query := range hotQueries {
+		t.Run(query.name, func(t *testing.T) {
+			assertIndexed(t, store, query)
+		})
+	}
+}
+
+// TestGetFilteredLogsPaging walks the log pages down and back up by cursor
+func TestGetFilteredLogsPaging(t *testing.T) {
+	t.Parallel()
+	store := openLogFixture(t, filepath.Join(t.TempDir(), "logs.db"), 250)
+	defer store.Close()
+
+	var pages []LogPage
+	var before *Cursor
+	for {
+		page, err := store.GetFilteredLogs(LogFilter{}, before, nil, len(pages) == 0)
+		if err != nil {
+			t.Fatalf("GetFilteredLogs returned an error: %v", err)
+		}
+		pages = append(pages, page)
+		if page.Older == nil {
+			break
+		}
+		before = page.Older
+	}
+
+	if len(pages) != 3 || len(pages[0].Logs) != 100 || len(pages[2].Logs) != 50 {
+		t.Fatalf("Expected pages of 100, 100 and 50 logs, got %d pages", len(pages))
+	}
+	if pages[0].Total != 250 || pages[1].Total != -1 {
+		t.Errorf("Expected only the first page to be counted, got %d and %d", pages[0].Total, pages[1].Total)
+	}
+	if pages[0].Newer != nil || pages[1].Newer == nil || pages[2].Newer == nil {
+		t.Error("Expected newer cursors on every page but the first")
+	}
+	if pages[2].Logs[49].ID != 1 {
+		t.Errorf("Expected the last page to end with the oldest log, got %d", pages[2].Logs[49].ID)
+	}
+
+	up, err := store.GetFilteredLogs(LogFilter{}, nil, pages[2].Newer, false)
+	if err != nil {
+		t.Fatalf("GetFilteredLogs returned an error: %v", err)
+	}
+	if up.Logs[0].ID != pages[1].Logs[0].ID || up.Logs[99].ID != pages[1].Logs[99].ID {
+		t.Error("Expected paging up from the last page to return the middle page")
+	}
+
+	// Paging up past the newest logs returns the newest page
+	top, err := store.GetFilteredLogs(LogFilter{}, nil, pages[1].Newer, false)
+	if err != nil {
+		t.Fatalf("GetFilteredLogs returned an error: %v", err)
+	}
+	if top.Newer != nil || top.Logs[0].ID != 250 || len(top.Logs) != 100 {
+		t.Errorf("Expected the newest page, got %d logs starting at %d", len(top.Logs), top.Logs[0].ID)
+	}
+}
+
+// TestParseCursor verifies that cursors survive encoding
+func TestParseCursor(t *testing.T) {
+	cursor := Cursor{ReceivedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), ID: 42}
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("ParseCursor returned an error: %v", err)
+	}
+	if !parsed.ReceivedAt.Equal(cursor.ReceivedAt) || parsed.ID != cursor.ID {
+		t.Errorf("Expected %v, got %v", cursor, parsed)
+	}
+
+	for _, invalid := range []string{"", "42", "x-1", "1-x"} {
+		if _, err := ParseCursor(invalid); err == nil {
+			t.Errorf("Expected ParseCursor(%q) to fail", invalid)
+		}
+	}
+}
+
+// TestClockSkew verifies that a host with a bad clock is detected and its device times distrusted
+func TestClockSkew(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	// 10.0.0.1 keeps good time; 10.0.0.2 booted without NTP and thinks it is 1970
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		received := now.Add(-time.Duration(i) * time.Minute)
+		logs := []Log{
+			{ClientIP: "10.0.0.1", Content: "good", ReceivedAt: received, DeviceTime: received.Add(-2 * time.Second)},
+			{ClientIP: "10.0.0.2", Content: "bad", ReceivedAt: received, DeviceTime: time.Unix(int64(i), 0)},
+		}
+		if err := store.DB.Create(&logs).Error; err != nil {
+			t.Fatalf("Failed to create logs: %v", err)
+		}
+	}
+
+	skewed, err := store.GetSkewedClocks()
+	if err != nil {
+		t.Fatalf("GetSkewedClocks returned an error: %v", err)
+	}
+	if _, ok := skewed["10.0.0.2"]; !ok || len(skewed) != 1 {
+		t.Fatalf("Expected only 10.0.0.2 to be skewed, got %v", skewed)
+	}
+
+	for _, test := range []struct {
+		host  string
+		clock Clock
+		want  Clock
+	}{
+		{"10.0.0.1", ClockAuto, ClockDevice},
+		{"10.0.0.2", ClockAuto, ClockReceived},
+		{"10.0.0.2", ClockDevice, ClockDevice},
+	} {
+		clock, err := store.HostClock(test.host, test.clock)
+		if err != nil || clock != test.want {
+			t.Errorf("HostClock(%s, %s) = %s, %v; expected %s", test.host, test.clock, clock, err, test.want)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	for clock, want := range map[Clock]int64{ClockReceived: 5, ClockDevice: 0, ClockAuto: 5} {
+		count, err := store.GetCount("10.0.0.2", since, clock)
+		if err != nil || count != want {
+			t.Errorf("GetCount on the %s clock = %d, %v; expected %d", clock, count, err, want)
+		}
+	}
+
+	// Logs without a device time count by their received time on the device clock too
+	if err := store.DB.Create(&Log{ClientIP: "10.0.0.3", Content: "no timestamp", ReceivedAt: now}).Error; err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+	count, err := store.GetCount("10.0.0.3", since, ClockDevice)
+	if err != nil || count != 1 {
+		t.Errorf("Expected the log without a device time counted, got %d, %v", count, err)
+	}
+	logs, err := store.GetLogs("10.0.0.3", since, ClockDevice)
+	if err != nil || len(logs) != 1 {
+		t.Errorf("Expected the log without a device time returned, got %d, %v", len(logs), err)
+	}
+}
+
+// TestDeviceTime reads syslog timestamps in the device zone and in the year nearest to their receipt
+func TestDeviceTime(t *testing.T) {
+	t.Parallel()
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skipf("No zone database: %v", err)
+	}
+	store := &Store{DeviceZone: prague}
+
+	received := time.Date(2026, 7, 1, 10, 0, 5, 0, time.UTC)
+	// The parser read "Jul  1 12:00:00" sent at noon in Prague as UTC
+	if got := store.deviceTime(time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC), received); !got.Equal(received.Add(-5 * time.Second)) {
+		t.Errorf("Expected the wall clock read in Prague, got %v", got)
+	}
+
+	// "Dec 31 23:59:58" received on January 1 got the new year from the parser
+	received = time.Date(2027, 1, 1, 0, 0, 1, 0, prague)
+	if got := store.deviceTime(time.Date(2027, 12, 31, 23, 59, 58, 0, time.UTC), received); !got.Equal(received.Add(-3 * time.Second)) {
+		t.Errorf("Expected the previous year, got %v", got)
+	}
+
+	// Times that did not come from the parser are kept
+	local := time.Date(2026, 7, 1, 12, 0, 0, 0, prague)
+	if got := store.deviceTime(local, received); !got.Equal(local) || !store.deviceTime(time.Time{}, received).IsZero() {
+		t.Errorf("Expected zoned and zero times kept, got %v", got)
+	}
+}
+
+// TestMigrateBuildsLogIndexes verifies that migrating a database created before the
+// indexes existed builds them, drops the soft-delete index and renames the time columns
+func TestMigrateBuildsLogIndexes(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+
+	// The schema as created by earlier versions
+	type legacyLog struct {
+		gorm.Model
+		ClientIP  string
+		Hostname  string
+		Content   string
+		Priority  int
+		Timestamp time.Time
+	}
+	if err := store.DB.Table("logs").AutoMigrate(&legacyLog{}); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	sent := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	if err := store.DB.Table("logs").Create(&legacyLog{ClientIP: "10.0.0.1", Content: "old", Timestamp: sent}).Error; err != nil {
+		t.Fatalf("Failed to insert legacy log: %v", err)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate returned an error: %v", err)
+	}
+
+	migrator := store.DB.Migrator()
+	for _, name := range logIndexes {
+		if !migrator.HasIndex(&Log{}, name) {
+			t.Errorf("Expected index %s after migration", name)
+		}
+	}
+	if migrator.HasIndex(&Log{}, "idx_logs_deleted_at") {
+		t.Error("Expected idx_logs_deleted_at to be dropped")
+	}
+
+	hosts, err := store.GetAllHosts()
+	if err != nil || len(hosts) != 1 || hosts[0] != "10.0.0.1" {
+		t.Errorf("Expected the legacy host to survive migration, got %v, %v", hosts, err)
+	}
+
+	for _, column := range []string{"created_at", "timestamp"} {
+		if migrator.HasColumn(&Log{}, column) {
+			t.Errorf("Expected column %s to be renamed", column)
+		}
+	}
+	l, err := store.GetFirst("10.0.0.1")
+	if err != nil {
+		t.Fatalf("GetFirst returned an error: %v", err)
+	}
+	if !l.DeviceTime.Equal(sent) || l.ReceivedAt.IsZero() {
+		t.Errorf("Expected the legacy times to carry over, got received %v, device %v", l.ReceivedAt, l.DeviceTime)
+	}
+}
+
+var (
+	benchOnce  sync.Once
+	benchStore *Store
+	benchDir   string
+)
+
+// openBenchStore builds the benchmark fixture once per run. HOSTLOG_BENCH_ROWS
+// overrides its size of two million logs.
+func openBenchStore(b *testing.B) *Store {
+	b.Helper()
+	benchOnce.Do(func() {
+		rows := 2_000_000
+		if n, err := strconv.Atoi(os.Getenv("HOSTLOG_BENCH_ROWS")); err == nil && n > 0 {
+			rows = n
+		}
+		dir, err := os.MkdirTemp("", "hostlog-bench-")
+		if err != nil {
+			b.Fatalf("Failed to create fixture directory: %v", err)
+		}
+		benchDir = dir
+		start := time.Now()
+		benchStore = openLogFixture(b, filepath.Join(dir, "logs.db"), rows)
+		b.Logf("Built fixture of %d logs in %s", rows, time.Since(start))
+	})
+	if benchStore == nil {
+		b.Fatal("Benchmark fixture is unavailable")
+	}
+	return benchStore
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchStore != nil {
+		benchStore.Close()
+	}
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+func BenchmarkLogQueries(b *testing.B) {
+	store := openBenchStore(b)
+	for _, query := range hotQueries {
+		b.Run(query.name, func(b *testing.B) {
+			assertIndexed(b, store, query)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := query.run(store); err != nil {
+					b.Fatalf("%s returned an error: %v", query.name, err)
+				}
+			}
+		})
+	}
+}
+
+// openLogFixture creates a migrated SQLite store holding rows logs from 200 hosts,
+// received over the last 30 days
+func openLogFixture(tb testing.TB, path string, rows int) *Store {
+	tb.Helper()
+	store, err := OpenStore(path, false)
+	if err != nil {
+		tb.Fatalf("Failed to open store: %v", err)
+	}
+	if err := store.Migrate(); err != nil {
+		tb.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	sqlDB, err := store.DB.DB()
+	if err != nil {
+		tb.Fatalf("Failed to get connection: %v", err)
+	}
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		tb.Fatalf("Failed to begin fixture transaction: %v", err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO logs (received_at, updated_at, client_ip, host_id, hostname, content, priority, device_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tb.Fatalf("Failed to prepare fixture insert: %v", err)
+	}
+	fieldStmt, err := tx.Prepare("INSERT INTO fields (log_id, name, value) VALUES (?, 'port', ?)")
+	if err != nil {
+		tb.Fatalf("Failed to prepare fixture field insert: %v", err)
+	}
+
+	now := time.Now()
+	step := 30 * 24 * time.Hour / time.Duration(rows)
+	for i := 0; i < rows; i++ {
+		received := now.Add(-time.Duration(rows-i) * step)
+		host := fmt.Sprintf("10.0.0.%d", i%200)
+		content := fmt.Sprintf("fixture message %d", i)
+		if _, err := stmt.Exec(received, received, host, i%200+1, host, content, i%8, received.Add(-time.Second)); err != nil {
+			tb.Fatalf("Failed to insert fixture log: %v", err)
+		}
+		if _, err := fieldStmt.Exec(i+1, strconv.Itoa(i%1000)); err != nil {
+			tb.Fatalf("Failed to insert fixture field: %v", err)
+		}
+	}
+
+	stmt.Close()
+	fieldStmt.Close()
+	if err := tx.Commit(); err != nil {
+		tb.Fatalf("Failed to commit fixture: %v", err)
+	}
+	if err := store.DB.Exec("ANALYZE").Error; err != nil {
+		tb.Fatalf("Failed to analyze fixture: %v", err)
+	}
+	return store
+}
+
+// assertIndexed runs the query against a recording store and fails if SQLite plans
+// any statement on logs as a full table scan, or sorts without query.sorted
+func assertIndexed(tb testing.TB, store *Store, query hotQuery) {
+	tb.Helper()
+	traced, err := OpenStore(store.Path, true)
+	if err != nil {
+		tb.Fatalf("Failed to open store: %v", err)
+	}
+	defer traced.Close()
+
+	recorder := &sqlRecorder{}
+	recorder.register(traced.DB)
+
+	if err := query.run(traced); err != nil {
+		tb.Fatalf("%s returned an error: %v", query.name, err)
+	}
+	if len(recorder.statements) == 0 {
+		tb.Fatalf("%s ran no statements", query.name)
+	}
+
+	for _, statement := range recorder.statements {
+		var plan []struct {
+			ID     int
+			Parent int
+			Detail string
+		}
+		if err := store.DB.Raw("EXPLAIN QUERY PLAN "+statement.sql, statement.vars...).Scan(&plan).Error; err != nil {
+			tb.Fatalf("Failed to explain %s: %v", statement.sql, err)
+		}
+
+		var details []string
+		for _, step := range plan {
+			details = append(details, step.Detail)
+		}
+		for _, detail := range details {
+			if strings.HasPrefix(detail, "SCAN logs") && !strings.Contains(detail, "INDEX") {
+				tb.Errorf("%s scans logs without an index:\n%s\n%s", query.name, statement.sql, strings.Join(details, "\n"))
+			}
+			if strings.Contains(detail, "TEMP B-TREE") && !query.sorted {
+				tb.Errorf("%s sorts logs instead of reading them in index order:\n%s\n%s", query.name, statement.sql, strings.Join(details, "\n"))
+			}
+		}
+	}
+}
+
+// recordedStatement is a statement executed through a recorded handle
+type recordedStatement struct {
+	sql  string
+	vars []interface{}
+}
+
+// sqlRecorder records the statements a gorm handle executes
+type sqlRecorder struct {
+	mu         sync.Mutex
+	statements []recordedStatement
+}
+
+func (r *sqlRecorder) register(db *gorm.DB) {
+	record := func(db *gorm.DB) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.statements = append(r.statements, recordedStatement{db.Statement.SQL.String(), db.Statement.Vars})
+	}
+	db.Callback().Query().After("gorm:query").Register("test:record", record)
+	db.Callback().Row().After("gorm:row").Register("test:record", record)
+	db.Callback().Raw().After("gorm:raw").Register("test:record", record)
+}
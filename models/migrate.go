@@ -0,0 +1,55 @@
+package models
+
+import "log"
+
+// migrateLogs brings the logs table of an existing database up to date before
+// AutoMigrate runs: it renames the clock columns of earlier versions, adds the
+// host column, replaces their indexes and announces index builds, which can take
+// a while.
+func (s *Store) migrateLogs() error {
+	migrator := s.DB.Migrator()
+	if !migrator.HasTable(&Log{}) {
+		return nil
+	}
+
+	for _, name := range obsoleteLogIndexes {
+		if migrator.HasIndex(&Log{}, name) {
+			if err := migrator.DropIndex(&Log{}, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for old, column := range map[string]string{"created_at": "received_at", "timestamp": "device_time"} {
+		if migrator.HasColumn(&Log{}, old) && !migrator.HasColumn(&Log{}, column) {
+			log.Printf("Renaming logs column %s to %s", old, column)
+			if err := migrator.RenameColumn(&Log{}, old, column); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !migrator.HasColumn(&Log{}, "host_id") {
+		if err := migrator.AddColumn(&Log{}, "HostID"); err != nil {
+			return err
+		}
+	}
+
+	built := false
+	for _, name := range logIndexes {
+		if migrator.HasIndex(&Log{}, name) {
+			continue
+		}
+		log.Printf("Building index %s on existing logs, this may take a while", name)
+		if err := migrator.CreateIndex(&Log{}, name); err != nil {
+			return err
+		}
+		built = true
+	}
+
+	// Refresh planner statistics for the new indexes
+	if built {
+		return s.DB.Exec("ANALYZE logs").Error
+	}
+	return nil
+}
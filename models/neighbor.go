@@ -0,0 +1,301 @@
+package models
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Neighbor is what the router's DHCP leases and static mappings say about an address
+type Neighbor struct {
+	MAC     string
+	Vendor  string    // Of the MAC, filled in for hosts
+	Names   []string  // Lease hostname first, then the ethers and hosts names
+	Expires time.Time // Lease expiry; zero for static mappings and infinite leases
+}
+
+// NeighborFiles names the files neighbors are read from
+type NeighborFiles struct {
+	Leases []string // dnsmasq lease files: expiry, MAC, address, hostname, client ID
+	Ethers []string // ethers files: MAC, then an address or hostname
+	Hosts  []string // hosts files, including the odhcpd lease file: address, then names
+}
+
+// fileStamp identifies one version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Neighbors indexes the router's files by address and reloads them when they change
+type Neighbors struct {
+	files NeighborFiles
+
+	mu     sync.RWMutex
+	byIP   map[string]Neighbor
+	stamps map[string]fileStamp
+}
+
+// NewNeighbors returns an empty index of the given files; Reload reads them
+func NewNeighbors(files NeighborFiles) *Neighbors {
+	return &Neighbors{files: files, byIP: make(map[string]Neighbor)}
+}
+
+// Lookup returns what is known about an address
+func (n *Neighbors) Lookup(clientIP string) (Neighbor, bool) {
+	if n == nil {
+		return Neighbor{}, false
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	neighbor, ok := n.byIP[clientIP]
+	return neighbor, ok
+}
+
+// Watch reloads the files whenever one of them changes
+func (n *Neighbors) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := n.Reload(); err != nil {
+			log.Printf("Error reloading neighbor files: %v", err)
+		}
+	}
+}
+
+// Reload rebuilds the index when a file has appeared, changed or disappeared since
+// the last load, and reports whether it did. Missing files are skipped.
+func (n *Neighbors) Reload() (bool, error) {
+	stamps := make(map[string]fileStamp)
+	for _, path := range n.paths() {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	n.mu.RLock()
+	unchanged := n.stamps != nil && sameStamps(n.stamps, stamps)
+	n.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	byIP, err := n.load(stamps)
+	if err != nil {
+		return false, err
+	}
+
+	n.mu.Lock()
+	n.byIP = byIP
+	n.stamps = stamps
+	n.mu.Unlock()
+	return true, nil
+}
+
+// paths lists every configured file
+func (n *Neighbors) paths() []string {
+	return slices.Concat(n.files.Leases, n.files.Ethers, n.files.Hosts)
+}
+
+// sameStamps reports whether two sets of files are at the same versions
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
+
+// neighborIndex collects entries while the files are read
+type neighborIndex struct {
+	leases   map[string]Neighbor // Address to lease
+	macs     map[string]string   // Address to MAC from ethers
+	macNames map[string][]string // MAC to ethers names
+	names    map[string][]string // Address to hosts names
+	ips      map[string]string   // Hosts name to address
+}
+
+// load reads the files present in stamps into a fresh index
+func (n *Neighbors) load(stamps map[string]fileStamp) (map[string]Neighbor, error) {
+	index := neighborIndex{
+		leases:   make(map[string]Neighbor),
+		macs:     make(map[string]string),
+		macNames: make(map[string][]string),
+		names:    make(map[string][]string),
+		ips:      make(map[string]string),
+	}
+
+	// Hosts files first, so that ethers entries can name their address by hostname
+	for _, kind := range []struct {
+		paths []string
+		parse func(*neighborIndex, io.Reader) error
+	}{
+		{n.files.Hosts, (*neighborIndex).parseHosts},
+		{n.files.Ethers, (*neighborIndex).parseEthers},
+		{n.files.Leases, (*neighborIndex).parseLeases},
+	} {
+		for _, path := range kind.paths {
+			if _, ok := stamps[path]; !ok {
+				continue
+			}
+			if err := index.parseFile(path, kind.parse); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return index.neighbors(), nil
+}
+
+// parseFile parses one file, skipping it when it has disappeared since it was stat'ed
+func (index *neighborIndex) parseFile(path string, parse func(*neighborIndex, io.Reader) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return parse(index, file)
+}
+
+// neighborFields splits a line into fields, dropping comments
+func neighborFields(line string) []string {
+	line, _, _ = strings.Cut(line, "#")
+	return strings.Fields(line)
+}
+
+// normalizeMAC returns a MAC address in lower case with colons, or "" when it is not one
+func normalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return ""
+	}
+	return hw.String()
+}
+
+// neighborName returns a name worth showing, or "" for placeholders and vendor defaults
+func neighborName(name string) string {
+	if name == "*" || hostIdentity("", name) == "" {
+		return ""
+	}
+	return name
+}
+
+// parseHosts reads "address name aliases..." lines
+func (index *neighborIndex) parseHosts(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := neighborFields(scanner.Text())
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			if name = neighborName(name); name != "" {
+				index.names[fields[0]] = appendNew(index.names[fields[0]], name)
+				index.ips[name] = fields[0]
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseEthers reads "MAC address-or-hostname" lines
+func (index *neighborIndex) parseEthers(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := neighborFields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mac := normalizeMAC(fields[0])
+		if mac == "" {
+			continue
+		}
+		if net.ParseIP(fields[1]) != nil {
+			index.macs[fields[1]] = mac
+			continue
+		}
+		if name := neighborName(fields[1]); name != "" {
+			index.macNames[mac] = appendNew(index.macNames[mac], name)
+			if ip, ok := index.ips[name]; ok {
+				index.macs[ip] = mac
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseLeases reads dnsmasq "expiry MAC address hostname client-id" lines
+func (index *neighborIndex) parseLeases(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := neighborFields(scanner.Text())
+		if len(fields) < 4 || net.ParseIP(fields[2]) == nil {
+			continue
+		}
+		lease := Neighbor{MAC: normalizeMAC(fields[1])}
+		if expiry, err := strconv.ParseInt(fields[0], 10, 64); err == nil && expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+		if name := neighborName(fields[3]); name != "" {
+			lease.Names = []string{name}
+		}
+		index.leases[fields[2]] = lease
+	}
+	return scanner.Err()
+}
+
+// neighbors merges the entries by address
+func (index *neighborIndex) neighbors() map[string]Neighbor {
+	byIP := make(map[string]Neighbor)
+	for ip, lease := range index.leases {
+		byIP[ip] = lease
+	}
+	for ip, mac := range index.macs {
+		neighbor := byIP[ip]
+		if neighbor.MAC == "" {
+			neighbor.MAC = mac
+		}
+		byIP[ip] = neighbor
+	}
+	for ip := range index.names {
+		byIP[ip] = byIP[ip]
+	}
+
+	for ip, neighbor := range byIP {
+		neighbor.Names = slices.Clone(neighbor.Names)
+		for _, name := range index.macNames[neighbor.MAC] {
+			neighbor.Names = appendNew(neighbor.Names, name)
+		}
+		for _, name := range index.names[ip] {
+			neighbor.Names = appendNew(neighbor.Names, name)
+		}
+		byIP[ip] = neighbor
+	}
+	return byIP
+}
+
+// appendNew appends value unless it is already present
+func appendNew(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
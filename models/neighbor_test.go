@@ -0,0 +1,100 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestNeighbors reads OpenWrt lease, ethers and hosts files and follows their changes
+func TestNeighbors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	leases := write("dhcp.leases", `1760800000 AA:BB:CC:00:00:01 192.168.1.20 ap-kitchen 01:aa:bb:cc:00:00:01
+0 aa:bb:cc:00:00:02 192.168.1.30 * *
+1760800000 1234567 fd00::30 laptop 00:01:00:01
+duid 00:01:00:01:2a:2b:2c:2d
+`)
+	ethers := write("ethers", `# static mappings
+aa:bb:cc:00:00:02 printer
+aa-bb-cc-00-00-03 192.168.1.40
+aa:bb:cc:00:00:04 nas
+`)
+	hosts := write("hosts", `127.0.0.1 localhost
+192.168.1.40 camera cam-door # front door
+192.168.1.50 nas
+`)
+
+	neighbors := NewNeighbors(NeighborFiles{
+		Leases: []string{leases},
+		Ethers: []string{ethers},
+		Hosts:  []string{hosts, filepath.Join(dir, "missing")},
+	})
+	if changed, err := neighbors.Reload(); err != nil || !changed {
+		t.Fatalf("Expected the first Reload to load the files, got %v, %v", changed, err)
+	}
+
+	for _, test := range []struct {
+		address string
+		want    Neighbor
+	}{
+		{"192.168.1.20", Neighbor{MAC: "aa:bb:cc:00:00:01", Names: []string{"ap-kitchen"}, Expires: time.Unix(1760800000, 0)}},
+		{"192.168.1.30", Neighbor{MAC: "aa:bb:cc:00:00:02", Names: []string{"printer"}}},
+		{"192.168.1.40", Neighbor{MAC: "aa:bb:cc:00:00:03", Names: []string{"camera", "cam-door"}}},
+		{"192.168.1.50", Neighbor{MAC: "aa:bb:cc:00:00:04", Names: []string{"nas"}}},
+		{"fd00::30", Neighbor{Names: []string{"laptop"}, Expires: time.Unix(1760800000, 0)}},
+	} {
+		got, ok := neighbors.Lookup(test.address)
+		if !ok || got.MAC != test.want.MAC || !slices.Equal(got.Names, test.want.Names) || !got.Expires.Equal(test.want.Expires) {
+			t.Errorf("Expected %+v for %s, got %+v", test.want, test.address, got)
+		}
+	}
+	if got, ok := neighbors.Lookup("127.0.0.1"); ok {
+		t.Errorf("Expected no neighbor for localhost, got %+v", got)
+	}
+
+	if changed, err := neighbors.Reload(); err != nil || changed {
+		t.Errorf("Expected unchanged files to be kept, got %v, %v", changed, err)
+	}
+
+	write("dhcp.leases", "0 aa:bb:cc:00:00:01 192.168.1.21 ap-kitchen *\n")
+	if changed, err := neighbors.Reload(); err != nil || !changed {
+		t.Fatalf("Expected a changed lease file to be reloaded, got %v, %v", changed, err)
+	}
+	if _, ok := neighbors.Lookup("192.168.1.20"); ok {
+		t.Error("Expected the old lease to be gone")
+	}
+	if got, _ := neighbors.Lookup("192.168.1.21"); got.MAC != "aa:bb:cc:00:00:01" {
+		t.Errorf("Expected the new lease, got %+v", got)
+	}
+
+	// Hosts loaded from the store carry the neighbor details of their addresses
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+	store.Neighbors = neighbors
+
+	id, err := store.ResolveHost("192.168.1.21", "OpenWrt", time.Now())
+	if err != nil {
+		t.Fatalf("ResolveHost returned an error: %v", err)
+	}
+	host, err := store.GetHost(id)
+	if err != nil {
+		t.Fatalf("GetHost returned an error: %v", err)
+	}
+	if host.Neighbor.MAC != "aa:bb:cc:00:00:01" || host.DisplayName() != "ap-kitchen" {
+		t.Errorf("Expected the lease to name the host and give its MAC, got %q and %q", host.DisplayName(), host.Neighbor.MAC)
+	}
+}
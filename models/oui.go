@@ -0,0 +1,178 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// embeddedOUI is the IEEE MA-L registry in the format WriteTo writes, compressed
+//
+//go:generate go run oui_generate.go
+//go:embed oui.tsv.gz
+var embeddedOUI []byte
+
+// VendorsFile is the vendor database in the data directory that replaces the embedded one
+const VendorsFile = "oui.tsv"
+
+// Vendors maps the organizationally unique identifiers of MAC addresses to their vendors
+type Vendors struct {
+	prefixes map[string]string // Upper-case hex OUI to organization
+}
+
+// ouiLine matches the assignment lines of the IEEE oui.txt ("00-00-0C   (hex)  Cisco
+// Systems, Inc") and of the database written by WriteTo ("00000C<tab>Cisco Systems, Inc")
+var ouiLine = regexp.MustCompile(`^([0-9A-Fa-f]{2})[-:]?([0-9A-Fa-f]{2})[-:]?([0-9A-Fa-f]{2})\s+(?:\((?:hex|base 16)\)\s+)?(\S.*)$`)
+
+// macPattern finds MAC addresses in log content
+var macPattern = regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}[:-]){5}[0-9a-fA-F]{2}\b`)
+
+// ParseVendors reads a vendor database: the IEEE oui.txt or oui.csv registry, or a
+// file written by WriteTo
+func ParseVendors(r io.Reader) (*Vendors, error) {
+	vendors := &Vendors{prefixes: make(map[string]string)}
+	reader := bufio.NewReader(r)
+
+	if header, _ := reader.Peek(len("Registry,")); string(header) == "Registry," {
+		records, err := csv.NewReader(reader).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records[1:] {
+			if len(record) >= 3 && record[0] == "MA-L" {
+				vendors.add(record[1], record[2])
+			}
+		}
+		return vendors, nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if m := ouiLine.FindStringSubmatch(strings.TrimSpace(scanner.Text())); m != nil {
+			vendors.add(m[1]+m[2]+m[3], m[4])
+		}
+	}
+	return vendors, scanner.Err()
+}
+
+// add records a vendor, keeping the first name given for a prefix
+func (v *Vendors) add(oui, organization string) {
+	oui = strings.ToUpper(oui)
+	organization = strings.TrimSpace(organization)
+	if _, err := hex.DecodeString(oui); err != nil || len(oui) != 6 || organization == "" {
+		return
+	}
+	if _, ok := v.prefixes[oui]; !ok {
+		v.prefixes[oui] = organization
+	}
+}
+
+// LoadVendors returns the vendor database in dataDir, or the embedded one when there is none
+func LoadVendors(dataDir string) (*Vendors, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, VendorsFile))
+	if os.IsNotExist(err) {
+		embedded, err := gzip.NewReader(bytes.NewReader(embeddedOUI))
+		if err != nil {
+			return nil, err
+		}
+		return ParseVendors(embedded)
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseVendors(bytes.NewReader(data))
+}
+
+// UpdateVendors replaces the vendor database in dataDir with the one read from r
+// and returns the number of prefixes written
+func UpdateVendors(dataDir string, r io.Reader) (int, error) {
+	vendors, err := ParseVendors(r)
+	if err != nil {
+		return 0, err
+	}
+	if vendors.Len() == 0 {
+		return 0, fmt.Errorf("no vendor prefixes found")
+	}
+
+	// Written aside and renamed, so that a running process never reads half a file
+	path := filepath.Join(dataDir, VendorsFile)
+	file, err := os.CreateTemp(dataDir, VendorsFile+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := vendors.WriteTo(file); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return vendors.Len(), os.Rename(file.Name(), path)
+}
+
+// Len returns the number of known prefixes
+func (v *Vendors) Len() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.prefixes)
+}
+
+// Lookup returns the vendor of a MAC address, or "" when it is unknown or locally
+// administered, as randomized addresses are
+func (v *Vendors) Lookup(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if v == nil || err != nil || len(hw) < 3 || hw[0]&0x02 != 0 {
+		return ""
+	}
+	return v.prefixes[strings.ToUpper(hex.EncodeToString(hw[:3]))]
+}
+
+// MACVendor is a MAC address found in a log with its vendor
+type MACVendor struct {
+	MAC    string
+	Vendor string
+}
+
+// Annotate returns the MAC addresses in content that have a known vendor
+func (v *Vendors) Annotate(content string) []MACVendor {
+	var found []MACVendor
+	for _, mac := range macPattern.FindAllString(content, -1) {
+		vendor := v.Lookup(mac)
+		if vendor == "" || slices.ContainsFunc(found, func(f MACVendor) bool { return f.MAC == mac }) {
+			continue
+		}
+		found = append(found, MACVendor{MAC: mac, Vendor: vendor})
+	}
+	return found
+}
+
+// WriteTo writes the database in the format ParseVendors reads fastest, sorted by prefix
+func (v *Vendors) WriteTo(w io.Writer) (int64, error) {
+	prefixes := make([]string, 0, len(v.prefixes))
+	for oui := range v.prefixes {
+		prefixes = append(prefixes, oui)
+	}
+	slices.Sort(prefixes)
+
+	var written int64
+	for _, oui := range prefixes {
+		n, err := fmt.Fprintf(w, "%s\t%s\n", oui, v.prefixes[oui])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,72 @@
+//go:build ignore
+
+// oui_generate writes oui.tsv.gz, the embedded MAC vendor database, from the IEEE
+// MA-L registry: the oui.csv or oui.txt named on the command line, or else the
+// one downloaded from the IEEE. Run it through go generate ./models.
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"hostlog/models"
+)
+
+const registryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+func main() {
+	registry, err := openRegistry()
+	if err != nil {
+		log.Fatalf("Failed to read the registry: %v", err)
+	}
+	defer registry.Close()
+
+	vendors, err := models.ParseVendors(registry)
+	if err != nil {
+		log.Fatalf("Failed to parse the registry: %v", err)
+	}
+	if vendors.Len() == 0 {
+		log.Fatal("No vendor prefixes found")
+	}
+
+	file, err := os.Create("oui.tsv.gz")
+	if err != nil {
+		log.Fatalf("Failed to create oui.tsv.gz: %v", err)
+	}
+	compressed, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
+	if _, err := vendors.WriteTo(compressed); err != nil {
+		log.Fatalf("Failed to write oui.tsv.gz: %v", err)
+	}
+	if err := compressed.Close(); err != nil {
+		log.Fatalf("Failed to write oui.tsv.gz: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write oui.tsv.gz: %v", err)
+	}
+	fmt.Printf("Wrote %d vendor prefixes to oui.tsv.gz\n", vendors.Len())
+}
+
+// openRegistry opens the registry file given as argument, or downloads it
+func openRegistry() (io.ReadCloser, error) {
+	if len(os.Args) > 1 {
+		return os.Open(os.Args[1])
+	}
+	request, err := http.NewRequest("GET", registryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "hostlog-oui-generate")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("%s: %s", registryURL, response.Status)
+	}
+	return response.Body, nil
+}
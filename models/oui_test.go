@@ -0,0 +1,89 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestParseVendors reads the IEEE registry formats and looks up MAC addresses
+func TestParseVendors(t *testing.T) {
+	t.Parallel()
+
+	for name, registry := range map[string]string{
+		"oui.txt": `OUI/MA-L                                                    Organization
+company_id                                                  Organization
+                                                            Address
+
+B8-27-EB   (hex)		Raspberry Pi Foundation
+B827EB     (base 16)		Raspberry Pi Foundation
+				Mitchell Wood House
+				Caldecote  Cambridgeshire  CB23 7NU
+				GB
+
+00-17-88   (hex)		Philips Lighting BV
+001788     (base 16)		Philips Lighting BV
+`,
+		"oui.csv": `Registry,Assignment,Organization Name,Organization Address
+MA-L,B827EB,Raspberry Pi Foundation,"Mitchell Wood House Caldecote Cambridgeshire US CB23 7NU"
+MA-L,001788,"Philips Lighting BV","High Tech Campus 48 Eindhoven NL 5656 AE"
+MA-M,001BC5000,Converging Systems Inc.,"Somewhere"
+`,
+	} {
+		vendors, err := ParseVendors(strings.NewReader(registry))
+		if err != nil {
+			t.Fatalf("ParseVendors(%s) returned an error: %v", name, err)
+		}
+		if vendors.Len() != 2 {
+			t.Errorf("Expected 2 prefixes from %s, got %d", name, vendors.Len())
+		}
+		if vendor := vendors.Lookup("b8:27:eb:12:34:56"); vendor != "Raspberry Pi Foundation" {
+			t.Errorf("Expected Raspberry Pi Foundation from %s, got %q", name, vendor)
+		}
+		if vendor := vendors.Lookup("00-17-88-AB-CD-EF"); vendor != "Philips Lighting BV" {
+			t.Errorf("Expected Philips Lighting BV from %s, got %q", name, vendor)
+		}
+	}
+
+	vendors, err := LoadVendors(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadVendors returned an error: %v", err)
+	}
+	if vendors.Len() == 0 || vendors.Lookup("b8:27:eb:00:00:01") != "Raspberry Pi Foundation" {
+		t.Errorf("Expected the embedded database, got %d prefixes", vendors.Len())
+	}
+	if vendor := vendors.Lookup("ba:27:eb:00:00:01"); vendor != "" {
+		t.Errorf("Expected no vendor for a locally administered address, got %q", vendor)
+	}
+
+	found := vendors.Annotate("wlan0: STA b8:27:eb:00:00:01 IEEE 802.11: associated; STA 02:11:22:33:44:55 left; STA b8:27:eb:00:00:01 authorized")
+	if !slices.Equal(found, []MACVendor{{MAC: "b8:27:eb:00:00:01", Vendor: "Raspberry Pi Foundation"}}) {
+		t.Errorf("Expected one annotated MAC address, got %+v", found)
+	}
+}
+
+// TestUpdateVendors verifies that an installed database replaces the embedded one
+func TestUpdateVendors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	if _, err := UpdateVendors(dir, strings.NewReader("not a registry\n")); err == nil {
+		t.Error("Expected an error for a file without prefixes")
+	}
+
+	count, err := UpdateVendors(dir, strings.NewReader("00-1A-2B   (hex)\t\tExample Corp\n"))
+	if err != nil || count != 1 {
+		t.Fatalf("Expected one prefix written, got %d, %v", count, err)
+	}
+
+	vendors, err := LoadVendors(dir)
+	if err != nil {
+		t.Fatalf("LoadVendors returned an error: %v", err)
+	}
+	if vendors.Len() != 1 || vendors.Lookup("00:1a:2b:00:00:01") != "Example Corp" {
+		t.Errorf("Expected only the installed database, got %d prefixes", vendors.Len())
+	}
+	if vendor := vendors.Lookup("b8:27:eb:00:00:01"); vendor != "" {
+		t.Errorf("Expected the embedded database to be replaced, got %q", vendor)
+	}
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Pattern is a message template with its variable parts masked, tracked per host.
+// Patterns are unique by the digest of their text, which may be too long to index.
+type Pattern struct {
+	gorm.Model
+	ClientIP  string `gorm:"uniqueIndex:idx_patterns_client_ip_hash"`
+	Hash      string `gorm:"uniqueIndex:idx_patterns_client_ip_hash"`
+	Pattern   string
+	Example   string
+	Count     int
+	FirstSeen time.Time `gorm:"index"`
+	LastSeen  time.Time
+}
+
+var patternMasks = []struct {
+	re   *regexp.Regexp
+	mask string
+}{
+	{macPattern, "<mac>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<hex>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]*\d[0-9a-fA-F]*\b`), "<num>"},
+}
+
+// MessagePattern masks addresses and numbers so that repeated messages share one pattern
+func MessagePattern(content string) string {
+	for _, m := range patternMasks {
+		content = m.re.ReplaceAllString(content, m.mask)
+	}
+	return content
+}
+
+// patternHash returns the digest a pattern is unique by
+func patternHash(pattern string) string {
+	sum := sha256.Sum256([]byte(pattern))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveLogPattern counts a message towards its host's pattern, creating the pattern when new
+func (s *Store) SaveLogPattern(clientIP, content string, seen time.Time) error {
+	pattern := MessagePattern(content)
+	p := Pattern{
+		ClientIP:  clientIP,
+		Hash:      patternHash(pattern),
+		Pattern:   pattern,
+		Example:   content,
+		Count:     1,
+		FirstSeen: seen,
+		LastSeen:  seen,
+	}
+	return s.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "client_ip"}, {Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      gorm.Expr("patterns.count + 1"),
+			"last_seen":  seen,
+			"updated_at": time.Now(),
+		}),
+	}).Create(&p).Error
+}
+
+// migratePatterns merges the duplicate patterns concurrent writes of earlier
+// versions created and fills in the digests, so that the unique index can be built
+func (s *Store) migratePatterns() error {
+	migrator := s.DB.Migrator()
+	if !migrator.HasTable(&Pattern{}) || migrator.HasIndex(&Pattern{}, "idx_patterns_client_ip_hash") {
+		return nil
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		if migrator.HasIndex(&Pattern{}, "idx_patterns_client_ip_pattern") {
+			// Unique patterns indexed by their text, which PostgreSQL cannot index when long
+			if err := migrator.DropIndex(&Pattern{}, "idx_patterns_client_ip_pattern"); err != nil {
+				return err
+			}
+		} else if err := mergePatterns(tx); err != nil {
+			return err
+		}
+		if !migrator.HasColumn(&Pattern{}, "Hash") {
+			if err := migrator.AddColumn(&Pattern{}, "Hash"); err != nil {
+				return err
+			}
+		}
+		var patterns []Pattern
+		return tx.Unscoped().Select("id", "pattern").FindInBatches(&patterns, 1000, func(_ *gorm.DB, _ int) error {
+			for _, p := range patterns {
+				if err := tx.Exec("UPDATE patterns SET hash = ? WHERE id = ?", patternHash(p.Pattern), p.ID).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+}
+
+// mergePatterns merges the patterns of a host with the same text into the oldest one
+func mergePatterns(tx *gorm.DB) error {
+	if err := tx.Exec(`UPDATE patterns SET
+		count = (SELECT SUM(p.count) FROM patterns p WHERE p.client_ip = patterns.client_ip AND p.pattern = patterns.pattern),
+		first_seen = (SELECT MIN(p.first_seen) FROM patterns p WHERE p.client_ip = patterns.client_ip AND p.pattern = patterns.pattern),
+		last_seen = (SELECT MAX(p.last_seen) FROM patterns p WHERE p.client_ip = patterns.client_ip AND p.pattern = patterns.pattern)
+		WHERE id IN (SELECT MIN(id) FROM patterns GROUP BY client_ip, pattern HAVING COUNT(*) > 1)`).Error; err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM patterns WHERE id NOT IN (SELECT MIN(id) FROM patterns GROUP BY client_ip, pattern)").Error
+}
+
+// GetNewPatterns returns patterns first seen after since
+func (s *Store) GetNewPatterns(since time.Time) ([]Pattern, error) {
+	var patterns []Pattern
+	result := s.DB.Where("first_seen > ?", since).Order("count desc").Find(&patterns)
+	return patterns, result.Error
+}
+
+// GetErrorCounts returns the number of error-level messages per host received after since
+func (s *Store) GetErrorCounts(since time.Time) (map[string]int64, error) {
+	maxSeverity := 2
+	rows, err := s.Backend.Aggregate(AggregateQuery{Since: since, MaxSeverity: &maxSeverity, ByHost: true})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		counts[row.ClientIP] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestSaveLogPattern counts concurrent messages from one host in a single row per pattern
+func TestSaveLogPattern(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := fmt.Sprintf("link down on port %d", i)
+			if i%4 == 0 {
+				content = fmt.Sprintf("DHCPACK to 10.0.0.%d", i)
+			}
+			if err := store.SaveLogPattern("10.0.0.1", content, start.Add(time.Duration(i)*time.Second)); err != nil {
+				t.Errorf("SaveLogPattern returned an error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := store.SaveLogPattern("10.0.0.2", "link down on port 1", start); err != nil {
+		t.Fatalf("SaveLogPattern returned an error: %v", err)
+	}
+	// Patterns longer than an index entry may hold are told apart by their digest
+	long := strings.Repeat("certificate chain entry ", 1000)
+	for _, content := range []string{long + "a", long + "b", long + "a"} {
+		if err := store.SaveLogPattern("10.0.0.2", content, start); err != nil {
+			t.Fatalf("SaveLogPattern returned an error for a long message: %v", err)
+		}
+	}
+
+	patterns, err := store.GetNewPatterns(start.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("GetNewPatterns returned an error: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, p := range patterns {
+		counts[p.ClientIP+" "+p.Pattern] = p.Count
+	}
+	want := map[string]int{
+		"10.0.0.1 link down on port <num>": 30,
+		"10.0.0.1 DHCPACK to <ip>":         10,
+		"10.0.0.2 link down on port <num>": 1,
+		"10.0.0.2 " + long + "a":           2,
+		"10.0.0.2 " + long + "b":           1,
+	}
+	if len(patterns) != len(want) {
+		t.Errorf("Expected %d patterns, got %d: %v", len(want), len(patterns), counts)
+	}
+	for key, count := range want {
+		if counts[key] != count {
+			t.Errorf("Expected %s counted %d times, got %d", key, count, counts[key])
+		}
+	}
+}
+
+// TestMigrateMergesPatterns merges the duplicate patterns of earlier versions before the unique index is built
+func TestMigrateMergesPatterns(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+
+	// The schema as created by earlier versions
+	type legacyPattern struct {
+		gorm.Model
+		ClientIP  string `gorm:"index"`
+		Pattern   string `gorm:"index"`
+		Example   string
+		Count     int
+		FirstSeen time.Time `gorm:"index"`
+		LastSeen  time.Time
+	}
+	if err := store.DB.Table("patterns").AutoMigrate(&legacyPattern{}); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	legacy := []legacyPattern{
+		{ClientIP: "10.0.0.1", Pattern: "link down", Count: 3, FirstSeen: first.Add(time.Minute), LastSeen: first.Add(time.Hour)},
+		{ClientIP: "10.0.0.1", Pattern: "link down", Count: 2, FirstSeen: first, LastSeen: first.Add(2 * time.Hour)},
+		{ClientIP: "10.0.0.2", Pattern: "link down", Count: 1, FirstSeen: first, LastSeen: first},
+	}
+	if err := store.DB.Table("patterns").Create(&legacy).Error; err != nil {
+		t.Fatalf("Failed to insert legacy patterns: %v", err)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate returned an error: %v", err)
+	}
+
+	var patterns []Pattern
+	if err := store.DB.Order("id").Find(&patterns).Error; err != nil {
+		t.Fatalf("Failed to read patterns: %v", err)
+	}
+	if len(patterns) != 2 {
+		t.Fatalf("Expected the duplicates merged into 2 patterns, got %d", len(patterns))
+	}
+	if p := patterns[0]; p.Count != 5 || !p.FirstSeen.Equal(first) || !p.LastSeen.Equal(first.Add(2*time.Hour)) {
+		t.Errorf("Expected the merged pattern counted 5 times from %v to %v, got %d from %v to %v",
+			first, first.Add(2*time.Hour), p.Count, p.FirstSeen, p.LastSeen)
+	}
+	if err := store.SaveLogPattern("10.0.0.1", "link down", first.Add(3*time.Hour)); err != nil {
+		t.Fatalf("SaveLogPattern returned an error: %v", err)
+	}
+	var merged Pattern
+	if err := store.DB.First(&merged, patterns[0].ID).Error; err != nil || merged.Count != 6 {
+		t.Errorf("Expected the merged pattern counted 6 times, got %d, %v", merged.Count, err)
+	}
+}
+
+// TestMigrateHashesPatterns replaces the unique index on pattern text of earlier versions with one on the digest
+func TestMigrateHashesPatterns(t *testing.T) {
+	t.Parallel()
+	store := openTestStore(t)
+
+	type indexedPattern struct {
+		gorm.Model
+		ClientIP  string `gorm:"uniqueIndex:idx_patterns_client_ip_pattern"`
+		Pattern   string `gorm:"uniqueIndex:idx_patterns_client_ip_pattern"`
+		Example   string
+		Count     int
+		FirstSeen time.Time `gorm:"index"`
+		LastSeen  time.Time
+	}
+	if err := store.DB.Table("patterns").AutoMigrate(&indexedPattern{}); err != nil {
+		t.Fatalf("Failed to create the earlier schema: %v", err)
+	}
+	seen := time.Now()
+	if err := store.DB.Table("patterns").Create(&indexedPattern{ClientIP: "10.0.0.1", Pattern: "link down", Count: 4, FirstSeen: seen, LastSeen: seen}).Error; err != nil {
+		t.Fatalf("Failed to insert pattern: %v", err)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate returned an error: %v", err)
+	}
+	if store.DB.Migrator().HasIndex(&Pattern{}, "idx_patterns_client_ip_pattern") {
+		t.Error("Expected the index on pattern text dropped")
+	}
+	if err := store.SaveLogPattern("10.0.0.1", "link down", seen); err != nil {
+		t.Fatalf("SaveLogPattern returned an error: %v", err)
+	}
+	var patterns []Pattern
+	if err := store.DB.Find(&patterns).Error; err != nil || len(patterns) != 1 || patterns[0].Count != 5 {
+		t.Errorf("Expected the pattern counted 5 times, got %+v, %v", patterns, err)
+	}
+}
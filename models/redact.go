@@ -0,0 +1,150 @@
+package models
+
+import (
+	"regexp"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Redaction replaces the secrets a pattern finds. When the pattern has a group
+// named "secret" only that group is replaced, so that "password=hunter2" keeps its key.
+type Redaction struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string // Default "[REDACTED]"
+}
+
+// BuiltinRedactions are the patterns rules can refer to by name
+var BuiltinRedactions = map[string]string{
+	"password":        `(?i)\b(?:pass(?:word|wd|phrase)?|pwd)\s*[=:]\s*(?P<secret>"[^"]*"|'[^']*'|[^\s,;&]+)`,
+	"psk":             `(?i)\b(?:wpa_passphrase|wpa_psk|sae_password|psk)\s*[=:]\s*(?P<secret>"[^"]*"|'[^']*'|[^\s,;&]+)`,
+	"token":           `(?i)\b(?:[a-z0-9]+[_-])?(?:token|secret|api[_-]?key|access[_-]?key)\s*[=:]\s*(?P<secret>"[^"]*"|'[^']*'|[^\s,;&]+)`,
+	"bearer":          `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]+=*)`,
+	"jwt":             `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	"url_credentials": `\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:(?P<secret>[^@\s/]+)@`,
+	"private_key":     `-----BEGIN [A-Z ]*PRIVATE KEY-----(?P<secret>.*)`,
+	"aws_key":         `\bAKIA[0-9A-Z]{16}\b`,
+	"email":           `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	"mac":             macPattern.String(),
+}
+
+// DefaultRedactions are the built-in rules applied at ingest unless configured otherwise
+var DefaultRedactions = []string{"password", "psk", "token", "bearer", "jwt", "url_credentials", "private_key", "aws_key"}
+
+// Redactor applies redaction rules in order and counts their replacements
+type Redactor struct {
+	rules []Redaction
+
+	mu     sync.Mutex
+	counts map[string]int64 // Replacements per rule since the redactor was created
+}
+
+// NewRedactor returns a redactor of the given rules, or nil when there are none
+func NewRedactor(rules []Redaction) *Redactor {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &Redactor{rules: rules, counts: make(map[string]int64)}
+}
+
+// Redact returns content with the secrets replaced, and the number of replacements per rule
+func (r *Redactor) Redact(content string) (string, map[string]int) {
+	if r == nil {
+		return content, nil
+	}
+
+	var replaced map[string]int
+	for _, rule := range r.rules {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		secret := rule.Pattern.SubexpIndex("secret")
+		content = rule.Pattern.ReplaceAllStringFunc(content, func(match string) string {
+			if replaced == nil {
+				replaced = make(map[string]int)
+			}
+			replaced[rule.Name]++
+			if secret < 0 {
+				return replacement
+			}
+			// Replace only the secret group of this match
+			m := rule.Pattern.FindStringSubmatchIndex(match)
+			if m == nil || m[2*secret] < 0 {
+				return replacement
+			}
+			return match[:m[2*secret]] + replacement + match[m[2*secret+1]:]
+		})
+	}
+
+	if len(replaced) > 0 {
+		r.mu.Lock()
+		for name, count := range replaced {
+			r.counts[name] += int64(count)
+		}
+		r.mu.Unlock()
+	}
+	return content, replaced
+}
+
+// Counts returns the replacements per rule since the redactor was created
+func (r *Redactor) Counts() map[string]int64 {
+	counts := make(map[string]int64)
+	if r == nil {
+		return counts
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, count := range r.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Rules returns the names of the rules in order
+func (r *Redactor) Rules() []string {
+	if r == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+// RedactionCount is the number of secrets a rule replaced at ingest
+type RedactionCount struct {
+	Rule  string `gorm:"primarykey"`
+	Count int64
+}
+
+// countRedactions adds the replacements of one log to the stored counts
+func (s *Store) countRedactions(replaced map[string]int) error {
+	for rule, count := range replaced {
+		result := s.DB.Model(&RedactionCount{}).Where("rule = ?", rule).UpdateColumn("count", gorm.Expr("count + ?", count))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := s.DB.Create(&RedactionCount{Rule: rule, Count: int64(count)}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetRedactionCounts returns the number of secrets each rule replaced at ingest
+func (s *Store) GetRedactionCounts() (map[string]int64, error) {
+	var found []RedactionCount
+	if err := s.DB.Find(&found).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(found))
+	for _, count := range found {
+		counts[count.Rule] = count.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDedupWindow is used unless the configuration sets another window
+const DefaultDedupWindow = time.Minute
+
+// repeatCache remembers the latest log of each host, so that a repeat of it
+// updates the stored row instead of adding one
+type repeatCache struct {
+	mu      sync.Mutex
+	entries map[uint]Log
+}
+
+// repeats reports whether two messages of one host are the same
+func repeats(previous, l Log) bool {
+	return previous.Tag == l.Tag && previous.Priority == l.Priority && previous.Content == l.Content
+}
+
+// saveRepeat counts the log on the host's latest row when it repeats that row's
+// message within the dedup window. It returns the updated row and whether it did.
+func (s *Store) saveRepeat(l Log) (Log, bool, error) {
+	if s.DedupWindow <= 0 {
+		return l, false, nil
+	}
+
+	s.repeats.mu.Lock()
+	defer s.repeats.mu.Unlock()
+
+	previous, ok := s.repeats.entries[l.HostID]
+	if !ok || !repeats(previous, l) || l.ReceivedAt.Sub(previous.ReceivedAt) >= s.DedupWindow {
+		return l, false, nil
+	}
+
+	result := s.DB.Model(&Log{}).Where("id = ?", previous.ID).Updates(map[string]interface{}{
+		"repeats":          gorm.Expr("repeats + 1"),
+		"last_received_at": l.ReceivedAt,
+	})
+	if result.Error != nil {
+		return l, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// The row was deleted in the meantime
+		delete(s.repeats.entries, l.HostID)
+		return l, false, nil
+	}
+
+	previous.Repeats++
+	previous.LastReceivedAt = l.ReceivedAt
+	s.repeats.entries[l.HostID] = previous
+	return previous, true, nil
+}
+
+// rememberLog makes a stored log the one later logs of its host may repeat
+func (s *Store) rememberLog(l Log) {
+	if s.DedupWindow <= 0 {
+		return
+	}
+	s.repeats.mu.Lock()
+	defer s.repeats.mu.Unlock()
+	if s.repeats.entries == nil {
+		s.repeats.entries = make(map[uint]Log)
+	}
+	s.repeats.entries[l.HostID] = l
+}
+
+// LastReceived returns when the message was last received
+func (l Log) LastReceived() time.Time {
+	if l.LastReceivedAt.After(l.ReceivedAt) {
+		return l.LastReceivedAt
+	}
+	return l.ReceivedAt
+}
+
+// GetRepeats returns how often each of the host's logs since the given time was repeated
+func (s *Store) GetRepeats(host string, since time.Time, clock Clock) ([]int, error) {
+	column, err := s.timeColumn(host, clock)
+	if err != nil {
+		return nil, err
+	}
+
+	var repeats []int
+	err = s.DB.Model(&Log{}).Where("client_ip = ? AND "+column+" > ?", host, since).Pluck("repeats", &repeats).Error
+	return repeats, err
+}
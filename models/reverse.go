@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReverseName caches the reverse DNS name of an address; an empty Name records a failed lookup
+type ReverseName struct {
+	gorm.Model
+	ClientIP  string `gorm:"uniqueIndex"`
+	Name      string
+	ExpiresAt time.Time // When the address is looked up again
+}
+
+// SaveReverseName records the outcome of a reverse lookup
+func (s *Store) SaveReverseName(clientIP, name string, expiresAt time.Time) error {
+	var reverse ReverseName
+	if err := s.DB.Where(ReverseName{ClientIP: clientIP}).FirstOrInit(&reverse).Error; err != nil {
+		return err
+	}
+	reverse.Name = name
+	reverse.ExpiresAt = expiresAt
+	return s.DB.Save(&reverse).Error
+}
+
+// GetReverseNames returns the cached lookups of the given addresses, including expired ones
+func (s *Store) GetReverseNames(clientIPs []string) (map[string]ReverseName, error) {
+	names := make(map[string]ReverseName)
+	if len(clientIPs) == 0 {
+		return names, nil
+	}
+
+	var found []ReverseName
+	if err := s.DB.Where("client_ip IN ?", clientIPs).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, reverse := range found {
+		names[reverse.ClientIP] = reverse
+	}
+	return names, nil
+}
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Storage is a database backend for logs. Both backends share the gorm models;
+// they differ in how they are opened, how time buckets are computed, how old
+// rows are pruned and how the database is checked.
+type Storage interface {
+	// DB returns the handle shared with the other models
+	DB() *gorm.DB
+	InsertBatch(logs []Log) error
+	QueryLogs(query LogQuery) ([]Log, int64, error)
+	Aggregate(query AggregateQuery) ([]AggregateRow, error)
+	// Bucket returns the SQL expression for the start of the time bucket of received_at in Unix seconds
+	Bucket(interval time.Duration) string
+	Prune(before time.Time) (int64, error)
+	// CheckIntegrity returns the problems the database finds in its own files
+	CheckIntegrity() ([]string, error)
+}
+
+// LogQuery selects a page of logs, most recent first. Before and After page through
+// the logs by position, so pages stay stable while new logs arrive.
+type LogQuery struct {
+	Hosts   []string
+	HostIDs []uint       // Inventory hosts; combined with Hosts, a log matches either. Empty but not nil matches none.
+	Fields  []FieldMatch // Extracted fields the logs must all have
+	Limit   int
+	Before  *Cursor // Only logs older than this position
+	After   *Cursor // Only the logs directly newer than this position
+	Count   bool    // Count all logs matching Hosts; QueryLogs returns -1 otherwise
+}
+
+// AggregateQuery counts logs received since Since, optionally per host and per time bucket
+type AggregateQuery struct {
+	Since       time.Time
+	Hosts       []string
+	MaxSeverity *int          // Only count this syslog severity or anything more severe
+	Interval    time.Duration // Bucket width; zero counts the whole range as one bucket
+	ByHost      bool
+}
+
+// AggregateRow is one count returned by Aggregate
+type AggregateRow struct {
+	ClientIP string
+	Bucket   time.Time
+	Count    int64
+}
+
+// IsPostgresDSN reports whether dsn selects the PostgreSQL backend
+func IsPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") ||
+		strings.Contains(dsn, "host=") || strings.Contains(dsn, "dbname=")
+}
+
+// OpenStorage opens the backend selected by dsn: a PostgreSQL URL or key/value
+// connection string selects PostgreSQL, anything else is a SQLite file path.
+func OpenStorage(dsn string, readOnly bool) (Storage, error) {
+	if IsPostgresDSN(dsn) {
+		return openPostgres(dsn, readOnly)
+	}
+	return openSQLite(dsn, readOnly)
+}
+
+// gormStorage implements the dialect-independent parts of Storage
+type gormStorage struct {
+	db *gorm.DB
+	// bucket returns the SQL expression for the start of a time bucket in Unix seconds
+	bucket func(seconds int64) string
+}
+
+func (s *gormStorage) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *gormStorage) Bucket(interval time.Duration) string {
+	return s.bucket(int64(interval.Seconds()))
+}
+
+func (s *gormStorage) InsertBatch(logs []Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(logs, 100).Error
+}
+
+// QueryLogs reads a page of logs. Times are compared in the local zone they are
+// stored in, because SQLite compares them as text.
+func (s *gormStorage) QueryLogs(query LogQuery) ([]Log, int64, error) {
+	filter := func() *gorm.DB {
+		q := s.db.Model(&Log{})
+		switch {
+		case len(query.Hosts) > 0 && query.HostIDs != nil:
+			q = q.Where("client_ip IN ? OR host_id IN ?", query.Hosts, query.HostIDs)
+		case len(query.Hosts) > 0:
+			q = q.Where("client_ip IN ?", query.Hosts)
+		case query.HostIDs != nil:
+			q = q.Where("host_id IN ?", query.HostIDs)
+		}
+		for _, field := range query.Fields {
+			q = q.Where("id IN (SELECT log_id FROM fields WHERE name = ? AND value = ?)", field.Name, field.Value)
+		}
+		return q
+	}
+
+	q := filter()
+	switch {
+	case query.Before != nil:
+		before := query.Before.ReceivedAt.Local()
+		q = q.Where("received_at <= ? AND (received_at < ? OR id < ?)", before, before, query.Before.ID).
+			Order("received_at desc, id desc")
+	case query.After != nil:
+		after := query.After.ReceivedAt.Local()
+		q = q.Where("received_at >= ? AND (received_at > ? OR id > ?)", after, after, query.After.ID).
+			Order("received_at, id")
+	default:
+		q = q.Order("received_at desc, id desc")
+	}
+
+	var logs []Log
+	if err := q.Limit(query.Limit).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	if query.After != nil {
+		slices.Reverse(logs)
+	}
+
+	count := int64(-1)
+	if query.Count {
+		if err := filter().Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return logs, count, nil
+}
+
+func (s *gormStorage) Aggregate(query AggregateQuery) ([]AggregateRow, error) {
+	selects := []string{"count(*) AS count"}
+	var groups []string
+	if query.ByHost {
+		selects = append(selects, "client_ip")
+		groups = append(groups, "client_ip")
+	}
+	if query.Interval > 0 {
+		selects = append(selects, s.Bucket(query.Interval)+" AS bucket")
+		groups = append(groups, "bucket")
+	}
+
+	q := s.db.Model(&Log{}).Select(strings.Join(selects, ", ")).Where("received_at > ?", query.Since)
+	if len(query.Hosts) > 0 {
+		q = q.Where("client_ip IN ?", query.Hosts)
+	}
+	if query.MaxSeverity != nil {
+		q = q.Where("priority % 8 <= ?", *query.MaxSeverity)
+	}
+	if len(groups) > 0 {
+		q = q.Group(strings.Join(groups, ", ")).Order(strings.Join(groups, ", "))
+	}
+
+	var rows []struct {
+		ClientIP string
+		Bucket   int64
+		Count    int64
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	aggregate := make([]AggregateRow, 0, len(rows))
+	for _, row := range rows {
+		r := AggregateRow{ClientIP: row.ClientIP, Count: row.Count}
+		if query.Interval > 0 {
+			r.Bucket = time.Unix(row.Bucket, 0)
+		}
+		aggregate = append(aggregate, r)
+	}
+	return aggregate, nil
+}
+
+// Prune deletes the logs received before a time with their fields, the firewall
+// and login events received before it, which may be newer than their log when it
+// repeated, and the message patterns last seen before it
+func (s *gormStorage) Prune(before time.Time) (int64, error) {
+	if err := s.db.Exec("DELETE FROM fields WHERE log_id IN (SELECT id FROM logs WHERE received_at < ?)", before).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Exec("DELETE FROM firewall_events WHERE received_at < ?", before).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Exec("DELETE FROM auth_events WHERE received_at < ?", before).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Exec("DELETE FROM patterns WHERE last_seen < ?", before).Error; err != nil {
+		return 0, err
+	}
+	result := s.db.Unscoped().Where("received_at < ?", before).Delete(&Log{})
+	return result.RowsAffected, result.Error
+}
+
+// sqliteStorage keeps logs in a single SQLite file
+type sqliteStorage struct {
+	gormStorage
+}
+
+func openSQLite(path string, readOnly bool) (*sqliteStorage, error) {
+	db, err := gorm.Open(sqlite.Open(DSN(path, readOnly)), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqliteStorage{gormStorage{
+		db: db,
+		bucket: func(seconds int64) string {
+			return fmt.Sprintf("CAST(strftime('%%s', received_at) AS INTEGER) / %d * %d", seconds, seconds)
+		},
+	}}, nil
+}
+
+// Prune deletes in small batches so that the single SQLite writer lock is released between them
+func (s *sqliteStorage) Prune(before time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		if err := s.db.Raw("SELECT id FROM logs WHERE received_at < ? LIMIT 5000", before).Scan(&ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		if err := s.db.Exec("DELETE FROM fields WHERE log_id IN ?", ids).Error; err != nil {
+			return total, err
+		}
+		result := s.db.Exec("DELETE FROM logs WHERE id IN ?", ids)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < 5000 {
+			break
+		}
+	}
+
+	// Events and patterns are kept by their own time, as in gormStorage.Prune
+	for table, column := range map[string]string{"firewall_events": "received_at", "auth_events": "received_at", "patterns": "last_seen"} {
+		for {
+			result := s.db.Exec("DELETE FROM "+table+" WHERE id IN (SELECT id FROM "+table+" WHERE "+column+" < ? LIMIT 5000)", before)
+			if result.Error != nil {
+				return total, result.Error
+			}
+			if result.RowsAffected < 5000 {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// CheckIntegrity runs PRAGMA integrity_check
+func (s *sqliteStorage) CheckIntegrity() ([]string, error) {
+	var problems []string
+	if err := s.db.Raw("PRAGMA integrity_check").Scan(&problems).Error; err != nil {
+		return nil, err
+	}
+	if len(problems) == 1 && problems[0] == "ok" {
+		return nil, nil
+	}
+	return problems, nil
+}
+
+// DSN builds the SQLite connection string for path
+func DSN(path string, readOnly bool) string {
+	dsn := path + "?_journal_mode=WAL&_busy_timeout=5000"
+	if readOnly {
+		dsn += "&_query_only=true"
+	}
+	return dsn
+}
+
+// postgresStorage keeps logs in a PostgreSQL database
+type postgresStorage struct {
+	gormStorage
+}
+
+func openPostgres(dsn string, readOnly bool) (*postgresStorage, error) {
+	if readOnly {
+		dsn = postgresReadOnlyDSN(dsn)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresStorage{gormStorage{
+		db: db,
+		bucket: func(seconds int64) string {
+			return fmt.Sprintf("CAST(FLOOR(EXTRACT(EPOCH FROM received_at) / %d) * %d AS BIGINT)", seconds, seconds)
+		},
+	}}, nil
+}
+
+// CheckIntegrity only checks that the server answers, as PostgreSQL has no built-in
+// check of its files
+func (s *postgresStorage) CheckIntegrity() ([]string, error) {
+	return nil, s.db.Exec("SELECT 1").Error
+}
+
+// postgresReadOnlyDSN makes every transaction on the connection read-only
+func postgresReadOnlyDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&default_transaction_read_only=on"
+		}
+		return dsn + "?default_transaction_read_only=on"
+	}
+	return dsn + " default_transaction_read_only=on"
+}
@@ -0,0 +1,321 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestStore opens an empty store that is closed after the test: a temporary
+// SQLite file, or a schema of its own in the PostgreSQL database named by
+// HOSTLOG_TEST_POSTGRES_DSN
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "logs.db")
+	if postgres := os.Getenv("HOSTLOG_TEST_POSTGRES_DSN"); postgres != "" {
+		dsn = testSchema(t, postgres)
+	}
+	store, err := OpenStore(dsn, false)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testSchema creates a schema that is dropped after the test and returns the DSN
+// that selects it
+func testSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "hostlog_test_" + hex.EncodeToString(suffix)
+
+	admin, err := OpenStorage(dsn, false)
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL storage: %v", err)
+	}
+	db := admin.DB()
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("Failed to create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// TestSQLiteStorage runs the storage suite against a temporary SQLite file
+func TestSQLiteStorage(t *testing.T) {
+	t.Parallel()
+
+	storage, err := OpenStorage(filepath.Join(t.TempDir(), "logs.db"), false)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite storage: %v", err)
+	}
+	testStorage(t, storage)
+}
+
+// TestPostgresStorage runs the storage suite against the PostgreSQL database named by HOSTLOG_TEST_POSTGRES_DSN
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("HOSTLOG_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("HOSTLOG_TEST_POSTGRES_DSN not set")
+	}
+
+	storage, err := OpenStorage(testSchema(t, dsn), false)
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL storage: %v", err)
+	}
+	testStorage(t, storage)
+}
+
+func testStorage(t *testing.T, storage Storage) {
+	t.Helper()
+	db := storage.DB()
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	if err := db.AutoMigrate(&Log{}, &Field{}, &FirewallEvent{}, &AuthEvent{}, &Pattern{}); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	// Received times are spread over the last three hours, one hour apart
+	now := time.Now().Truncate(time.Hour)
+	var logs []Log
+	for i, host := range []string{"192.168.1.1", "192.168.1.1", "192.168.1.2", "192.168.1.2", "192.168.1.3"} {
+		for hour := 0; hour < 3; hour++ {
+			l := Log{ClientIP: host, Content: "test log", Priority: i % 8, ReceivedAt: now.Add(-time.Duration(hour)*time.Hour + time.Minute)}
+			logs = append(logs, l)
+		}
+	}
+
+	if err := storage.InsertBatch(logs); err != nil {
+		t.Fatalf("InsertBatch returned an error: %v", err)
+	}
+	for _, l := range logs {
+		if l.ID == 0 {
+			t.Fatal("Expected InsertBatch to assign IDs")
+		}
+	}
+
+	// Every log of the current hour carries a field; host 192.168.1.2 logs another one
+	var fields []Field
+	for i, l := range logs {
+		if i%3 == 0 {
+			fields = append(fields, Field{LogID: l.ID, Name: "action", Value: "drop"})
+			if l.ClientIP == "192.168.1.2" {
+				fields = append(fields, Field{LogID: l.ID, Name: "proto", Value: "udp"})
+			}
+		}
+	}
+	if err := db.Create(&fields).Error; err != nil {
+		t.Fatalf("Failed to create fields: %v", err)
+	}
+
+	t.Run("QueryLogs", func(t *testing.T) {
+		hosts := []string{"192.168.1.1", "192.168.1.3"}
+		page, count, err := storage.QueryLogs(LogQuery{Hosts: hosts, Limit: 4, Count: true})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if count != 9 || len(page) != 4 {
+			t.Fatalf("Expected 4 of 9 logs, got %d of %d", len(page), count)
+		}
+		for i := 1; i < len(page); i++ {
+			if page[i].ReceivedAt.After(page[i-1].ReceivedAt) {
+				t.Errorf("Expected logs ordered most recent first")
+			}
+		}
+
+		// Host 192.168.1.1 logs twice per hour, so the cursor has to break ties by ID
+		rest, count, err := storage.QueryLogs(LogQuery{Hosts: hosts, Limit: 100, Before: CursorOf(page[3])})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if len(rest) != 5 || count != -1 {
+			t.Fatalf("Expected 5 remaining logs and no count, got %d and %d", len(rest), count)
+		}
+		seen := make(map[uint]bool)
+		for _, l := range append(page, rest...) {
+			if seen[l.ID] {
+				t.Errorf("Log %d returned on both pages", l.ID)
+			}
+			seen[l.ID] = true
+		}
+
+		newer, _, err := storage.QueryLogs(LogQuery{Hosts: hosts, Limit: 4, After: CursorOf(rest[0])})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if len(newer) != 4 {
+			t.Fatalf("Expected 4 newer logs, got %d", len(newer))
+		}
+		for i := range newer {
+			if newer[i].ID != page[i].ID {
+				t.Errorf("Expected paging back to return the first page, got log %d at %d instead of %d", newer[i].ID, i, page[i].ID)
+			}
+		}
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		maxSeverity := 2
+		rows, err := storage.Aggregate(AggregateQuery{Since: now.Add(-24 * time.Hour), MaxSeverity: &maxSeverity, ByHost: true})
+		if err != nil {
+			t.Fatalf("Aggregate returned an error: %v", err)
+		}
+		counts := make(map[string]int64)
+		for _, row := range rows {
+			counts[row.ClientIP] = row.Count
+		}
+		// Severities 0 and 1 belong to host 1, severity 2 to host 2
+		if counts["192.168.1.1"] != 6 || counts["192.168.1.2"] != 3 || counts["192.168.1.3"] != 0 {
+			t.Errorf("Unexpected error counts per host: %v", counts)
+		}
+
+		rows, err = storage.Aggregate(AggregateQuery{Since: now.Add(-24 * time.Hour), Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Aggregate returned an error: %v", err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("Expected 3 hourly buckets, got %d: %v", len(rows), rows)
+		}
+		for i, row := range rows {
+			expected := now.Add(-time.Duration(2-i) * time.Hour)
+			if !row.Bucket.Equal(expected) || row.Count != 5 {
+				t.Errorf("Expected bucket %s with 5 logs, got %s with %d", expected, row.Bucket, row.Count)
+			}
+		}
+	})
+
+	t.Run("QueryLogsByField", func(t *testing.T) {
+		drops, count, err := storage.QueryLogs(LogQuery{Fields: []FieldMatch{{Name: "action", Value: "drop"}}, Limit: 100, Count: true})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if count != 5 || len(drops) != 5 {
+			t.Errorf("Expected the 5 logs with action=drop, got %d of %d", len(drops), count)
+		}
+
+		both, _, err := storage.QueryLogs(LogQuery{Fields: []FieldMatch{{Name: "action", Value: "drop"}, {Name: "proto", Value: "udp"}}, Limit: 100})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if len(both) != 2 || both[0].ClientIP != "192.168.1.2" {
+			t.Errorf("Expected the 2 logs matching both fields, got %d", len(both))
+		}
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		// Events go by their own time: one of a kept log received before the cutoff,
+		// and one of a pruned log that repeated after it
+		oldLog, keptLog := logs[1], logs[0]
+		firewall := []FirewallEvent{
+			{LogID: keptLog.ID, ReceivedAt: now.Add(-2 * time.Hour)},
+			{LogID: oldLog.ID, ReceivedAt: now},
+		}
+		auth := []AuthEvent{
+			{LogID: keptLog.ID, ReceivedAt: now.Add(-2 * time.Hour)},
+			{LogID: oldLog.ID, ReceivedAt: now},
+		}
+		if err := db.Create(&firewall).Error; err != nil {
+			t.Fatalf("Failed to create firewall events: %v", err)
+		}
+		if err := db.Create(&auth).Error; err != nil {
+			t.Fatalf("Failed to create auth events: %v", err)
+		}
+		patterns := []Pattern{
+			{ClientIP: "192.168.1.1", Hash: "stale", Pattern: "stale", LastSeen: now.Add(-2 * time.Hour)},
+			{ClientIP: "192.168.1.1", Hash: "seen", Pattern: "seen", LastSeen: now},
+		}
+		if err := db.Create(&patterns).Error; err != nil {
+			t.Fatalf("Failed to create patterns: %v", err)
+		}
+
+		pruned, err := storage.Prune(now.Add(-30 * time.Minute))
+		if err != nil {
+			t.Fatalf("Prune returned an error: %v", err)
+		}
+		if pruned != 10 {
+			t.Errorf("Expected 10 pruned logs, got %d", pruned)
+		}
+
+		_, count, err := storage.QueryLogs(LogQuery{Limit: 100, Count: true})
+		if err != nil {
+			t.Fatalf("QueryLogs returned an error: %v", err)
+		}
+		if count != 5 {
+			t.Errorf("Expected 5 remaining logs, got %d", count)
+		}
+
+		var remaining int64
+		if err := db.Model(&Field{}).Count(&remaining).Error; err != nil {
+			t.Fatalf("Failed to count fields: %v", err)
+		}
+		if remaining != 7 {
+			t.Errorf("Expected only the fields of the remaining logs, got %d", remaining)
+		}
+
+		for _, model := range []interface{}{&FirewallEvent{}, &AuthEvent{}} {
+			var events []FirewallEvent
+			if err := db.Model(model).Select("id, log_id, received_at").Find(&events).Error; err != nil {
+				t.Fatalf("Failed to read events: %v", err)
+			}
+			if len(events) != 1 || events[0].LogID != oldLog.ID {
+				t.Errorf("Expected only the event received after the cutoff in %T, got %+v", model, events)
+			}
+		}
+
+		var kept []string
+		if err := db.Model(&Pattern{}).Pluck("pattern", &kept).Error; err != nil || len(kept) != 1 || kept[0] != "seen" {
+			t.Errorf("Expected only the pattern seen after the cutoff, got %v, %v", kept, err)
+		}
+	})
+}
+
+// TestIndependentStores verifies that stores opened in one process do not share data
+func TestIndependentStores(t *testing.T) {
+	t.Parallel()
+
+	var stores []*Store
+	for i := 0; i < 2; i++ {
+		store := openTestStore(t)
+		if err := store.Migrate(); err != nil {
+			t.Fatalf("Failed to migrate schema: %v", err)
+		}
+		stores = append(stores, store)
+	}
+
+	if _, err := stores[0].SaveLog(map[string]interface{}{"client": "192.168.1.1:514", "content": "only in a"}); err != nil {
+		t.Fatalf("SaveLog returned an error: %v", err)
+	}
+
+	for i, expected := range []int{1, 0} {
+		hosts, err := stores[i].GetAllHosts()
+		if err != nil {
+			t.Fatalf("GetAllHosts returned an error: %v", err)
+		}
+		if len(hosts) != expected {
+			t.Errorf("Expected %d hosts in store %d, got %v", expected, i, hosts)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+
+	"hostlog/models"
+)
+
+// daemonEvent recognizes one kind of message of an OpenWrt daemon. The event
+// name and the fixed fields are set alongside the named groups of the pattern.
+type daemonEvent struct {
+	programs []string          // Syslog tags without the process ID
+	event    string            // Value of the event field
+	fields   map[string]string // Fixed fields, such as the login method
+	pattern  *regexp.Regexp
+}
+
+// Building blocks of the daemon patterns
+const (
+	reMAC  = `(?P<mac>(?:[0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2})`
+	reIPv4 = `(?P<ip>(?:\d{1,3}\.){3}\d{1,3})`
+	reFrom = `from <?\[?(?P<src>[0-9A-Fa-f.:]+)\]?:(?P<port>\d+)`
+)
+
+// daemonEvents are the messages the openwrt parser recognizes, first match wins
+var daemonEvents = []daemonEvent{
+	// hostapd stations
+	{
+		programs: []string{"hostapd"},
+		event:    "wifi.associate",
+		pattern:  regexp.MustCompile(`^(?P<iface>\S+): STA ` + reMAC + ` IEEE 802\.11: (?:re)?associated`),
+	},
+	{
+		programs: []string{"hostapd"},
+		event:    "wifi.associate",
+		pattern:  regexp.MustCompile(`^(?P<iface>\S+): AP-STA-CONNECTED ` + reMAC),
+	},
+	{
+		programs: []string{"hostapd"},
+		event:    "wifi.disassociate",
+		pattern:  regexp.MustCompile(`^(?P<iface>\S+): STA ` + reMAC + ` IEEE 802\.11: (?:disassociated|deauthenticated|disconnected)(?: due to (?P<reason>.+?))?\.?$`),
+	},
+	{
+		programs: []string{"hostapd"},
+		event:    "wifi.disassociate",
+		pattern:  regexp.MustCompile(`^(?P<iface>\S+): AP-STA-DISCONNECTED ` + reMAC),
+	},
+
+	// DHCP leases handed out by dnsmasq and odhcpd
+	{
+		programs: []string{"dnsmasq-dhcp", "dnsmasq"},
+		event:    "dhcp.ack",
+		pattern:  regexp.MustCompile(`^(?:\d+ )?DHCPACK\((?P<iface>[^)]+)\) ` + reIPv4 + ` ` + reMAC + `(?: (?P<hostname>\S+))?`),
+	},
+	{
+		programs: []string{"odhcpd"},
+		event:    "dhcp.ack",
+		pattern:  regexp.MustCompile(`^DHCPV4 ACK (?:IP: )?` + reIPv4 + ` (?:to|for|MAC:) ` + reMAC + `(?: \((?P<hostname>[^)]+)\))?(?: on (?P<iface>\S+))?`),
+	},
+
+	// SSH logins to dropbear, and to OpenSSH where it replaces dropbear
+	{
+		programs: []string{"dropbear"},
+		event:    "ssh.login",
+		fields:   map[string]string{"method": "password"},
+		pattern:  regexp.MustCompile(`^Password auth succeeded for '(?P<user>[^']*)' ` + reFrom),
+	},
+	{
+		programs: []string{"dropbear"},
+		event:    "ssh.login",
+		fields:   map[string]string{"method": "publickey"},
+		pattern:  regexp.MustCompile(`^Pubkey auth succeeded for '(?P<user>[^']*)' with .* ` + reFrom),
+	},
+	{
+		programs: []string{"dropbear"},
+		event:    "ssh.failure",
+		fields:   map[string]string{"method": "password"},
+		pattern:  regexp.MustCompile(`^Bad password attempt for '(?P<user>[^']*)' ` + reFrom),
+	},
+	{
+		programs: []string{"dropbear"},
+		event:    "ssh.failure",
+		fields:   map[string]string{"reason": "unknown user"},
+		pattern:  regexp.MustCompile(`^Login attempt for nonexistent user(?: '(?P<user>[^']*)')? ` + reFrom),
+	},
+	{
+		programs: []string{"sshd"},
+		event:    "ssh.login",
+		pattern:  regexp.MustCompile(`^Accepted (?P<method>\S+) for (?P<user>\S+) from (?P<src>\S+) port (?P<port>\d+)`),
+	},
+	{
+		programs: []string{"sshd"},
+		event:    "ssh.failure",
+		pattern:  regexp.MustCompile(`^Failed (?P<method>\S+) for (?:invalid user )?(?P<user>\S+) from (?P<src>\S+) port (?P<port>\d+)`),
+	},
+	{
+		programs: []string{"sshd"},
+		event:    "ssh.failure",
+		fields:   map[string]string{"reason": "unknown user"},
+		pattern:  regexp.MustCompile(`^Invalid user (?P<user>\S*) from (?P<src>\S+)(?: port (?P<port>\d+))?`),
+	},
+
+	// LuCI web interface logins
+	{
+		programs: []string{"luci"},
+		event:    "luci.login",
+		pattern:  regexp.MustCompile(`(?:^|: )accepted login on (?P<path>\S+) for (?P<user>\S+) from (?P<src>\S+)`),
+	},
+	{
+		programs: []string{"luci"},
+		event:    "luci.failure",
+		pattern:  regexp.MustCompile(`(?:^|: )failed login on (?P<path>\S+) for (?P<user>\S+) from (?P<src>\S+)`),
+	},
+
+	// Local privilege changes by BusyBox and shadow su, and by sudo; user is the
+	// account whose password was asked, by the one who asked
+	{
+		programs: []string{"su"},
+		event:    "su.login",
+		pattern:  regexp.MustCompile(`^\+ (?P<tty>\S+) (?P<by>[^:\s]+):(?P<user>\S+)$`),
+	},
+	{
+		programs: []string{"su"},
+		event:    "su.failure",
+		pattern:  regexp.MustCompile(`^- (?P<tty>\S+) (?P<by>[^:\s]+):(?P<user>\S+)$`),
+	},
+	{
+		programs: []string{"su"},
+		event:    "su.login",
+		pattern:  regexp.MustCompile(`^\(to (?P<user>\S+)\) (?P<by>\S+) on (?P<tty>\S+)`),
+	},
+	{
+		programs: []string{"su"},
+		event:    "su.failure",
+		pattern:  regexp.MustCompile(`^FAILED SU \(to (?P<user>\S+)\) (?P<by>\S+) on (?P<tty>\S+)`),
+	},
+	{
+		programs: []string{"sudo"},
+		event:    "sudo.failure",
+		pattern:  regexp.MustCompile(`^\s*(?P<user>\S+) : (?:\d+ incorrect password attempts?|user NOT in sudoers) ; TTY=(?P<tty>\S+) ; PWD=\S+ ; USER=(?P<as>\S+) ;`),
+	},
+	{
+		programs: []string{"sudo"},
+		event:    "sudo.login",
+		pattern:  regexp.MustCompile(`^\s*(?P<user>\S+) : TTY=(?P<tty>\S+) ; PWD=\S+ ; USER=(?P<as>\S+) ; COMMAND=(?P<command>.+)`),
+	},
+
+	// Interfaces and links
+	{
+		programs: []string{"netifd"},
+		event:    "interface.up",
+		pattern:  regexp.MustCompile(`^Interface '(?P<interface>[^']+)' is now up`),
+	},
+	{
+		programs: []string{"netifd"},
+		event:    "interface.down",
+		pattern:  regexp.MustCompile(`^Interface '(?P<interface>[^']+)' is now down`),
+	},
+	{
+		programs: []string{"netifd"},
+		event:    "link.up",
+		pattern:  regexp.MustCompile(`^Network device '(?P<device>[^']+)' link is up`),
+	},
+	{
+		programs: []string{"netifd"},
+		event:    "link.down",
+		pattern:  regexp.MustCompile(`^Network device '(?P<device>[^']+)' link is down`),
+	},
+	{
+		programs: []string{"kernel"},
+		event:    "link.up",
+		pattern:  regexp.MustCompile(`(?:^|\s)(?P<device>[\w.@-]+):? (?:NIC )?[Ll]ink (?:is )?[Uu]p(?: \(| - )?(?P<speed>[\w/]+)?`),
+	},
+	{
+		programs: []string{"kernel"},
+		event:    "link.down",
+		pattern:  regexp.MustCompile(`(?:^|\s)(?P<device>[\w.@-]+):? (?:NIC )?[Ll]ink (?:is )?[Dd]own`),
+	},
+	{
+		programs: []string{"kernel"},
+		event:    "link.up",
+		pattern:  regexp.MustCompile(`ADDRCONF\(NETDEV_CHANGE\): (?P<device>[\w.@-]+): link becomes ready`),
+	},
+	{
+		programs: []string{"kernel"},
+		event:    "bridge.port",
+		pattern:  regexp.MustCompile(`(?P<bridge>[\w.@-]+): port \d+\((?P<device>[^)]+)\) entered (?P<state>\w+) state`),
+	},
+
+	// procd services
+	{
+		programs: []string{"procd"},
+		event:    "service.crashloop",
+		pattern:  regexp.MustCompile(`^Instance (?P<service>[^:\s]+)::(?P<instance>\S+) s in a crash loop (?P<crashes>\d+) crashes`),
+	},
+	{
+		programs: []string{"procd"},
+		event:    "system.boot",
+		pattern:  regexp.MustCompile(`^- init complete -`),
+	},
+}
+
+// parseOpenWrt extracts the event a known OpenWrt daemon reports. Messages without
+// a tag are matched against every daemon.
+func parseOpenWrt(l models.Log) [][2]string {
+	name := program(l.Tag)
+	for _, e := range daemonEvents {
+		if name != "" && !slices.Contains(e.programs, name) {
+			continue
+		}
+		m := e.pattern.FindStringSubmatch(l.Content)
+		if m == nil {
+			continue
+		}
+
+		pairs := [][2]string{{"event", e.event}}
+		for _, field := range slices.Sorted(maps.Keys(e.fields)) {
+			pairs = append(pairs, [2]string{field, e.fields[field]})
+		}
+		for i, field := range e.pattern.SubexpNames() {
+			if field != "" && m[i] != "" {
+				pairs = append(pairs, [2]string{field, m[i]})
+			}
+		}
+		return pairs
+	}
+	return nil
+}
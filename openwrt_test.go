@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hostlog/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestOpenWrtParsers runs the openwrt parser over sample messages of each daemon in
+// testdata/openwrt/<daemon>.log and compares the fields with <daemon>.golden; run
+// with -update after changing the patterns
+func TestOpenWrtParsers(t *testing.T) {
+	t.Parallel()
+	parsers, err := NewParsers([]ParserConfig{{Type: "openwrt"}})
+	if err != nil {
+		t.Fatalf("NewParsers returned an error: %v", err)
+	}
+
+	samples, err := filepath.Glob(filepath.Join("testdata", "openwrt", "*.log"))
+	if err != nil || len(samples) == 0 {
+		t.Fatalf("Expected daemon samples, got %v", err)
+	}
+	for _, sample := range samples {
+		daemon := strings.TrimSuffix(filepath.Base(sample), ".log")
+		t.Run(daemon, func(t *testing.T) {
+			file, err := os.Open(sample)
+			if err != nil {
+				t.Fatalf("Failed to open samples: %v", err)
+			}
+			defer file.Close()
+
+			// Each sample line is "tag: content"; its fields follow it indented
+			var got strings.Builder
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				tag, content, _ := strings.Cut(scanner.Text(), ": ")
+				got.WriteString(scanner.Text() + "\n\t")
+				if pairs := fieldPairs(parsers.Parse(models.Log{Tag: tag, Content: content})); len(pairs) > 0 {
+					got.WriteString(strings.Join(pairs, " ") + "\n")
+				} else {
+					got.WriteString("-\n")
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("Failed to read samples: %v", err)
+			}
+
+			golden := strings.TrimSuffix(sample, ".log") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", golden, err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", golden, err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("Fields differ from %s:\n%s", golden, got.String())
+			}
+		})
+	}
+}
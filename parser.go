@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"hostlog/models"
+)
+
+// ParserConfig declares one stage of the parser pipeline, which extracts fields from
+// every stored message. Stages run in order on the messages their filter matches;
+// a later stage overwrites a field an earlier one extracted.
+type ParserConfig struct {
+	MessageFilter
+	Type     string            `json:"type"`     // kv, json, regex, grok, openwrt or firewall
+	Pattern  string            `json:"pattern"`  // regex: named groups become fields; grok: %{PATTERN:field} expressions
+	Patterns map[string]string `json:"patterns"` // Additional grok patterns by name
+	Prefix   string            `json:"prefix"`   // Prepended to the names of the extracted fields
+	Final    bool              `json:"final"`    // Skip the later stages on messages this stage extracted fields from
+}
+
+// defaultParsers are used when the configuration declares no parsers. Firewall
+// lines stop there, so that their fields are not extracted a second time as kv pairs.
+var defaultParsers = []ParserConfig{{Type: "json"}, {Type: "firewall", Final: true}, {Type: "kv"}, {Type: "openwrt"}}
+
+const (
+	maxFields     = 64   // Per message
+	maxFieldValue = 1024 // Longer values are truncated
+)
+
+// parseFunc extracts name/value pairs from a message
+type parseFunc func(l models.Log) [][2]string
+
+// onContent adapts a parser of message content
+func onContent(parse func(content string) [][2]string) parseFunc {
+	return func(l models.Log) [][2]string {
+		return parse(l.Content)
+	}
+}
+
+// Parser is a compiled ParserConfig
+type Parser struct {
+	ParserConfig
+	parse parseFunc
+}
+
+// Parsers is the parser pipeline
+type Parsers []*Parser
+
+// NewParsers compiles the pipeline; nil configs select the default JSON, firewall, kv and OpenWrt parsers
+func NewParsers(configs []ParserConfig) (Parsers, error) {
+	if configs == nil {
+		configs = defaultParsers
+	}
+
+	var parsers Parsers
+	for i, config := range configs {
+		parser, err := NewParser(config)
+		if err != nil {
+			return nil, fmt.Errorf("parser %d (%s): %w", i+1, config.Type, err)
+		}
+		parsers = append(parsers, parser)
+	}
+	return parsers, nil
+}
+
+// NewParser compiles one stage
+func NewParser(config ParserConfig) (*Parser, error) {
+	if err := config.Compile(); err != nil {
+		return nil, err
+	}
+
+	parser := &Parser{ParserConfig: config}
+	switch config.Type {
+	case "kv":
+		parser.parse = onContent(parseKV)
+	case "json":
+		parser.parse = onContent(parseJSON)
+	case "openwrt":
+		parser.parse = parseOpenWrt
+	case "firewall":
+		parser.parse = parseFirewall
+	case "regex", "grok":
+		pattern := config.Pattern
+		if config.Type == "grok" {
+			expanded, err := expandGrok(pattern, config.Patterns)
+			if err != nil {
+				return nil, err
+			}
+			pattern = expanded
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		parser.parse = onContent(regexParser(re))
+	default:
+		return nil, fmt.Errorf("unknown parser type %q", config.Type)
+	}
+	return parser, nil
+}
+
+// Parse runs the pipeline over a message
+func (ps Parsers) Parse(l models.Log) []models.Field {
+	var fields []models.Field
+	for _, parser := range ps {
+		if !parser.Matches(l) {
+			continue
+		}
+		pairs := parser.parse(l)
+		for _, pair := range pairs {
+			fields = setField(fields, parser.Prefix+pair[0], pair[1])
+		}
+		if parser.Final && len(pairs) > 0 {
+			break
+		}
+	}
+	return fields
+}
+
+// setField sets a field, overwriting an earlier value of the same name
+func setField(fields []models.Field, name, value string) []models.Field {
+	if len(value) > maxFieldValue {
+		value = value[:maxFieldValue]
+	}
+	for i := range fields {
+		if fields[i].Name == name {
+			fields[i].Value = value
+			return fields
+		}
+	}
+	if len(fields) >= maxFields {
+		return fields
+	}
+	return append(fields, models.Field{Name: name, Value: value})
+}
+
+// kvPair matches key=value, with the value optionally in double or single quotes
+var kvPair = regexp.MustCompile(`(?:^|\s)([A-Za-z_][A-Za-z0-9_.\-]*)=("(?:[^"\\]|\\.)*"|'[^']*'|\S*)`)
+
+// parseKV extracts key=value pairs such as those of iptables and many daemons;
+// empty values are skipped
+func parseKV(content string) [][2]string {
+	var pairs [][2]string
+	for _, m := range kvPair.FindAllStringSubmatch(content, -1) {
+		value := m[2]
+		switch value[:min(len(value), 1)] {
+		case `"`:
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, `"`)
+			}
+		case "'":
+			value = strings.Trim(value, "'")
+		default:
+			value = strings.TrimRight(value, ",;")
+		}
+		if value != "" {
+			pairs = append(pairs, [2]string{m[1], value})
+		}
+	}
+	return pairs
+}
+
+// parseJSON extracts the members of a JSON object in the message, such as one
+// after a "@cee:" cookie. Nested objects are flattened with dotted names; arrays
+// are kept as JSON.
+func parseJSON(content string) [][2]string {
+	start := strings.IndexByte(content, '{')
+	if start < 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(content[start:]))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+
+	var pairs [][2]string
+	flattenJSON("", object, &pairs)
+	return pairs
+}
+
+// flattenJSON appends the members of object under prefix
+func flattenJSON(prefix string, object map[string]any, pairs *[][2]string) {
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		name := prefix + key
+		switch v := object[key].(type) {
+		case nil:
+		case map[string]any:
+			flattenJSON(name+".", v, pairs)
+		case string:
+			*pairs = append(*pairs, [2]string{name, v})
+		case json.Number, bool:
+			*pairs = append(*pairs, [2]string{name, fmt.Sprint(v)})
+		default:
+			if encoded, err := json.Marshal(v); err == nil {
+				*pairs = append(*pairs, [2]string{name, string(encoded)})
+			}
+		}
+	}
+}
+
+// regexParser extracts the non-empty named groups of the first match
+func regexParser(re *regexp.Regexp) func(content string) [][2]string {
+	return func(content string) [][2]string {
+		m := re.FindStringSubmatch(content)
+		if m == nil {
+			return nil
+		}
+		var pairs [][2]string
+		for i, name := range re.SubexpNames() {
+			if name != "" && m[i] != "" {
+				pairs = append(pairs, [2]string{name, m[i]})
+			}
+		}
+		return pairs
+	}
+}
+
+// grokPatterns are the built-in grok patterns, a subset of the Logstash library
+var grokPatterns = map[string]string{
+	"WORD":         `\b\w+\b`,
+	"NOTSPACE":     `\S+`,
+	"SPACE":        `\s*`,
+	"DATA":         `.*?`,
+	"GREEDYDATA":   `.*`,
+	"INT":          `[+-]?\d+`,
+	"POSINT":       `\b[1-9]\d*\b`,
+	"NUMBER":       `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"BASE16NUM":    `(?:0[xX])?[0-9A-Fa-f]+`,
+	"IPV4":         `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":         `[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:%\w+)?`,
+	"IP":           `(?:%{IPV4}|%{IPV6})`,
+	"MAC":          `(?:[0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}`,
+	"HOSTNAME":     `\b[0-9A-Za-z][0-9A-Za-z\-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z\-]{0,62})*\.?\b`,
+	"IPORHOST":     `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":     `%{IPORHOST}:%{POSINT}`,
+	"USERNAME":     `[a-zA-Z0-9._-]+`,
+	"USER":         `%{USERNAME}`,
+	"QUOTEDSTRING": `"(?:[^"\\]|\\.)*"`,
+	"QS":           `%{QUOTEDSTRING}`,
+	"UUID":         `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"PATH":         `(?:/[^\s/]*)+`,
+}
+
+// grokReference matches %{PATTERN} and %{PATTERN:field}
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// expandGrok turns a grok expression into a regular expression with named groups
+func expandGrok(expression string, custom map[string]string) (string, error) {
+	var expand func(expression string, depth int) (string, error)
+	expand = func(expression string, depth int) (string, error) {
+		if depth > 10 {
+			return "", fmt.Errorf("grok patterns nest too deeply, or refer to themselves")
+		}
+		var err error
+		expanded := grokReference.ReplaceAllStringFunc(expression, func(reference string) string {
+			m := grokReference.FindStringSubmatch(reference)
+			pattern, ok := custom[m[1]]
+			if !ok {
+				pattern, ok = grokPatterns[m[1]]
+			}
+			if !ok {
+				err = fmt.Errorf("unknown grok pattern %s", m[1])
+				return ""
+			}
+			inner, innerErr := expand(pattern, depth+1)
+			if innerErr != nil {
+				err = innerErr
+				return ""
+			}
+			if m[2] != "" {
+				return "(?P<" + m[2] + ">" + inner + ")"
+			}
+			return "(?:" + inner + ")"
+		})
+		return expanded, err
+	}
+	return expand(expression, 0)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"hostlog/models"
+)
+
+// fieldPairs renders fields as name=value for comparison
+func fieldPairs(fields []models.Field) []string {
+	var pairs []string
+	for _, field := range fields {
+		pairs = append(pairs, field.Name+"="+field.Value)
+	}
+	return pairs
+}
+
+// TestParsers runs each parser type and the default pipeline over sample messages
+func TestParsers(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name    string
+		configs []ParserConfig
+		log     models.Log
+		want    []string
+	}{
+		{
+			name:    "kv",
+			configs: []ParserConfig{{Type: "kv"}},
+			log:     models.Log{Content: `DROP wan in: IN=eth1 OUT= SRC=203.0.113.9 DST=192.168.1.1 PROTO=TCP SPT=51234 DPT=22 msg="bad packet"`},
+			want:    []string{"IN=eth1", "SRC=203.0.113.9", "DST=192.168.1.1", "PROTO=TCP", "SPT=51234", "DPT=22", "msg=bad packet"},
+		},
+		{
+			name: "defaults",
+			log:  models.Log{Tag: "dropbear[7]", Content: `Bad password attempt for 'root' from 203.0.113.9:40000 attempt=3`},
+			want: []string{"attempt=3", "event=ssh.failure", "method=password", "user=root", "src=203.0.113.9", "port=40000"},
+		},
+		{
+			name: "firewall",
+			log:  models.Log{Tag: "kernel", Content: `[ 9123.456789] reject wan in: IN=eth1 OUT= MAC=00:11:22:33:44:55:66:77:88:99:aa:bb:08:00 SRC=203.0.113.9 DST=192.168.1.1 LEN=60 TOS=0x00 PREC=0x00 TTL=50 ID=4242 DF PROTO=TCP SPT=51234 DPT=22 WINDOW=64240 RES=0x00 SYN URGP=0`},
+			want: []string{"event=firewall", "action=reject", "prefix=reject wan in", "in=eth1", "src=203.0.113.9", "dst=192.168.1.1", "proto=tcp", "spt=51234", "dpt=22"},
+		},
+		{
+			name: "json",
+			log:  models.Log{Content: `@cee: {"event":"login","user":{"name":"admin","uid":0},"ok":true,"roles":["a","b"],"none":null}`},
+			want: []string{"event=login", "ok=true", "roles=[\"a\",\"b\"]", "user.name=admin", "user.uid=0"},
+		},
+		{
+			name: "regex",
+			configs: []ParserConfig{{
+				Type:    "regex",
+				Pattern: `Password auth succeeded for '(?P<user>[^']+)' from (?P<src>[\d.]+):(?P<port>\d+)`,
+			}},
+			log:  models.Log{Tag: "dropbear[1234]", Content: "Password auth succeeded for 'root' from 192.168.1.20:50022"},
+			want: []string{"user=root", "src=192.168.1.20", "port=50022"},
+		},
+		{
+			name: "grok",
+			configs: []ParserConfig{{
+				Type:     "grok",
+				Pattern:  `DHCPACK\(%{NOTSPACE:iface}\) %{IPV4:ip} %{MAC:mac}(?: %{LEASEHOST:host})?`,
+				Patterns: map[string]string{"LEASEHOST": `%{HOSTNAME}`},
+				Prefix:   "dhcp.",
+			}},
+			log:  models.Log{Content: "DHCPACK(br-lan) 192.168.1.20 b8:27:eb:12:34:56 pi"},
+			want: []string{"dhcp.iface=br-lan", "dhcp.ip=192.168.1.20", "dhcp.mac=b8:27:eb:12:34:56", "dhcp.host=pi"},
+		},
+		{
+			name: "programs",
+			configs: []ParserConfig{
+				{MessageFilter: MessageFilter{Programs: []string{"dnsmasq-dhcp"}}, Type: "regex", Pattern: `(?P<ip>[\d.]+)`},
+				{MessageFilter: MessageFilter{Programs: []string{"dropbear"}}, Type: "kv"},
+			},
+			log:  models.Log{Tag: "dropbear[99]", Content: "from 192.168.1.20 user=root"},
+			want: []string{"user=root"},
+		},
+		{
+			name: "overwrite",
+			configs: []ParserConfig{
+				{Type: "kv"},
+				{Type: "regex", Pattern: `user=(?P<user>\w+)@`},
+			},
+			log:  models.Log{Content: "user=admin@lan action=login"},
+			want: []string{"user=admin", "action=login"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			parsers, err := NewParsers(test.configs)
+			if err != nil {
+				t.Fatalf("NewParsers returned an error: %v", err)
+			}
+			if got := fieldPairs(parsers.Parse(test.log)); !slices.Equal(got, test.want) {
+				t.Errorf("Expected %q, got %q", test.want, got)
+			}
+		})
+	}
+
+	for _, configs := range [][]ParserConfig{
+		{{Type: "xml"}},
+		{{Type: "regex", Pattern: `(`}},
+		{{Type: "grok", Pattern: `%{NOPE:x}`}},
+		{{Type: "grok", Pattern: `%{LOOP}`, Patterns: map[string]string{"LOOP": `%{LOOP}`}}},
+		{{MessageFilter: MessageFilter{Content: `[`}, Type: "kv"}},
+	} {
+		if _, err := NewParsers(configs); err == nil {
+			t.Errorf("Expected an error for %+v", configs)
+		}
+	}
+
+	disabled, err := NewParsers([]ParserConfig{})
+	if err != nil || len(disabled.Parse(models.Log{Content: "a=b"})) != 0 {
+		t.Errorf("Expected an empty pipeline to extract nothing, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrQueueFull is returned when pushing to a disk queue that reached its size limit
+var ErrQueueFull = errors.New("queue full")
+
+const (
+	queueMaxRecord    = 1 << 20 // Largest record; a header claiming more means the file is corrupt
+	queueCompactBytes = 1 << 20 // Consumed bytes after which the data file is compacted
+	queueCommitEvery  = 64      // Pushes, or acks, between commits to disk
+)
+
+// diskQueue is a persistent FIFO of length-prefixed records. Records are appended to a
+// data file and consumed from a read offset stored next to it, so pending records
+// survive restarts. The consumed prefix of the data file is dropped when the queue
+// drains or the prefix grows past queueCompactBytes. Pushes and the offset are
+// synced every queueCommitEvery records, so a crash may deliver a few records twice.
+type diskQueue struct {
+	mu         sync.Mutex
+	file       *os.File
+	dataPath   string
+	offsetPath string
+	offset     int64
+	size       int64
+	maxBytes   int64
+	pushed     int // Pushes since the last sync
+	acked      int // Acks since the offset was written
+	ready      chan struct{}
+}
+
+// openDiskQueue opens or creates the queue stored in dir
+func openDiskQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	dataPath := filepath.Join(dir, "queue.dat")
+	file, err := os.OpenFile(dataPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	q := &diskQueue{
+		file:       file,
+		dataPath:   dataPath,
+		offsetPath: filepath.Join(dir, "queue.offset"),
+		size:       info.Size(),
+		maxBytes:   maxBytes,
+		ready:      make(chan struct{}, 1),
+	}
+
+	if data, err := os.ReadFile(q.offsetPath); err == nil {
+		offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && offset >= 0 && offset <= q.size {
+			q.offset = offset
+		}
+	}
+
+	if q.offset < q.size {
+		q.signal()
+	}
+	return q, nil
+}
+
+func (q *diskQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Push appends a record to the end of the queue
+func (q *diskQueue) Push(record []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(record) > queueMaxRecord {
+		return fmt.Errorf("record of %d bytes exceeds %d", len(record), queueMaxRecord)
+	}
+	length := int64(4 + len(record))
+	if q.maxBytes > 0 && q.size-q.offset+length > q.maxBytes {
+		return ErrQueueFull
+	}
+
+	buf := make([]byte, length)
+	binary.BigEndian.PutUint32(buf, uint32(len(record)))
+	copy(buf[4:], record)
+	if _, err := q.file.WriteAt(buf, q.size); err != nil {
+		return err
+	}
+	q.size += length
+
+	q.pushed++
+	if q.pushed >= queueCommitEvery {
+		if err := q.file.Sync(); err != nil {
+			return err
+		}
+		q.pushed = 0
+	}
+
+	q.signal()
+	return nil
+}
+
+// Peek returns the oldest pending record without removing it
+func (q *diskQueue) Peek() ([]byte, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.offset >= q.size {
+		return nil, false, nil
+	}
+
+	var header [4]byte
+	_, err := q.file.ReadAt(header[:], q.offset)
+	if err == nil {
+		length := binary.BigEndian.Uint32(header[:])
+		if length > queueMaxRecord {
+			return nil, false, q.dropPending(fmt.Sprintf("corrupt record of %d bytes", length))
+		}
+		record := make([]byte, length)
+		if _, err = q.file.ReadAt(record, q.offset+4); err == nil {
+			return record, true, nil
+		}
+	}
+
+	// A record cut short by a crash during Push is dropped
+	if err == io.EOF {
+		return nil, false, q.dropPending("truncated record")
+	}
+	return nil, false, err
+}
+
+// dropPending drops the records from the read offset on, as the record there cannot be read
+func (q *diskQueue) dropPending(reason string) error {
+	q.size = q.offset
+	if err := q.file.Truncate(q.size); err != nil {
+		return err
+	}
+	return fmt.Errorf("dropped %s at offset %d and the records after it", reason, q.offset)
+}
+
+// Ack removes the record returned by the last Peek
+func (q *diskQueue) Ack(record []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.offset += int64(4 + len(record))
+	q.acked++
+	switch {
+	case q.offset >= q.size:
+		if err := q.file.Truncate(0); err != nil {
+			return err
+		}
+		q.offset, q.size = 0, 0
+		return q.commit()
+	case q.offset >= queueCompactBytes && q.offset >= q.size-q.offset:
+		// Copying at most as much as was consumed keeps compaction cheap with a long backlog
+		return q.compact()
+	case q.acked >= queueCommitEvery:
+		return q.commit()
+	}
+	return nil
+}
+
+// commit syncs the pushed records and writes the read offset
+func (q *diskQueue) commit() error {
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	q.pushed = 0
+	if err := writeFileSynced(q.offsetPath, []byte(strconv.FormatInt(q.offset, 10))); err != nil {
+		return err
+	}
+	q.acked = 0
+	return nil
+}
+
+// compact moves the pending records into a new data file
+func (q *diskQueue) compact() error {
+	tmpPath := q.dataPath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, io.NewSectionReader(q.file, q.offset, q.size-q.offset))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	// The offset is reset first: a crash before the rename then delivers some records twice rather than skipping any
+	if err == nil {
+		err = writeFileSynced(q.offsetPath, []byte("0"))
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, q.dataPath)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	q.file.Close()
+	q.file = tmp
+	q.size -= q.offset
+	q.offset = 0
+	q.pushed, q.acked = 0, 0
+	return nil
+}
+
+// writeFileSynced replaces a file with data, syncing it before it takes the place of the old one
+func writeFileSynced(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Len returns the number of pending bytes, including record headers
+func (q *diskQueue) Len() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size - q.offset
+}
+
+// Ready is signalled whenever records are pushed
+func (q *diskQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Close commits the queue and closes its data file
+func (q *diskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.commit()
+	if cerr := q.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
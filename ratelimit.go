@@ -0,0 +1,273 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"hostlog/models"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// RateLimitConfig limits how fast each source, and all sources together, may
+// write messages. A rate of 0 leaves it unlimited.
+type RateLimitConfig struct {
+	Rate        float64  `json:"rate"`         // Messages per second from one source
+	Burst       int      `json:"burst"`        // Messages a source may send at once; default one second's worth
+	GlobalRate  float64  `json:"global_rate"`  // Messages per second from all sources
+	GlobalBurst int      `json:"global_burst"` // default one second's worth
+	Excess      string   `json:"excess"`       // drop, sample or summarize (default)
+	Sample      int      `json:"sample"`       // Keep one in this many excess messages when sampling; default 10
+	Interval    Duration `json:"interval"`     // How often suppressed messages are summarized; default 1m
+}
+
+// What happens to the messages over the limit
+const (
+	ExcessDrop      = "drop"      // Only counted
+	ExcessSample    = "sample"    // One in Sample is stored
+	ExcessSummarize = "summarize" // Counted in a message per source every Interval
+)
+
+// rateSummaryTag is the program of the messages that summarize suppressed messages
+const rateSummaryTag = "hostlog"
+
+// rateSummaryKey marks the log parts of a summary, which the limits do not apply to
+const rateSummaryKey = "rate_limit_summary"
+
+// rateIdle is how long a source's bucket, and its counts once summarized, are kept after its last message
+const rateIdle = 10 * time.Minute
+
+// rateMaxSources bounds the sources counted one by one; the excess of further
+// sources, such as a flood from spoofed addresses, is counted under rateOtherSources
+const rateMaxSources = 256
+
+// rateOtherSources counts the sources over rateMaxSources
+const rateOtherSources = "other"
+
+// rateMaxBuckets bounds the sources limited one by one; further sources share
+// the bucket of rateOtherSources until idle buckets are forgotten
+const rateMaxBuckets = 4096
+
+// tokenBucket refills at a rate up to a burst and spends a token per message
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned until now and reports whether one is left
+func (b *tokenBucket) refill(rate float64, burst int, now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	return b.tokens >= 1
+}
+
+// RateStats counts the messages of one source over the limits
+type RateStats struct {
+	Source     string
+	Limited    int64 // Messages over the limits
+	Dropped    int64 // Messages over the limits that were not stored
+	Suppressed int64 // Dropped messages not summarized yet
+	Last       time.Time
+}
+
+// RateLimiter applies token-bucket limits to the messages of each source
+type RateLimiter struct {
+	config RateLimitConfig
+
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	global   tokenBucket
+	stats    map[string]*RateStats // Sources that went over the limits
+	received int64
+}
+
+// NewRateLimiter returns a limiter for the configuration, or nil when nothing is limited
+func NewRateLimiter(config RateLimitConfig) (*RateLimiter, error) {
+	if config.Rate < 0 || config.GlobalRate < 0 || config.Burst < 0 || config.GlobalBurst < 0 || config.Sample < 0 {
+		return nil, fmt.Errorf("rate limits must not be negative")
+	}
+	if config.Excess == "" {
+		config.Excess = ExcessSummarize
+	}
+	if !slices.Contains([]string{ExcessDrop, ExcessSample, ExcessSummarize}, config.Excess) {
+		return nil, fmt.Errorf("unknown excess handling %q", config.Excess)
+	}
+	if config.Rate == 0 && config.GlobalRate == 0 {
+		return nil, nil
+	}
+
+	// A burst left out allows one second's worth of messages
+	if config.Burst == 0 {
+		config.Burst = max(int(math.Ceil(config.Rate)), 1)
+	}
+	if config.GlobalBurst == 0 {
+		config.GlobalBurst = max(int(math.Ceil(config.GlobalRate)), 1)
+	}
+	if config.Sample == 0 {
+		config.Sample = 10
+	}
+	config.Interval = Duration(config.Interval.Or(time.Minute))
+
+	return &RateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		stats:   make(map[string]*RateStats),
+	}, nil
+}
+
+// Allow reports whether a message received at now is stored. Summaries are always
+// stored, without their marker.
+func (r *RateLimiter) Allow(logParts format.LogParts, now time.Time) bool {
+	if _, ok := logParts[rateSummaryKey]; ok {
+		delete(logParts, rateSummaryKey)
+		return true
+	}
+	if r == nil {
+		return true
+	}
+	source := models.ExtractIP(models.GetStringValue(logParts, "client"))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received++
+
+	// A token is only spent when both limits allow the message, so that the
+	// global limit does not use up the budget of the source
+	var bucket *tokenBucket
+	allowed := true
+	if r.config.Rate > 0 {
+		key := source
+		if _, ok := r.buckets[key]; !ok && len(r.buckets) >= rateMaxBuckets {
+			key = rateOtherSources
+		}
+		var ok bool
+		if bucket, ok = r.buckets[key]; !ok {
+			bucket = &tokenBucket{}
+			r.buckets[key] = bucket
+		}
+		allowed = bucket.refill(r.config.Rate, r.config.Burst, now)
+	}
+	if r.config.GlobalRate > 0 {
+		allowed = r.global.refill(r.config.GlobalRate, r.config.GlobalBurst, now) && allowed
+	}
+	if allowed {
+		if bucket != nil {
+			bucket.tokens--
+		}
+		if r.config.GlobalRate > 0 {
+			r.global.tokens--
+		}
+		return true
+	}
+
+	stats, ok := r.stats[source]
+	if !ok {
+		if len(r.stats) >= rateMaxSources {
+			source = rateOtherSources
+		}
+		if stats, ok = r.stats[source]; !ok {
+			stats = &RateStats{Source: source}
+			r.stats[source] = stats
+		}
+	}
+	stats.Limited++
+	stats.Last = now
+	if r.config.Excess == ExcessSample && (stats.Limited-1)%int64(r.config.Sample) == 0 {
+		return true
+	}
+	stats.Dropped++
+	if r.config.Excess == ExcessSummarize {
+		stats.Suppressed++
+	}
+	return false
+}
+
+// Run sends the summaries of suppressed messages to out every interval and
+// forgets the buckets and counts of sources that went quiet
+func (r *RateLimiter) Run(out chan<- format.LogParts) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(r.config.Interval))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, summary := range r.summaries(now) {
+			out <- summary
+		}
+	}
+}
+
+// summaries returns a message per source with the messages suppressed since the last summary
+func (r *RateLimiter) summaries(now time.Time) []format.LogParts {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for source, bucket := range r.buckets {
+		if now.Sub(bucket.last) > rateIdle {
+			delete(r.buckets, source)
+		}
+	}
+
+	var summaries []format.LogParts
+	for _, source := range slices.Sorted(maps.Keys(r.stats)) {
+		stats := r.stats[source]
+		if stats.Suppressed == 0 {
+			if now.Sub(stats.Last) > rateIdle {
+				delete(r.stats, source)
+			}
+			continue
+		}
+		summary := format.LogParts{
+			"client":       source,
+			"tag":          rateSummaryTag,
+			"content":      fmt.Sprintf("%d messages suppressed by rate limit", stats.Suppressed),
+			"priority":     5*8 + 4, // syslog.warning
+			"timestamp":    now,
+			rateSummaryKey: true,
+		}
+		if source == rateOtherSources {
+			// Logged by hostlog itself, as no address sent them all
+			summary["client"] = ""
+			summary["hostname"] = rateSummaryTag
+			summary["content"] = fmt.Sprintf("%d messages from other sources suppressed by rate limit", stats.Suppressed)
+		}
+		summaries = append(summaries, summary)
+		stats.Suppressed = 0
+	}
+	return summaries
+}
+
+// Stats returns the messages received and the sources that went over the limits, most limited first
+func (r *RateLimiter) Stats() (int64, []RateStats) {
+	if r == nil {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]RateStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b RateStats) int {
+		return cmp.Or(cmp.Compare(b.Limited, a.Limited), cmp.Compare(a.Source, b.Source))
+	})
+	return r.received, stats
+}
+
+// Config returns the limits with their defaults filled in
+func (r *RateLimiter) Config() RateLimitConfig {
+	if r == nil {
+		return RateLimitConfig{}
+	}
+	return r.config
+}
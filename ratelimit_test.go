@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// TestRateLimiter limits each source and all sources together, and handles the excess as configured
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	from := func(source string) format.LogParts {
+		return format.LogParts{"client": source + ":514", "content": "flood"}
+	}
+	// send sends count messages from a source, one every gap, and returns how many were allowed
+	send := func(limiter *RateLimiter, source string, count int, gap time.Duration) int {
+		allowed := 0
+		for i := 0; i < count; i++ {
+			if limiter.Allow(from(source), start.Add(time.Duration(i)*gap)) {
+				allowed++
+			}
+		}
+		return allowed
+	}
+
+	// A burst of 5 then one message per second; the flood of one source leaves the other alone
+	limiter, err := NewRateLimiter(RateLimitConfig{Rate: 1, Burst: 5})
+	if err != nil {
+		t.Fatalf("NewRateLimiter returned an error: %v", err)
+	}
+	if allowed := send(limiter, "192.168.1.66", 100, 100*time.Millisecond); allowed != 5+9 {
+		t.Errorf("Expected the burst and one message per second, got %d", allowed)
+	}
+	if allowed := send(limiter, "192.168.1.1", 3, time.Second); allowed != 3 {
+		t.Errorf("Expected a quiet source to pass, got %d", allowed)
+	}
+	received, stats := limiter.Stats()
+	if received != 103 || len(stats) != 1 || stats[0].Source != "192.168.1.66" || stats[0].Limited != 86 || stats[0].Dropped != 86 {
+		t.Errorf("Expected the flooding source counted, got %d %+v", received, stats)
+	}
+
+	// Suppressed messages are summarized once, as a message from the source that passes the limits
+	summaries := limiter.summaries(start.Add(time.Minute))
+	if len(summaries) != 1 || summaries[0]["client"] != "192.168.1.66" || summaries[0]["content"] != "86 messages suppressed by rate limit" {
+		t.Fatalf("Expected one summary, got %v", summaries)
+	}
+	if !limiter.Allow(summaries[0], start) || summaries[0][rateSummaryKey] != nil {
+		t.Error("Expected the summary to pass without its marker")
+	}
+	if again := limiter.summaries(start.Add(2 * time.Minute)); len(again) != 0 {
+		t.Errorf("Expected nothing left to summarize, got %v", again)
+	}
+
+	// Sampling stores one in Sample messages over the global limit
+	sampler, err := NewRateLimiter(RateLimitConfig{GlobalRate: 10, Excess: ExcessSample, Sample: 4})
+	if err != nil {
+		t.Fatalf("NewRateLimiter returned an error: %v", err)
+	}
+	if allowed := send(sampler, "192.168.1.66", 30, 0) + send(sampler, "192.168.1.1", 10, 0); allowed != 10+8 {
+		t.Errorf("Expected 10 messages and every fourth of the rest, got %d", allowed)
+	}
+	if summaries := sampler.summaries(start.Add(time.Minute)); len(summaries) != 0 {
+		t.Errorf("Expected no summaries when sampling, got %v", summaries)
+	}
+
+	// Messages over the global limit leave the budget of their source
+	shared, err := NewRateLimiter(RateLimitConfig{Rate: 0.001, Burst: 2, GlobalRate: 1, GlobalBurst: 1})
+	if err != nil {
+		t.Fatalf("NewRateLimiter returned an error: %v", err)
+	}
+	if allowed := send(shared, "192.168.1.1", 6, 0); allowed != 1 {
+		t.Errorf("Expected the global burst of 1, got %d", allowed)
+	}
+	if !shared.Allow(from("192.168.1.1"), start.Add(time.Second)) {
+		t.Error("Expected the source's second token to be left")
+	}
+
+	// A flood from many addresses counts the sources beyond the limit together, and forgets them once summarized and idle
+	spoofed, err := NewRateLimiter(RateLimitConfig{GlobalRate: 1})
+	if err != nil {
+		t.Fatalf("NewRateLimiter returned an error: %v", err)
+	}
+	for i := 0; i < rateMaxSources+50; i++ {
+		spoofed.Allow(from(fmt.Sprintf("10.%d.%d.1", i/256, i%256)), start)
+	}
+	if _, stats := spoofed.Stats(); len(stats) != rateMaxSources+1 || stats[0].Source != rateOtherSources || stats[0].Limited != 49 {
+		t.Errorf("Expected %d sources and the others counted together, got %d, first %+v", rateMaxSources, len(stats), stats[0])
+	}
+	summaries = spoofed.summaries(start.Add(time.Minute))
+	if last := summaries[len(summaries)-1]; len(summaries) != rateMaxSources+1 || last["content"] != "49 messages from other sources suppressed by rate limit" {
+		t.Errorf("Expected a summary for the other sources, got %d, last %v", len(summaries), last)
+	}
+	spoofed.summaries(start.Add(rateIdle + 2*time.Minute))
+	if _, stats := spoofed.Stats(); len(stats) != 0 {
+		t.Errorf("Expected idle sources forgotten, got %d", len(stats))
+	}
+
+	// Sources beyond the bucket limit share one bucket
+	crowded, err := NewRateLimiter(RateLimitConfig{Rate: 1, Burst: 1})
+	if err != nil {
+		t.Fatalf("NewRateLimiter returned an error: %v", err)
+	}
+	allowed := 0
+	for i := 0; i < rateMaxBuckets+100; i++ {
+		if crowded.Allow(from(fmt.Sprintf("10.%d.%d.1", i/256, i%256)), start) {
+			allowed++
+		}
+	}
+	if len(crowded.buckets) != rateMaxBuckets+1 || allowed != rateMaxBuckets+1 {
+		t.Errorf("Expected %d buckets and one message from the other sources, got %d buckets and %d messages", rateMaxBuckets+1, len(crowded.buckets), allowed)
+	}
+
+	var unlimited *RateLimiter
+	if limiter, err := NewRateLimiter(RateLimitConfig{}); limiter != nil || err != nil {
+		t.Errorf("Expected no limiter without limits, got %v, %v", limiter, err)
+	}
+	if !unlimited.Allow(from("192.168.1.66"), start) {
+		t.Error("Expected everything to pass without limits")
+	}
+	for _, config := range []RateLimitConfig{{Rate: -1}, {Rate: 1, Excess: "bounce"}} {
+		if _, err := NewRateLimiter(config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"hostlog/models"
+)
+
+// TestDuplicateSuppression counts a message a host repeats on one row, and weighs the repeats in scores
+func TestDuplicateSuppression(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+
+	send := func(content string) models.Log {
+		t.Helper()
+		l, err := store.SaveLog(map[string]interface{}{
+			"client":    "192.168.1.1:514",
+			"tag":       "netifd",
+			"content":   content,
+			"priority":  30,
+			"timestamp": time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("SaveLog returned an error: %v", err)
+		}
+		return l
+	}
+
+	first := send("Interface 'wan' has link connectivity loss")
+	var last models.Log
+	for i := 0; i < 4; i++ {
+		last = send("Interface 'wan' has link connectivity loss")
+	}
+	if last.ID != first.ID || last.Repeats != 5 || !last.LastReceived().After(first.ReceivedAt) {
+		t.Errorf("Expected the repeats counted on the first row, got %+v", last)
+	}
+
+	// Only consecutive messages repeat
+	up := send("Interface 'wan' is now up")
+	again := send("Interface 'wan' has link connectivity loss")
+	if up.ID == first.ID || again.ID == first.ID || again.Repeats != 1 {
+		t.Errorf("Expected new rows after another message, got %d and %+v", up.ID, again)
+	}
+
+	var stored models.Log
+	if err := store.DB.First(&stored, first.ID).Error; err != nil {
+		t.Fatalf("Failed to read the repeated row: %v", err)
+	}
+	if stored.Repeats != 5 || !stored.LastReceivedAt.Equal(last.LastReceivedAt) {
+		t.Errorf("Expected 5 repeats stored, got %d last at %s", stored.Repeats, stored.LastReceivedAt)
+	}
+
+	// Five repeats weigh less than five messages
+	volume, err := VolumeComponent(store, "192.168.1.1", 1)
+	if err != nil {
+		t.Fatalf("VolumeComponent returned an error: %v", err)
+	}
+	if want := 2 + repeatWeight(5); math.Abs(volume-want) > 1e-9 {
+		t.Errorf("Expected a volume of %.2f, got %.2f", want, volume)
+	}
+
+	// A window of 0s stores every message
+	var config DedupConfig
+	if err := json.Unmarshal([]byte(`{"window": "0s"}`), &config); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := config.Apply(store); err != nil || store.DedupWindow != 0 {
+		t.Fatalf("Expected dedup disabled, got %s, %v", store.DedupWindow, err)
+	}
+	if l := send("Interface 'wan' has link connectivity loss"); l.ID == again.ID || l.Repeats != 1 {
+		t.Errorf("Expected a new row with dedup disabled, got %+v", l)
+	}
+	if err := (DedupConfig{}).Apply(store); err != nil || store.DedupWindow != models.DefaultDedupWindow {
+		t.Errorf("Expected the default window, got %s, %v", store.DedupWindow, err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"hostlog/models"
+)
+
+// RunRetention prunes logs older than retention every hour; it never returns
+func RunRetention(store *models.Store, retention time.Duration) {
+	for {
+		pruned, err := store.Backend.Prune(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error pruning logs: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d logs older than %s", pruned, retention)
+		}
+		time.Sleep(time.Hour)
+	}
+}
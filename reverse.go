@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlog/models"
+)
+
+// ReverseDNSConfig enables reverse DNS lookups of the addresses that send logs
+type ReverseDNSConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Server      string   `json:"server"`       // Resolver as host:port; default the system resolver
+	TTL         Duration `json:"ttl"`          // How long a name is kept; default 24h
+	NegativeTTL Duration `json:"negative_ttl"` // How long an address without a name is kept, and a failed lookup waits; default 1h
+	Timeout     Duration `json:"timeout"`      // Per lookup; default 5s
+}
+
+// reverseQueueSize bounds the addresses waiting for a lookup; further addresses are retried when next seen
+const reverseQueueSize = 256
+
+// reverseMaxDue bounds the addresses whose next lookup time is remembered; the
+// store still holds their names, so forgetting them only costs a database read
+const reverseMaxDue = 4096
+
+// ReverseResolver looks up the names of sending addresses in the background and
+// caches them in the store
+type ReverseResolver struct {
+	store    *models.Store
+	config   ReverseDNSConfig
+	resolver *net.Resolver
+	queue    chan string
+
+	mu  sync.Mutex
+	due map[string]time.Time // Address to when it is looked up again
+}
+
+// NewReverseResolver returns a resolver for the configuration, or nil when reverse DNS is disabled
+func NewReverseResolver(store *models.Store, config ReverseDNSConfig) *ReverseResolver {
+	if !config.Enabled {
+		return nil
+	}
+
+	resolver := net.DefaultResolver
+	if config.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, config.Server)
+			},
+		}
+	}
+
+	return &ReverseResolver{
+		store:    store,
+		config:   config,
+		resolver: resolver,
+		queue:    make(chan string, reverseQueueSize),
+		due:      make(map[string]time.Time),
+	}
+}
+
+// Observe queues a lookup of the address unless its cached name is still fresh
+func (r *ReverseResolver) Observe(clientIP string) {
+	if r == nil || net.ParseIP(clientIP) == nil {
+		return
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due, ok := r.due[clientIP]
+	if ok && now.Before(due) {
+		return
+	}
+	if !ok && len(r.due) >= reverseMaxDue {
+		r.forget(now)
+	}
+
+	select {
+	case r.queue <- clientIP:
+		// Not queued again while the lookup is pending
+		r.due[clientIP] = now.Add(r.config.Timeout.Or(5 * time.Second))
+	default:
+	}
+}
+
+// forget drops the addresses that are due, or all of them when none are
+func (r *ReverseResolver) forget(now time.Time) {
+	for clientIP, due := range r.due {
+		if !now.Before(due) {
+			delete(r.due, clientIP)
+		}
+	}
+	if len(r.due) >= reverseMaxDue {
+		clear(r.due)
+	}
+}
+
+// Run performs the queued lookups
+func (r *ReverseResolver) Run() {
+	for clientIP := range r.queue {
+		expires, err := r.resolve(clientIP)
+		if err != nil {
+			log.Printf("Error saving reverse DNS name of %s: %v", clientIP, err)
+			expires = time.Now().Add(r.config.NegativeTTL.Or(time.Hour))
+		}
+
+		r.mu.Lock()
+		r.due[clientIP] = expires
+		r.mu.Unlock()
+	}
+}
+
+// resolve looks up an address unless the store has a fresh name for it, and
+// returns when the name expires
+func (r *ReverseResolver) resolve(clientIP string) (time.Time, error) {
+	cached, err := r.store.GetReverseNames([]string{clientIP})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if reverse, ok := cached[clientIP]; ok && time.Now().Before(reverse.ExpiresAt) {
+		return reverse.ExpiresAt, nil
+	}
+
+	negative := time.Now().Add(r.config.NegativeTTL.Or(time.Hour))
+	name, ok := r.lookup(clientIP)
+	if !ok {
+		// A failed lookup keeps the name found before, and is retried after the negative TTL
+		return negative, nil
+	}
+	expires := time.Now().Add(r.config.TTL.Or(24 * time.Hour))
+	if name == "" {
+		expires = negative
+	}
+	return expires, r.store.SaveReverseName(clientIP, name, expires)
+}
+
+// lookup returns the first name of an address, or "" when it has none; ok is
+// false when the lookup failed, such as on a timeout or SERVFAIL
+func (r *ReverseResolver) lookup(clientIP string) (name string, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout.Or(5*time.Second))
+	defer cancel()
+
+	names, err := r.resolver.LookupAddr(ctx, clientIP)
+	if err != nil {
+		if dnsErr, isDNS := err.(*net.DNSError); isDNS && dnsErr.IsNotFound {
+			return "", true
+		}
+		log.Printf("Error looking up %s: %v", clientIP, err)
+		return "", false
+	}
+	if len(names) == 0 {
+		return "", true
+	}
+	return strings.TrimSuffix(names[0], "."), true
+}
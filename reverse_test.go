@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dnsStandIn answers PTR queries over UDP from a fixed table and counts the queries per name
+type dnsStandIn struct {
+	conn  net.PacketConn
+	names map[string]string // Query name to PTR name, or "" for SERVFAIL; others are answered NXDOMAIN
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newDNSStandIn(t *testing.T, names map[string]string) *dnsStandIn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	d := &dnsStandIn{conn: conn, names: names, queries: make(map[string]int)}
+	go d.serve()
+	return d
+}
+
+func (d *dnsStandIn) count(name string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queries[name]
+}
+
+func (d *dnsStandIn) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := d.answer(buf[:n]); reply != nil {
+			d.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// answer builds the response to one query, echoing its question
+func (d *dnsStandIn) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		size := int(query[end])
+		if end+1+size > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[end+1:end+1+size]))
+		end += 1 + size
+	}
+	end += 5 // Root label, type and class
+	if end > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+
+	d.mu.Lock()
+	d.queries[name]++
+	d.mu.Unlock()
+
+	reply := append([]byte{}, query[:2]...)
+	target, ok := d.names[name]
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+	if ok && target == "" {
+		// SERVFAIL without answers
+		reply = append(reply, 0x81, 0x82, 0, 1, 0, 0, 0, 0, 0, 0)
+		return append(reply, query[12:end]...)
+	}
+	if !ok || qtype != 12 {
+		// NXDOMAIN without answers
+		reply = append(reply, 0x81, 0x83, 0, 1, 0, 0, 0, 0, 0, 0)
+		return append(reply, query[12:end]...)
+	}
+
+	reply = append(reply, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0)
+	reply = append(reply, query[12:end]...)
+	var rdata []byte
+	for _, label := range strings.Split(strings.TrimSuffix(target, "."), ".") {
+		rdata = append(append(rdata, byte(len(label))), label...)
+	}
+	rdata = append(rdata, 0)
+	reply = append(reply, 0xc0, 12, 0, 12, 0, 1, 0, 0, 0x0e, 0x10)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+	return append(reply, rdata...)
+}
+
+// TestReverseResolver verifies lookups against a configured server with positive and negative caching
+func TestReverseResolver(t *testing.T) {
+	t.Parallel()
+	store := openTestDB(t)
+	dns := newDNSStandIn(t, map[string]string{"10.2.0.192.in-addr.arpa": "nas.lan.", "12.2.0.192.in-addr.arpa": ""})
+
+	resolver := NewReverseResolver(store, ReverseDNSConfig{
+		Enabled:     true,
+		Server:      dns.conn.LocalAddr().String(),
+		NegativeTTL: Duration(time.Hour),
+	})
+	go resolver.Run()
+
+	// waitFor polls until a lookup of the address has been stored
+	waitFor := func(clientIP string) string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			names, err := store.GetReverseNames([]string{clientIP})
+			if err != nil {
+				t.Fatalf("GetReverseNames returned an error: %v", err)
+			}
+			if reverse, ok := names[clientIP]; ok {
+				return reverse.Name
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for the lookup of %s", clientIP)
+		return ""
+	}
+
+	id, err := store.ResolveHost("192.0.2.10", "", time.Now())
+	if err != nil {
+		t.Fatalf("ResolveHost returned an error: %v", err)
+	}
+	resolver.Observe("192.0.2.10")
+	resolver.Observe("192.0.2.11")
+	if name := waitFor("192.0.2.10"); name != "nas.lan" {
+		t.Errorf("Expected nas.lan, got %q", name)
+	}
+	if name := waitFor("192.0.2.11"); name != "" {
+		t.Errorf("Expected no name for an unknown address, got %q", name)
+	}
+
+	// Both answers are cached, so seeing the addresses again sends no queries
+	resolver.Observe("192.0.2.10")
+	resolver.Observe("192.0.2.11")
+	time.Sleep(100 * time.Millisecond)
+	if found, missing := dns.count("10.2.0.192.in-addr.arpa"), dns.count("11.2.0.192.in-addr.arpa"); found != 1 || missing != 1 {
+		t.Errorf("Expected one query per address, got %d and %d", found, missing)
+	}
+
+	host, err := store.GetHost(id)
+	if err != nil {
+		t.Fatalf("GetHost returned an error: %v", err)
+	}
+	if host.DisplayName() != "nas.lan" || host.AddressLabels()[0] != "192.0.2.10 (nas.lan)" {
+		t.Errorf("Expected the reverse name on the host, got %q and %v", host.DisplayName(), host.AddressLabels())
+	}
+
+	// A fresh resolver finds the names cached in the store
+	restarted := NewReverseResolver(store, ReverseDNSConfig{Enabled: true, Server: dns.conn.LocalAddr().String()})
+	if expires, err := restarted.resolve("192.0.2.10"); err != nil || !expires.After(time.Now()) {
+		t.Errorf("Expected the stored name to be reused, got %v, %v", expires, err)
+	}
+	if count := dns.count("10.2.0.192.in-addr.arpa"); count != 1 {
+		t.Errorf("Expected no query for a stored name, got %d", count)
+	}
+
+	// A failed lookup keeps the name found before
+	if err := store.SaveReverseName("192.0.2.12", "printer.lan", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("SaveReverseName returned an error: %v", err)
+	}
+	if expires, err := restarted.resolve("192.0.2.12"); err != nil || !expires.After(time.Now()) {
+		t.Errorf("Expected the failed lookup retried later, got %v, %v", expires, err)
+	}
+	if names, err := store.GetReverseNames([]string{"192.0.2.12"}); err != nil || names["192.0.2.12"].Name != "printer.lan" {
+		t.Errorf("Expected the previous name kept, got %v, %v", names, err)
+	}
+
+	// The addresses waiting for their next lookup are bounded
+	for i := 0; i < reverseMaxDue+100; i++ {
+		restarted.Observe(fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+		<-restarted.queue
+	}
+	if len(restarted.due) > reverseMaxDue {
+		t.Errorf("Expected at most %d addresses remembered, got %d", reverseMaxDue, len(restarted.due))
+	}
+
+	if NewReverseResolver(store, ReverseDNSConfig{}) != nil {
+		t.Error("Expected no resolver when reverse DNS is disabled")
+	}
+}
@@ -17,7 +17,8 @@ import (
 // - S = Severity score of recent events
 // - α, β, γ = Weighting coefficients
 // - λ = Decay rate constant
-func VisibilityScore(host string) (float64, error) {
+// Repeated messages count as repeatWeight messages in V and S.
+func VisibilityScore(store *models.Store, host string) (float64, error) {
 	// Default parameters
 	alpha := 10.0 // Weight for time decay component
 	beta := 0.5   // Weight for volume component
@@ -25,17 +26,17 @@ func VisibilityScore(host string) (float64, error) {
 	lambda := 0.2 // Decay rate constant
 
 	// Calculate each component
-	timeDecay, err := TimeDecayComponent(host, alpha, lambda)
+	timeDecay, err := TimeDecayComponent(store, host, alpha, lambda)
 	if err != nil {
 		return 0, err
 	}
 
-	volume, err := VolumeComponent(host, beta)
+	volume, err := VolumeComponent(store, host, beta)
 	if err != nil {
 		return 0, err
 	}
 
-	severity, err := SeverityComponent(host, gamma)
+	severity, err := SeverityComponent(store, host, gamma)
 	if err != nil {
 		return 0, err
 	}
@@ -54,38 +55,52 @@ func VisibilityScore(host string) (float64, error) {
 
 // TimeDecayComponent calculates the time decay component of the visibility score
 // Formula: α * e^(-λ * T)
-// Where T is the time since the most recent event in hours
-func TimeDecayComponent(host string, alpha, lambda float64) (float64, error) {
-	log, err := models.GetFirst(host)
+// Where T is the time since the most recent event in hours, on the store's clock
+func TimeDecayComponent(store *models.Store, host string, alpha, lambda float64) (float64, error) {
+	log, err := store.GetFirst(host)
 	if err != nil {
 		return 0, err
 	}
 
-	// Calculate hours since the most recent event
-	hoursSince := time.Since(log.Timestamp).Hours()
+	clock, err := store.HostClock(host, store.Clock)
+	if err != nil {
+		return 0, err
+	}
+
+	// Calculate hours since the most recent event, which may be a repeat of the latest log
+	hoursSince := time.Since(log.Time(clock).Add(log.LastReceived().Sub(log.ReceivedAt))).Hours()
 
 	// Calculate time decay component
 	return alpha * math.Exp(-lambda*hoursSince), nil
 }
 
+// repeatWeight is how many messages a log repeated the given times counts as.
+// Repeats add logarithmically, so a flapping link weighs like a few messages
+// rather than thousands.
+func repeatWeight(repeats int) float64 {
+	return 1 + math.Log(float64(max(repeats, 1)))
+}
+
 // VolumeComponent calculates the volume component of the visibility score
 // Formula: β * V
-// Where V is the number of events in the last hour
-func VolumeComponent(host string, beta float64) (float64, error) {
+// Where V is the number of events in the last hour, weighing repeats by repeatWeight
+func VolumeComponent(store *models.Store, host string, beta float64) (float64, error) {
 	// Calculate the timestamp for one hour ago
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
 
 	// Count logs in the last hour
-	var count int64
-	count, err := models.GetCount(host, oneHourAgo)
+	repeats, err := store.GetRepeats(host, oneHourAgo, store.Clock)
 	if err != nil {
 		return 0, err
 	}
+	var volume float64
+	for _, count := range repeats {
+		volume += repeatWeight(count)
+	}
 
 	// Calculate volume component
 	// Optional: Cap the volume to prevent unusual bursts from dominating
 	maxVolume := 100.0
-	volume := float64(count)
 	if volume > maxVolume {
 		volume = maxVolume
 	}
@@ -95,10 +110,10 @@ func VolumeComponent(host string, beta float64) (float64, error) {
 
 // SeverityComponent calculates the severity component of the visibility score
 // Formula: γ * S
-// Where S is a weighted average of event severities
-func SeverityComponent(host string, gamma float64) (float64, error) {
+// Where S is a weighted average of event severities, weighing repeats by repeatWeight
+func SeverityComponent(store *models.Store, host string, gamma float64) (float64, error) {
 	timeWindow := time.Now().Add(-24 * time.Hour)
-	logs, err := models.GetLogs(host, timeWindow)
+	logs, err := store.GetLogs(host, timeWindow, store.Clock)
 	if err != nil {
 		return 0, err
 	}
@@ -109,19 +124,20 @@ func SeverityComponent(host string, gamma float64) (float64, error) {
 
 	// Define weights for different severity levels
 	// Using the priority field from logs (lower number = higher severity in syslog)
-	var errorCount, warningCount, infoCount int
+	var errorCount, warningCount, infoCount float64
 
 	for _, log := range logs {
 		// Extract severity from priority (lower 3 bits of priority)
 		severity := log.Priority & 7
+		weight := repeatWeight(log.Repeats)
 
 		switch severity {
 		case 0, 1, 2: // Error levels
-			errorCount++
+			errorCount += weight
 		case 3, 4: // Warning levels
-			warningCount++
+			warningCount += weight
 		case 5, 6, 7: // Info and debug levels
-			infoCount++
+			infoCount += weight
 		}
 	}
 
@@ -132,9 +148,18 @@ func SeverityComponent(host string, gamma float64) (float64, error) {
 	infoWeight := 1.0
 
 	totalCount := errorCount + warningCount + infoCount
-	severityScore := (errorWeight*float64(errorCount) +
-		warningWeight*float64(warningCount) +
-		infoWeight*float64(infoCount)) / float64(totalCount)
+	severityScore := (errorWeight*errorCount +
+		warningWeight*warningCount +
+		infoWeight*infoCount) / totalCount
+
+	// Taking part in a brute-force attack, as its source or its target, weighs as much as errors
+	bruteForce, err := store.InBruteForce(host, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if bruteForce {
+		severityScore += errorWeight
+	}
 
 	return gamma * severityScore, nil
 }
@@ -147,8 +172,8 @@ type HostScore struct {
 
 // GetAllHostScores calculates visibility scores for all hosts
 // Returns a list of host-score pairs
-func GetAllHostScores() ([]HostScore, error) {
-	hosts, err := models.GetAllHosts()
+func GetAllHostScores(store *models.Store) ([]HostScore, error) {
+	hosts, err := store.GetAllHosts()
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +184,7 @@ func GetAllHostScores() ([]HostScore, error) {
 			continue // Skip empty hosts
 		}
 
-		score, err := VisibilityScore(host)
+		score, err := VisibilityScore(store, host)
 		if err != nil {
 			// Log the error but continue with other hosts
 			log.Printf("Error calculating score for host %s: %v", host, err)
@@ -7,14 +7,13 @@ import (
 	"testing"
 	"time"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"hostlog/models"
 )
 
 // setupTestDBFromCSV creates a temporary test database for CSV-based tests
-func setupTestDBFromCSV(t *testing.T) (*gorm.DB, func()) {
+func setupTestDBFromCSV(t *testing.T) (*models.Store, func()) {
 	// Create a temporary database file
 	tempFile, err := os.CreateTemp("", "test-logs-*.db")
 	if err != nil {
@@ -23,31 +22,24 @@ func setupTestDBFromCSV(t *testing.T) (*gorm.DB, func()) {
 	tempFile.Close()
 
 	// Open the database connection
-	testDB, err := gorm.Open(sqlite.Open(tempFile.Name()), &gorm.Config{})
+	store, err := models.OpenStore(tempFile.Name(), false)
 	if err != nil {
 		t.Fatalf("Failed to open database: %v", err)
 	}
 
 	// Migrate the schema
-	err = testDB.AutoMigrate(&models.Log{})
+	err = store.DB.AutoMigrate(&models.Log{}, &models.AuthEvent{})
 	if err != nil {
 		t.Fatalf("Failed to migrate schema: %v", err)
 	}
 
-	// Set the global db variable to our test database
-	models.DB = testDB
-
 	// Return a cleanup function
 	cleanup := func() {
-		// Get the underlying SQL database
-		sqlDB, err := testDB.DB()
-		if err == nil {
-			sqlDB.Close()
-		}
+		store.Close()
 		os.Remove(tempFile.Name())
 	}
 
-	return testDB, cleanup
+	return store, cleanup
 }
 
 // loadTestLogsFromCSV reads test log data from a CSV file and inserts it into the database
@@ -105,11 +97,12 @@ func loadTestLogsFromCSV(t *testing.T, testDB *gorm.DB, csvFilePath string) {
 
 		// Create and insert the log
 		log := models.Log{
-			ClientIP:  record[0],
-			Hostname:  record[1],
-			Content:   record[2],
-			Priority:  priority,
-			Timestamp: timestamp,
+			ClientIP:   record[0],
+			Hostname:   record[1],
+			Content:    record[2],
+			Priority:   priority,
+			ReceivedAt: timestamp,
+			DeviceTime: timestamp,
 		}
 
 		err = testDB.Create(&log).Error
@@ -121,12 +114,14 @@ func loadTestLogsFromCSV(t *testing.T, testDB *gorm.DB, csvFilePath string) {
 
 // TestTimeDecayComponentCSV tests the time decay component using data from CSV
 func TestTimeDecayComponentCSV(t *testing.T) {
+	t.Parallel()
+
 	// Setup test database
-	_, cleanup := setupTestDBFromCSV(t)
+	store, cleanup := setupTestDBFromCSV(t)
 	defer cleanup()
 
 	// Load test logs from CSV
-	loadTestLogsFromCSV(t, models.DB, "testdata/time_decay_test.csv")
+	loadTestLogsFromCSV(t, store.DB, "testdata/time_decay_test.csv")
 
 	// Test parameters
 	alpha := 10.0
@@ -142,7 +137,7 @@ func TestTimeDecayComponentCSV(t *testing.T) {
 
 	scores := make(map[string]float64)
 	for _, host := range hosts {
-		score, err := TimeDecayComponent(host, alpha, lambda)
+		score, err := TimeDecayComponent(store, host, alpha, lambda)
 		if err != nil {
 			t.Fatalf("TimeDecayComponent for host %s returned an error: %v", host, err)
 		}
@@ -167,12 +162,14 @@ func TestTimeDecayComponentCSV(t *testing.T) {
 
 // TestVolumeComponentCSV tests the volume component using data from CSV
 func TestVolumeComponentCSV(t *testing.T) {
+	t.Parallel()
+
 	// Setup test database
-	_, cleanup := setupTestDBFromCSV(t)
+	store, cleanup := setupTestDBFromCSV(t)
 	defer cleanup()
 
 	// Load test logs from CSV
-	loadTestLogsFromCSV(t, models.DB, "testdata/volume_test.csv")
+	loadTestLogsFromCSV(t, store.DB, "testdata/volume_test.csv")
 
 	// Test parameter
 	beta := 0.5
@@ -186,7 +183,7 @@ func TestVolumeComponentCSV(t *testing.T) {
 
 	scores := make(map[string]float64)
 	for _, host := range hosts {
-		score, err := VolumeComponent(host, beta)
+		score, err := VolumeComponent(store, host, beta)
 		if err != nil {
 			t.Fatalf("VolumeComponent for host %s returned an error: %v", host, err)
 		}
@@ -207,12 +204,14 @@ func TestVolumeComponentCSV(t *testing.T) {
 
 // TestSeverityComponentCSV tests the severity component using data from CSV
 func TestSeverityComponentCSV(t *testing.T) {
+	t.Parallel()
+
 	// Setup test database
-	_, cleanup := setupTestDBFromCSV(t)
+	store, cleanup := setupTestDBFromCSV(t)
 	defer cleanup()
 
 	// Load test logs from CSV
-	loadTestLogsFromCSV(t, models.DB, "testdata/severity_test.csv")
+	loadTestLogsFromCSV(t, store.DB, "testdata/severity_test.csv")
 
 	// Test parameter
 	gamma := 5.0
@@ -227,7 +226,7 @@ func TestSeverityComponentCSV(t *testing.T) {
 
 	scores := make(map[string]float64)
 	for _, host := range hosts {
-		score, err := SeverityComponent(host, gamma)
+		score, err := SeverityComponent(store, host, gamma)
 		if err != nil {
 			t.Fatalf("SeverityComponent for host %s returned an error: %v", host, err)
 		}
@@ -248,12 +247,14 @@ func TestSeverityComponentCSV(t *testing.T) {
 
 // TestVisibilityScoreCSV tests the overall visibility score using data from CSV
 func TestVisibilityScoreCSV(t *testing.T) {
+	t.Parallel()
+
 	// Setup test database
-	_, cleanup := setupTestDBFromCSV(t)
+	store, cleanup := setupTestDBFromCSV(t)
 	defer cleanup()
 
 	// Load test logs from CSV
-	loadTestLogsFromCSV(t, models.DB, "testdata/visibility_test.csv")
+	loadTestLogsFromCSV(t, store.DB, "testdata/visibility_test.csv")
 
 	// Test hosts with different characteristics
 	hosts := []string{
@@ -267,7 +268,7 @@ func TestVisibilityScoreCSV(t *testing.T) {
 
 	scores := make(map[string]float64)
 	for _, host := range hosts {
-		score, err := VisibilityScore(host)
+		score, err := VisibilityScore(store, host)
 		if err != nil {
 			t.Fatalf("VisibilityScore for host %s returned an error: %v", host, err)
 		}
@@ -295,15 +296,17 @@ func TestVisibilityScoreCSV(t *testing.T) {
 
 // TestGetAllHostScoresCSV tests the GetAllHostScores function using data from CSV
 func TestGetAllHostScoresCSV(t *testing.T) {
+	t.Parallel()
+
 	// Setup test database
-	_, cleanup := setupTestDBFromCSV(t)
+	store, cleanup := setupTestDBFromCSV(t)
 	defer cleanup()
 
 	// Load test logs from CSV
-	loadTestLogsFromCSV(t, models.DB, "testdata/all_hosts_test.csv")
+	loadTestLogsFromCSV(t, store.DB, "testdata/all_hosts_test.csv")
 
 	// Call the function being tested
-	hostScorePairs, err := GetAllHostScores()
+	hostScorePairs, err := GetAllHostScores(store)
 
 	// Verify results
 	if err != nil {
@@ -342,22 +345,22 @@ func TestGetAllHostScoresCSV(t *testing.T) {
 	// First, find the most recent and oldest timestamps
 	for host := range scores {
 		var log models.Log
-		result := models.DB.Where("client_ip = ?", host).Order("timestamp desc").First(&log)
+		result := store.DB.Where("client_ip = ?", host).Order("received_at desc").First(&log)
 		if result.Error != nil {
 			continue
 		}
 
-		if recentTimestamp.IsZero() || log.Timestamp.After(recentTimestamp) {
-			recentTimestamp = log.Timestamp
+		if recentTimestamp.IsZero() || log.ReceivedAt.After(recentTimestamp) {
+			recentTimestamp = log.ReceivedAt
 		}
 
-		result = models.DB.Where("client_ip = ?", host).Order("timestamp asc").First(&log)
+		result = store.DB.Where("client_ip = ?", host).Order("received_at asc").First(&log)
 		if result.Error != nil {
 			continue
 		}
 
-		if oldTimestamp.IsZero() || log.Timestamp.Before(oldTimestamp) {
-			oldTimestamp = log.Timestamp
+		if oldTimestamp.IsZero() || log.ReceivedAt.Before(oldTimestamp) {
+			oldTimestamp = log.ReceivedAt
 		}
 	}
 
@@ -367,21 +370,21 @@ func TestGetAllHostScoresCSV(t *testing.T) {
 
 	for host := range scores {
 		var log models.Log
-		result := models.DB.Where("client_ip = ?", host).Order("timestamp desc").First(&log)
+		result := store.DB.Where("client_ip = ?", host).Order("received_at desc").First(&log)
 		if result.Error != nil {
 			continue
 		}
 
-		if log.Timestamp.After(recentThreshold) {
+		if log.ReceivedAt.After(recentThreshold) {
 			recentHosts = append(recentHosts, host)
 		}
 
-		result = models.DB.Where("client_ip = ?", host).Order("timestamp asc").First(&log)
+		result = store.DB.Where("client_ip = ?", host).Order("received_at asc").First(&log)
 		if result.Error != nil {
 			continue
 		}
 
-		if log.Timestamp.Before(oldThreshold) {
+		if log.ReceivedAt.Before(oldThreshold) {
 			oldHosts = append(oldHosts, host)
 		}
 	}
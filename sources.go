@@ -0,0 +1,234 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"hostlog/models"
+
+	"gopkg.in/mcuadros/go-syslog.v2"
+)
+
+// The syslog listeners sources can be filtered on
+const (
+	ListenerUDP = "udp"
+	ListenerTCP = "tcp"
+)
+
+// SourceConfig sets the source addresses one listener accepts. A denied source is
+// always rejected; with an allow list, other sources are unknown.
+type SourceConfig struct {
+	Allow   []string `json:"allow"`   // Addresses or CIDR prefixes; empty allows every source not denied
+	Deny    []string `json:"deny"`    // Addresses or CIDR prefixes
+	Unknown string   `json:"unknown"` // reject (default) or tag unknown sources
+}
+
+// What happens to the messages of unknown sources
+const (
+	UnknownReject = "reject"
+	UnknownTag    = "tag" // Stored with the field source=unknown
+)
+
+// unknownSourceKey marks the log parts of a message from an unknown source
+const unknownSourceKey = "unknown_source"
+
+// listenerKey marks the log parts of a message with the listener that received it
+const listenerKey = "listener"
+
+// unknownSourceField is the field tagged messages are stored with
+var unknownSourceField = models.Field{Name: "source", Value: "unknown"}
+
+// maxRejectedSources bounds the rejected sources remembered; the least recent are forgotten
+const maxRejectedSources = 100
+
+// sourceFilter is the compiled SourceConfig of one listener
+type sourceFilter struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	unknown string
+}
+
+// RejectedSource is a source address a listener rejected messages from
+type RejectedSource struct {
+	Source   string
+	Listener string
+	Reason   string // denied or unknown
+	Count    int64
+	First    time.Time
+	Last     time.Time
+	Message  string // Content of the last rejected message
+}
+
+// SourceFilters accept or reject the messages of each listener by source address
+type SourceFilters struct {
+	listeners map[string]sourceFilter
+
+	mu       sync.Mutex
+	rejected map[string]*RejectedSource // By listener and source
+}
+
+// NewSourceFilters returns the filters of the listeners, or nil when no listener is filtered
+func NewSourceFilters(configs map[string]SourceConfig) (*SourceFilters, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	filters := &SourceFilters{listeners: make(map[string]sourceFilter), rejected: make(map[string]*RejectedSource)}
+	for listener, config := range configs {
+		if listener != ListenerUDP && listener != ListenerTCP {
+			return nil, fmt.Errorf("unknown listener %q", listener)
+		}
+		filter := sourceFilter{unknown: cmp.Or(config.Unknown, UnknownReject)}
+		if filter.unknown != UnknownReject && filter.unknown != UnknownTag {
+			return nil, fmt.Errorf("listener %s: unknown sources must be rejected or tagged, not %q", listener, config.Unknown)
+		}
+		var err error
+		if filter.allow, err = parsePrefixes(config.Allow); err != nil {
+			return nil, fmt.Errorf("listener %s: %w", listener, err)
+		}
+		if filter.deny, err = parsePrefixes(config.Deny); err != nil {
+			return nil, fmt.Errorf("listener %s: %w", listener, err)
+		}
+		filters.listeners[listener] = filter
+	}
+	return filters, nil
+}
+
+// parsePrefixes parses addresses and CIDR prefixes
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// contains reports whether one of the prefixes contains the address
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	return slices.ContainsFunc(prefixes, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+// Check returns why a listener rejects the message, "" when it accepts it, and
+// whether it is tagged as from an unknown source
+func (f *SourceFilters) Check(listener string, logParts map[string]interface{}) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	filter, ok := f.listeners[listener]
+	if !ok {
+		return "", false
+	}
+
+	addr, err := netip.ParseAddr(models.ExtractIP(models.GetStringValue(logParts, "client")))
+	addr = addr.Unmap()
+	switch {
+	case err == nil && contains(filter.deny, addr):
+		return "denied", false
+	case len(filter.allow) == 0 || (err == nil && contains(filter.allow, addr)):
+		return "", false
+	case filter.unknown == UnknownTag:
+		return "", true
+	default:
+		return "unknown", false
+	}
+}
+
+// Relay passes the messages a listener accepts from in to out, marking them with
+// the listener and those of unknown sources, and remembers the sources it rejects
+func (f *SourceFilters) Relay(listener string, in, out syslog.LogPartsChannel) {
+	for logParts := range in {
+		reason, unknown := f.Check(listener, logParts)
+		if reason != "" {
+			f.reject(listener, logParts, reason, time.Now())
+			metrics.Dropped(listener, DropRejected)
+			continue
+		}
+		if unknown {
+			logParts[unknownSourceKey] = true
+		}
+		logParts[listenerKey] = listener
+		out <- logParts
+	}
+}
+
+// reject counts a rejected message of its source
+func (f *SourceFilters) reject(listener string, logParts map[string]interface{}, reason string, now time.Time) {
+	source := models.ExtractIP(models.GetStringValue(logParts, "client"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := listener + " " + source
+	rejected, ok := f.rejected[key]
+	if !ok {
+		if len(f.rejected) >= maxRejectedSources {
+			var oldest string
+			for key, r := range f.rejected {
+				if oldest == "" || r.Last.Before(f.rejected[oldest].Last) {
+					oldest = key
+				}
+			}
+			delete(f.rejected, oldest)
+		}
+		rejected = &RejectedSource{Source: source, Listener: listener, First: now}
+		f.rejected[key] = rejected
+	}
+	rejected.Reason = reason
+	rejected.Count++
+	rejected.Last = now
+	rejected.Message = models.GetStringValue(logParts, "content")
+}
+
+// Rejected returns the recently rejected sources, most recent first
+func (f *SourceFilters) Rejected() []RejectedSource {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rejected := make([]RejectedSource, 0, len(f.rejected))
+	for _, r := range f.rejected {
+		rejected = append(rejected, *r)
+	}
+	slices.SortFunc(rejected, func(a, b RejectedSource) int {
+		return cmp.Or(b.Last.Compare(a.Last), cmp.Compare(a.Source, b.Source))
+	})
+	return rejected
+}
+
+// receivedOn returns the listener that received the message, removing the mark.
+// Messages hostlog logs itself have no listener.
+func receivedOn(logParts map[string]interface{}) string {
+	listener, ok := logParts[listenerKey].(string)
+	delete(logParts, listenerKey)
+	if !ok {
+		return listenerInternal
+	}
+	return listener
+}
+
+// fromUnknownSource reports whether the message was accepted from an unknown
+// source, removing the mark
+func fromUnknownSource(logParts map[string]interface{}) bool {
+	_, ok := logParts[unknownSourceKey]
+	delete(logParts, unknownSourceKey)
+	return ok
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// TestSourceFilters accepts, tags and rejects messages by listener and source, and lists the rejected sources
+func TestSourceFilters(t *testing.T) {
+	t.Parallel()
+
+	filters, err := NewSourceFilters(map[string]SourceConfig{
+		ListenerUDP: {Allow: []string{"192.168.1.0/24", "2001:db8::/32"}, Deny: []string{"192.168.1.66"}},
+		ListenerTCP: {Allow: []string{"10.0.0.5"}, Unknown: UnknownTag},
+	})
+	if err != nil {
+		t.Fatalf("NewSourceFilters returned an error: %v", err)
+	}
+
+	for _, test := range []struct {
+		listener, client string
+		reason           string
+		unknown          bool
+	}{
+		{ListenerUDP, "192.168.1.20:514", "", false},
+		{ListenerUDP, "[2001:db8::20]:514", "", false},
+		{ListenerUDP, "[::ffff:192.168.1.20]:514", "", false},
+		{ListenerUDP, "192.168.1.66:514", "denied", false},
+		{ListenerUDP, "203.0.113.9:514", "unknown", false},
+		{ListenerTCP, "10.0.0.5:40000", "", false},
+		{ListenerTCP, "192.168.1.20:40000", "", true},
+	} {
+		reason, unknown := filters.Check(test.listener, map[string]interface{}{"client": test.client})
+		if reason != test.reason || unknown != test.unknown {
+			t.Errorf("Expected %s from %s to give %q and %v, got %q and %v", test.listener, test.client, test.reason, test.unknown, reason, unknown)
+		}
+	}
+
+	// Relay passes accepted messages on and remembers the rejected sources
+	in, out := make(syslog.LogPartsChannel, 4), make(syslog.LogPartsChannel, 4)
+	in <- format.LogParts{"client": "203.0.113.9:514", "content": "first"}
+	in <- format.LogParts{"client": "203.0.113.9:514", "content": "second"}
+	in <- format.LogParts{"client": "192.168.1.20:514", "content": "accepted"}
+	close(in)
+	filters.Relay(ListenerUDP, in, out)
+	if len(out) != 1 || (<-out)["content"] != "accepted" {
+		t.Errorf("Expected only the accepted message relayed")
+	}
+	rejected := filters.Rejected()
+	if len(rejected) != 1 || rejected[0].Source != "203.0.113.9" || rejected[0].Count != 2 || rejected[0].Message != "second" || rejected[0].Reason != "unknown" {
+		t.Errorf("Expected the unknown source rejected twice, got %+v", rejected)
+	}
+
+	// Tagged messages carry a mark the ingest loop removes
+	in, out = make(syslog.LogPartsChannel, 1), make(syslog.LogPartsChannel, 1)
+	in <- format.LogParts{"client": "192.168.1.20:40000"}
+	close(in)
+	filters.Relay(ListenerTCP, in, out)
+	logParts := <-out
+	if !fromUnknownSource(logParts) || fromUnknownSource(logParts) {
+		t.Errorf("Expected the message marked once, got %v", logParts)
+	}
+
+	var unfiltered *SourceFilters
+	if reason, unknown := unfiltered.Check(ListenerUDP, map[string]interface{}{"client": "203.0.113.9:514"}); reason != "" || unknown {
+		t.Error("Expected every source accepted without lists")
+	}
+	for _, configs := range []map[string]SourceConfig{
+		{"unix": {}},
+		{ListenerUDP: {Allow: []string{"192.168.1.0/33"}}},
+		{ListenerUDP: {Deny: []string{"router"}}},
+		{ListenerTCP: {Unknown: "ignore"}},
+	} {
+		if _, err := NewSourceFilters(configs); err == nil {
+			t.Errorf("Expected an error for %+v", configs)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 class Filters {
     name = 'Filters';
     grid = null;
-    values = new Set();
+    values = new Map(); // Host ID to name
+    groups = new Set();
+    fields = new Set(); // name=value conditions, all of which must match
 
     updateURL(url) {
         const query = this.getQuery();
@@ -21,10 +23,43 @@ class Filters {
 
     getQuery() {
         return {
-            hosts: [...this.values]
+            host_ids: [...this.values.keys()],
+            groups: [...this.groups],
+            fields: [...this.fields]
         };
     };
 
+    isActive() {
+        return this.values.size > 0 || this.groups.size > 0 || this.fields.size > 0;
+    };
+
+    // matches reports whether a live log row passes the active filters
+    matches(row) {
+        const fields = JSON.parse(row.getAttribute('data-fields') || 'null') || [];
+        if (![...this.fields].every(field => fields.includes(field))) {
+            return false;
+        }
+        if ((this.values.size === 0 && this.groups.size === 0) || this.values.has(row.getAttribute('data-host'))) {
+            return true;
+        }
+        const groups = JSON.parse(row.getAttribute('data-groups') || 'null') || [];
+        return groups.some(group => this.groups.has(group));
+    };
+
+    addTag(container, name, attribute, value, className) {
+        const tag = document.createElement('span');
+        tag.className = className;
+        tag.textContent = name;
+
+        const deleteButton = document.createElement('button');
+        deleteButton.setAttribute(attribute, value);
+        deleteButton.className = 'delete is-small';
+        deleteButton.addEventListener('click', (event) => this.toggleHandler(event));
+
+        tag.appendChild(deleteButton);
+        container.appendChild(tag);
+    };
+
     update() {
         this.grid.load();
 
@@ -32,43 +67,67 @@ class Filters {
         const tagsContainer = filtersContainer.querySelector('.tags');
         [...tagsContainer.children].forEach(c => c.remove());
 
-        const activeFilters = this.values;
-        if (activeFilters.size > 0) {
+        if (this.isActive()) {
             filtersContainer.style.display = 'block';
 
-            activeFilters.forEach((host) => {
-                const tag = document.createElement('span');
-                tag.className = 'tag is-info';
-                tag.textContent = host;
-
-                const deleteButton = document.createElement('button');
-                deleteButton.setAttribute('data-host', host);
-                deleteButton.className = 'delete is-small';
-                deleteButton.addEventListener('click', (event) => this.toggleHandler(event));
-
-                tag.appendChild(deleteButton);
-                tagsContainer.appendChild(tag);
+            this.groups.forEach((group) => {
+                this.addTag(tagsContainer, group, 'data-group', group, 'tag is-link');
+            });
+            this.values.forEach((name, host) => {
+                this.addTag(tagsContainer, name, 'data-host', host, 'tag is-info');
+            });
+            this.fields.forEach((field) => {
+                this.addTag(tagsContainer, field, 'data-field', field, 'tag is-primary');
             });
         } else {
             filtersContainer.style.display = 'none';
         }
     };
 
-    toggle(value) {
+    toggle(value, name) {
         if(this.values.has(value)) {
             this.values.delete(value);
         } else {
-            this.values.add(value);
+            this.values.set(value, name || value);
+        }
+    };
+
+    toggleGroup(group) {
+        if(this.groups.has(group)) {
+            this.groups.delete(group);
+        } else {
+            this.groups.add(group);
+        }
+    };
+
+    toggleField(field) {
+        if(this.fields.has(field)) {
+            this.fields.delete(field);
+        } else {
+            this.fields.add(field);
         }
     };
 
     toggleHandler(event) {
         event.preventDefault();
-        const value = event.target.getAttribute('data-host');
+        const control = event.target.closest('[data-host], [data-group], [data-field]');
+        if(control.hasAttribute('data-field')) {
+            this.toggleField(control.getAttribute('data-field'));
+            this.update();
+            return;
+        }
+        if(control.hasAttribute('data-group')) {
+            this.toggleGroup(control.getAttribute('data-group'));
+            this.update();
+            return;
+        }
+        const value = control.getAttribute('data-host');
         if(value.length) {
-            this.toggle(value);
+            this.toggle(value, control.getAttribute('data-name'));
         } else {
             this.values.clear();
+            this.groups.clear();
+            this.fields.clear();
         }
         this.update();
     };
@@ -85,6 +144,24 @@ class Filters {
             this.register(control);
         }
 
+        // Field tags are rendered with each page of logs, so clicks are delegated
+        document.addEventListener('click', (event) => {
+            if (event.target.closest('.field-filter-item')) {
+                this.toggleHandler(event);
+            }
+        });
+        const fieldInput = document.getElementById('field-filter');
+        fieldInput.addEventListener('keydown', (event) => {
+            const field = fieldInput.value.trim();
+            if (event.key !== 'Enter' || !field.includes('=')) {
+                return;
+            }
+            const [name, ...value] = field.split('=');
+            this.fields.add(`${name.trim()}=${value.join('=').trim()}`);
+            fieldInput.value = '';
+            this.update();
+        });
+
         const dropdown = document.getElementById('host-filter-dropdown');
         dropdown.querySelector('.dropdown-trigger button').addEventListener('click', () => {
             dropdown.classList.toggle('is-active');
@@ -37,7 +37,7 @@ class Grid {
     initEvents() {
         const eventSource = new EventSource('/events');
         eventSource.onmessage = (event) => {
-            if (this.pagination.page !== 0) {
+            if (!this.pagination.isNewest()) {
                 return;
             }
 
@@ -47,8 +47,14 @@ class Grid {
                 temp.innerHTML = event.data;
                 const row = temp.content.firstChild;
 
-                const source = row.getAttribute('data-source');
-                if (this.filters.values.size > 0 && !this.filters.values.has(source)) {
+                // A repeated message updates its row in place
+                const existing = tbody.querySelector(`tr[data-id="${row.getAttribute('data-id')}"]`);
+                if (existing) {
+                    existing.replaceWith(row);
+                    return;
+                }
+
+                if (!this.filters.matches(row)) {
                     return;
                 }
 
@@ -59,9 +65,14 @@ class Grid {
 
                 tbody.insertBefore(row, tbody.firstChild);
 
-                // Optional: limit to 100 rows
+                // Limit to 100 rows; older pages continue after the last row shown
                 if (tbody.children.length > 100) {
-                    tbody.removeChild(tbody.lastChild);
+                    tbody.removeChild(tbody.lastElementChild);
+                    const older = this.grid.querySelector('.pagination-next');
+                    if (older) {
+                        older.setAttribute('data-before', tbody.lastElementChild.getAttribute('data-cursor'));
+                        older.removeAttribute('disabled');
+                    }
                 }
             }
         };
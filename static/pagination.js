@@ -1,17 +1,33 @@
 class Pagination {
     name = 'Pagination';
-    page = 0;
+    before = '';
+    after = '';
+    newest = true;
 
     updateURL(url) {
-        url.searchParams.append('page', this.getPage());
+        if(this.before) {
+            url.searchParams.append('before', this.before);
+        }
+        if(this.after) {
+            url.searchParams.append('after', this.after);
+        }
     };
 
-    getPage() {
-        return this.page;
+    isNewest() {
+        return this.newest;
     };
 
     init(grid) {
         this.grid = grid;
+
+        // Live logs are only shown on the newest page
+        const newer = this.grid.grid.querySelector('.pagination-previous');
+        this.newest = !newer || newer.hasAttribute('disabled');
+        if(this.newest) {
+            this.before = '';
+            this.after = '';
+        }
+
         const paginationLinks = this.grid.grid.querySelectorAll('.pagination-link, .pagination-previous, .pagination-next');
         paginationLinks.forEach((link) => {
             link.addEventListener('click', (event) => {
@@ -21,10 +37,10 @@ class Pagination {
                 if(disabled) {
                     return;
                 }
-                const page = target.getAttribute('data-page');
-                this.page = parseInt(page, 10);
+                this.before = target.getAttribute('data-before') || '';
+                this.after = target.getAttribute('data-after') || '';
                 this.grid.load();
             });
         });
     };
-};
\ No newline at end of file
+};
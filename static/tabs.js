@@ -2,19 +2,26 @@ document.addEventListener('DOMContentLoaded', () => {
     const tabLinks = document.querySelectorAll('.tab-link');
     const tabContents = document.querySelectorAll('.tab-content');
 
+    const show = (tabId) => {
+        tabContents.forEach(content => {
+            content.style.display = 'none';
+        });
+        document.getElementById(tabId).style.display = 'block';
+    };
+
     tabLinks.forEach(link => {
         link.addEventListener('click', (e) => {
             e.preventDefault();
-
-            tabContents.forEach(content => {
-                content.style.display = 'none';
-            });
-
-            const tabId = e.target.getAttribute('data-tab');
-            document.getElementById(tabId).style.display = 'block';
+            show(e.target.getAttribute('data-tab'));
         });
     });
 
+    // Forms redirect back to their tab
+    const linked = document.querySelector(`.tab-link[href="${window.location.hash}"]`);
+    if (window.location.hash && linked) {
+        show(linked.getAttribute('data-tab'));
+    }
+
     // dropdown
 
 });
\ No newline at end of file
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// WebhookConfig configures delivery of alert notifications to a generic HTTP endpoint
+type WebhookConfig struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"` // text/template rendered with the Notification; defaults to the notification as JSON
+	MaxRetries *int              `json:"max_retries"`
+	Backoff    Duration          `json:"backoff"` // Delay before the first retry, doubled on every attempt
+	Timeout    Duration          `json:"timeout"`
+}
+
+// WebhookNotifier posts notifications to an HTTP endpoint, retrying failed deliveries
+type WebhookNotifier struct {
+	config     WebhookConfig
+	body       *template.Template
+	client     *http.Client
+	maxRetries int
+}
+
+// NewWebhookNotifier validates the webhook configuration and parses its body template
+func NewWebhookNotifier(config WebhookConfig) (*WebhookNotifier, error) {
+	if config.Name == "" || config.URL == "" {
+		return nil, fmt.Errorf("webhook requires a name and a url")
+	}
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+
+	notifier := &WebhookNotifier{
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout.Or(10 * time.Second)},
+		maxRetries: 3,
+	}
+	if config.MaxRetries != nil {
+		notifier.maxRetries = *config.MaxRetries
+	}
+
+	if config.Body != "" {
+		body, err := template.New(config.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(config.Body)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", config.Name, err)
+		}
+		notifier.body = body
+	}
+
+	return notifier, nil
+}
+
+func (w *WebhookNotifier) Name() string {
+	return w.config.Name
+}
+
+// Notify renders the body and sends it, retrying with exponential backoff
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := w.render(n)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.config.Backoff.Or(time.Second)
+	for attempt := 0; ; attempt++ {
+		err = w.send(body)
+		if err == nil || attempt >= w.maxRetries {
+			return err
+		}
+		time.Sleep(backoff << attempt)
+	}
+}
+
+func (w *WebhookNotifier) render(n Notification) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(n)
+	}
+
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, n); err != nil {
+		return nil, fmt.Errorf("rendering webhook %s: %w", w.config.Name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *WebhookNotifier) send(body []byte) error {
+	req, err := http.NewRequest(w.config.Method, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", w.config.Name, resp.Status)
+	}
+	return nil
+}
+
+// toJSON encodes a value for safe embedding in a JSON body template
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}